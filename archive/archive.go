@@ -0,0 +1,367 @@
+// Package archive exports an index to a portable file and imports it on
+// another machine, so that a library is indexed once and shared.
+//
+// An archive is a zip file with three entries:
+//
+//	manifest.json  format and schema versions, creation time and counts
+//	files.jsonl    one file per line, with its path relative to the library root
+//	               and the SHA-256 hash of its content
+//	pages.jsonl    one page per line, with its text and language
+//
+// Importing remaps the relative paths to a new root and checks that the
+// PDFs found there have the same content as the exported ones.
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/pdf"
+)
+
+// Version of the archive format. Bumped when the entries change in a way
+// older versions cannot read.
+const FormatVersion = 1
+
+// Names of the archive entries.
+const (
+	manifestEntry = "manifest.json"
+	filesEntry    = "files.jsonl"
+	pagesEntry    = "pages.jsonl"
+)
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	SchemaVersion int       `json:"schema_version"` // Schema of the exporting database
+	CreatedAt     time.Time `json:"created_at"`
+	Root          string    `json:"root"` // Library root on the exporting machine
+	Files         int       `json:"files"`
+	Pages         int       `json:"pages"`
+}
+
+// A file of the archive.
+type fileRecord struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"` // Relative to the root, with forward slashes
+	Language string `json:"language"`
+	SHA256   string `json:"sha256"`
+}
+
+// A page of the archive.
+type pageRecord struct {
+	FileID   int    `json:"file_id"`
+	PageNum  int    `json:"page_num"`
+	Language string `json:"language"`
+	Text     string `json:"text"`
+}
+
+// Export writes the index of store to an archive at path.
+// Paths are stored relative to root, which must contain every file.
+// If root is empty, the deepest directory containing every file is used.
+func Export(ctx context.Context, store *database.Store, path, root string) (Manifest, error) {
+	files, err := store.GetFiles(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	if root == "" {
+		root = commonDir(files)
+	}
+
+	schemaVersion, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		FormatVersion: FormatVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Root:          root,
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return manifest, err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	w, err := zw.Create(filesEntry)
+	if err != nil {
+		return manifest, err
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return manifest, fmt.Errorf("%s is not inside the root %s", file.Path, root)
+		}
+
+		hash, err := pdf.GetContentHash(file.Path)
+		if err != nil {
+			return manifest, fmt.Errorf("unable to hash %s: %w", file.Path, err)
+		}
+
+		err = encoder.Encode(fileRecord{
+			ID:       file.ID,
+			Name:     file.Name,
+			Path:     filepath.ToSlash(rel),
+			Language: file.Language,
+			SHA256:   hash,
+		})
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files++
+	}
+
+	w, err = zw.Create(pagesEntry)
+	if err != nil {
+		return manifest, err
+	}
+
+	encoder = json.NewEncoder(w)
+	err = store.EachPage(ctx, func(page database.Page) error {
+		manifest.Pages++
+		return encoder.Encode(pageRecord{
+			FileID:   page.FileID,
+			PageNum:  page.PageNum,
+			Language: page.Language,
+			Text:     page.Text,
+		})
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	// The manifest is written last since it holds the counts.
+	w, err = zw.Create(manifestEntry)
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.NewEncoder(w).Encode(manifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, out.Close()
+}
+
+// Options of Import.
+type ImportOptions struct {
+	// Library root on this machine. Paths of the archive are relative to it.
+	Root string
+
+	// Import files without checking that they exist and match their hash.
+	SkipVerify bool
+}
+
+// Result of an import.
+type ImportResult struct {
+	Manifest Manifest
+	Files    int      // Number of files imported
+	Pages    int      // Number of pages imported
+	Existing int      // Files skipped because they are already in the index
+	Skipped  []string // Files skipped because they are missing or differ
+}
+
+// Import loads the archive at path into store, remapping its paths to
+// opts.Root. Files already in the index are skipped, as are files that are
+// missing or whose content differs from the exported one, unless
+// opts.SkipVerify is set.
+func Import(ctx context.Context, store *database.Store, path string, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return result, err
+	}
+	defer zr.Close()
+
+	err = readJSON(&zr.Reader, manifestEntry, &result.Manifest)
+	if err != nil {
+		return result, err
+	}
+
+	err = checkManifest(result.Manifest)
+	if err != nil {
+		return result, err
+	}
+
+	existing, err := store.GetFiles(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	indexed := make(map[string]bool, len(existing))
+	for _, file := range existing {
+		indexed[file.Path] = true
+	}
+
+	// File IDs are hashes of the paths, so they change with the root.
+	ids := make(map[int]int)
+	files := []database.File{}
+	err = eachLine(&zr.Reader, filesEntry, func(line []byte) error {
+		var record fileRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+
+		filePath := filepath.Join(opts.Root, filepath.FromSlash(record.Path))
+		if indexed[filePath] {
+			result.Existing++
+			return nil
+		}
+
+		if !opts.SkipVerify {
+			hash, err := pdf.GetContentHash(filePath)
+			if err != nil || hash != record.SHA256 {
+				log.Printf("skipping %s: missing or different from the exported file\n", filePath)
+				result.Skipped = append(result.Skipped, filePath)
+				return nil
+			}
+		}
+
+		id := int(pdf.GetPathHash(filePath))
+		ids[record.ID] = id
+		files = append(files, database.File{
+			ID:       id,
+			Name:     record.Name,
+			Path:     filePath,
+			Language: record.Language,
+			SHA256:   record.SHA256,
+		})
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	pages := []database.Page{}
+	err = eachLine(&zr.Reader, pagesEntry, func(line []byte) error {
+		var record pageRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+
+		id, ok := ids[record.FileID]
+		if !ok {
+			return nil
+		}
+
+		pages = append(pages, database.Page{
+			FileID:   id,
+			PageNum:  record.PageNum,
+			Text:     record.Text,
+			Language: record.Language,
+		})
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = store.InsertFiles(ctx, files)
+	if err != nil {
+		return result, fmt.Errorf("unable to store files: %w", err)
+	}
+
+	err = store.InsertPages(ctx, pages)
+	if err != nil {
+		return result, fmt.Errorf("unable to store pages: %w", err)
+	}
+
+	result.Files = len(files)
+	result.Pages = len(pages)
+	return result, nil
+}
+
+// Refuse archives written by a newer version of pdfsearch.
+func checkManifest(manifest Manifest) error {
+	if manifest.FormatVersion > FormatVersion {
+		return fmt.Errorf("archive format version %d is newer than the supported version %d: upgrade pdfsearch",
+			manifest.FormatVersion, FormatVersion)
+	}
+
+	latest, err := database.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if manifest.SchemaVersion > latest {
+		return fmt.Errorf("archive schema version %d is newer than the latest known version %d: upgrade pdfsearch",
+			manifest.SchemaVersion, latest)
+	}
+	return nil
+}
+
+// Decode the JSON entry name of the archive into v.
+func readJSON(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
+
+// Call fn with every line of the entry name of the archive.
+func eachLine(zr *zip.Reader, name string, fn func(line []byte) error) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Pages can be much longer than the default 64KiB token size.
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// The deepest directory containing every file.
+func commonDir(files []database.File) string {
+	if len(files) == 0 {
+		return "."
+	}
+
+	dir := filepath.Dir(files[0].Path)
+	for _, file := range files[1:] {
+		for {
+			rel, err := filepath.Rel(dir, file.Path)
+			if err == nil && !strings.HasPrefix(rel, "..") {
+				break
+			}
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/pdf"
+)
+
+// Write a fake pdf at root/name and return its path.
+func writeFile(t *testing.T, root, name, content string) string {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openStore(t *testing.T) *database.Store {
+	t.Helper()
+	store, err := database.OpenMemory(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := t.TempDir()
+	cardiology := writeFile(t, source, "cardiology/heart.pdf", "heart")
+	infections := writeFile(t, source, "infections.pdf", "infections")
+
+	exporter := openStore(t)
+	err := exporter.InsertFiles(ctx, []database.File{
+		{ID: int(pdf.GetPathHash(cardiology)), Name: "heart.pdf", Path: cardiology, Language: "en"},
+		{ID: int(pdf.GetPathHash(infections)), Name: "infections.pdf", Path: infections, Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = exporter.InsertPages(ctx, []database.Page{
+		{FileID: int(pdf.GetPathHash(cardiology)), PageNum: 0, Text: "myocardial infarction", Language: "en"},
+		{FileID: int(pdf.GetPathHash(infections)), PageNum: 2, Text: "les infections graves", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "library.zip")
+	manifest, err := Export(ctx, exporter, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Root != source || manifest.Files != 2 || manifest.Pages != 2 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	// Same files under another root, one of them modified.
+	target := t.TempDir()
+	copied := writeFile(t, target, "cardiology/heart.pdf", "heart")
+	writeFile(t, target, "infections.pdf", "modified")
+
+	importer := openStore(t)
+	result, err := Import(ctx, importer, path, ImportOptions{Root: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Files != 1 || result.Pages != 1 || len(result.Skipped) != 1 {
+		t.Fatalf("expected 1 file imported and 1 skipped, got %+v", result)
+	}
+
+	files, err := importer.GetFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Path != copied || files[0].ID != int(pdf.GetPathHash(copied)) {
+		t.Fatalf("expected %s to be remapped, got %+v", copied, files)
+	}
+
+	results, err := importer.Search(ctx, "infarction")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].FileID != files[0].ID {
+		t.Fatalf("expected the page of the remapped file, got %+v", results)
+	}
+
+	// Importing again skips the indexed file, SkipVerify imports the other.
+	result, err = Import(ctx, importer, path, ImportOptions{Root: target, SkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Files != 1 || result.Existing != 1 {
+		t.Fatalf("expected 1 file imported and 1 existing, got %+v", result)
+	}
+}
+
+func TestExportOutsideRoot(t *testing.T) {
+	ctx := context.Background()
+	store := openStore(t)
+	path := writeFile(t, t.TempDir(), "a.pdf", "a")
+
+	err := store.InsertFiles(ctx, []database.File{{ID: 1, Name: "a.pdf", Path: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Export(ctx, store, filepath.Join(t.TempDir(), "library.zip"), t.TempDir())
+	if err == nil {
+		t.Fatal("expected an error for a file outside the root")
+	}
+}
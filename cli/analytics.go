@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+// A search of the exported query log.
+type loggedSearch struct {
+	ID          int64  `json:"id"`
+	SearchedAt  string `json:"searched_at"` // UTC
+	Query       string `json:"query"`
+	Language    string `json:"lang"`
+	Mode        string `json:"mode"`
+	Expand      bool   `json:"expand"`
+	Notes       bool   `json:"notes"`
+	BookID      int    `json:"book_id"` // 0 if all books were searched
+	Hits        int    `json:"hits"`
+	LatencyMs   int64  `json:"latency_ms"`
+	Clicks      int    `json:"clicks"`
+	ClickedBook int    `json:"clicked_book_id"` // Book of the last result opened, 0 if none
+	ClickedPage int    `json:"clicked_page"`    // Numbered from 1, 0 if none
+}
+
+// Export or prune the query log: analytics export|prune.
+func analyticsHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		args := positionalArgs("analytics")
+		if len(args) != 1 {
+			log.Fatalln("usage: pdfsearch analytics export|prune [--format json|csv] [--days N] [--output file]")
+		}
+
+		switch args[0] {
+		case "export":
+			since := time.Time{}
+			if config.ExportDays > 0 {
+				since = time.Now().AddDate(0, 0, -config.ExportDays)
+			}
+
+			entries, err := store.QueryLog(ctx, since)
+			if err != nil {
+				log.Fatalf("unable to read the query log: %v\n", err)
+			}
+
+			w := io.Writer(os.Stdout)
+			if config.Output != "" {
+				f, err := os.Create(config.Output)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if err := exportQueryLog(w, entries, config.ExportFormat); err != nil {
+				log.Fatalf("unable to export the query log: %v\n", err)
+			}
+
+			if config.Output != "" {
+				log.Printf("Exported %d searches to %s\n", len(entries), config.Output)
+			}
+		case "prune":
+			pruned, err := store.PruneQueryLog(ctx, config.QueryLogRetention)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("Deleted %d searches older than %d days\n", pruned, config.QueryLogRetention)
+		default:
+			log.Fatalf("unknown analytics command %q: expected export or prune\n", args[0])
+		}
+	}
+}
+
+// Write the searches of the query log to w in format, json or csv.
+func exportQueryLog(w io.Writer, entries []database.QueryLogEntry, format string) error {
+	searches := make([]loggedSearch, len(entries))
+	for i, e := range entries {
+		searches[i] = loggedSearch{
+			ID:          e.ID,
+			SearchedAt:  e.SearchedAt,
+			Query:       e.Query,
+			Language:    e.Language,
+			Mode:        e.Mode,
+			Expand:      e.Expand,
+			Notes:       e.Notes,
+			BookID:      e.Book,
+			Hits:        e.Hits,
+			LatencyMs:   e.Latency.Milliseconds(),
+			Clicks:      e.Clicks,
+			ClickedBook: e.ClickedFileID,
+		}
+
+		if e.Clicks > 0 {
+			searches[i].ClickedPage = e.ClickedPageNum + 1
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(searches)
+	case FormatCSV, "":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "searched_at", "query", "lang", "mode", "expand", "notes", "book_id",
+			"hits", "latency_ms", "clicks", "clicked_book_id", "clicked_page"})
+		for _, s := range searches {
+			cw.Write([]string{
+				strconv.FormatInt(s.ID, 10), s.SearchedAt, s.Query, s.Language, s.Mode,
+				strconv.FormatBool(s.Expand), strconv.FormatBool(s.Notes), strconv.Itoa(s.BookID),
+				strconv.Itoa(s.Hits), strconv.FormatInt(s.LatencyMs, 10), strconv.Itoa(s.Clicks),
+				strconv.Itoa(s.ClickedBook), strconv.Itoa(s.ClickedPage),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %q: expected json or csv", format)
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+func TestExportQueryLog(t *testing.T) {
+	entries := []database.QueryLogEntry{
+		{ID: 3, Query: "heart, failure", Mode: "fulltext", Expand: true, Hits: 4, Latency: 12 * time.Millisecond,
+			Clicks: 1, ClickedFileID: 7, ClickedPageNum: 41, SearchedAt: "2024-05-01 10:00:00"},
+	}
+
+	var buf bytes.Buffer
+	if err := exportQueryLog(&buf, entries, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id,searched_at,query,lang,mode,expand,notes,book_id,hits,latency_ms,clicks,clicked_book_id,clicked_page\n" +
+		"3,2024-05-01 10:00:00,\"heart, failure\",,fulltext,true,false,0,4,12,1,7,42\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := exportQueryLog(&buf, entries, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `"clicked_page": 42`) {
+		t.Fatalf("expected the clicked page to be numbered from 1, got %s", buf.String())
+	}
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+const collectionUsage = "usage: pdfsearch collection list|add <name> [--restricted]|remove <name>|show <name>|" +
+	"restrict <name>|unrestrict <name>|include <name> <id|path|glob>...|exclude <name> <id|path|glob>...|" +
+	"grant <name> user|group <name>|revoke <name> user|group <name>"
+
+const groupUsage = "usage: pdfsearch group list|add <name>|remove <name>|members <name>|join <name> <user>|leave <name> <user>"
+
+// Manage the collections, their documents and the users and groups granted
+// access to the restricted ones.
+func collectionHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		args := positionalArgs("collection")
+		if len(args) == 0 {
+			log.Fatalln(collectionUsage)
+		}
+
+		switch command := args[0]; {
+		case command == "list" && len(args) == 1:
+			collections, err := store.ListCollections(ctx)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			for _, c := range collections {
+				access := "open"
+				if c.Restricted {
+					access = "restricted"
+				}
+				fmt.Printf("%-30s %-10s %d documents\n", c.Name, access, c.Documents)
+			}
+		case command == "add" && len(args) == 2:
+			c, err := store.CreateCollection(ctx, args[1], config.Restricted)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("Created collection %s\n", c.Name)
+		case command == "remove" && len(args) == 2:
+			c := collectionByName(ctx, store, args[1])
+			if err := store.DeleteCollection(ctx, c.ID); err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("Removed collection %s. Its documents are still indexed\n", c.Name)
+		case command == "show" && len(args) == 2:
+			c := collectionByName(ctx, store, args[1])
+			files, err := store.CollectionFiles(ctx, c.ID)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			users, groups, err := store.CollectionAccess(ctx, c.ID)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			fmt.Printf("Restricted:  %v\n", c.Restricted)
+			fmt.Printf("Users:       %s\n", strings.Join(users, ", "))
+			fmt.Printf("Groups:      %s\n", strings.Join(groups, ", "))
+			for _, file := range files {
+				fmt.Printf("%10d %s\n", file.ID, file.Path)
+			}
+		case (command == "restrict" || command == "unrestrict") && len(args) == 2:
+			c := collectionByName(ctx, store, args[1])
+			if err := store.SetRestricted(ctx, c.ID, command == "restrict"); err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("%s is now %sed\n", c.Name, command)
+		case (command == "include" || command == "exclude") && len(args) >= 3:
+			c := collectionByName(ctx, store, args[1])
+			files, err := store.GetFileStats(ctx)
+			if err != nil {
+				log.Fatalf("unable to list files: %v\n", err)
+			}
+
+			ids := []int{}
+			for _, arg := range args[2:] {
+				matches := findFiles(files, arg)
+				if len(matches) == 0 {
+					log.Printf("no file matches %q\n", arg)
+				}
+
+				for _, file := range matches {
+					ids = append(ids, file.ID)
+					fmt.Printf("%10d %s\n", file.ID, file.Path)
+				}
+			}
+
+			update := store.AddToCollection
+			if command == "exclude" {
+				update = store.RemoveFromCollection
+			}
+
+			if err := update(ctx, c.ID, ids...); err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("%s %d files of %s\n", map[string]string{"include": "Added", "exclude": "Removed"}[command], len(ids), c.Name)
+		case (command == "grant" || command == "revoke") && len(args) == 4 && (args[2] == "user" || args[2] == "group"):
+			c := collectionByName(ctx, store, args[1])
+
+			var err error
+			switch id := granteeID(ctx, store, args[2], args[3]); {
+			case command == "grant" && args[2] == "user":
+				err = store.GrantUser(ctx, c.ID, id)
+			case command == "grant":
+				err = store.GrantGroup(ctx, c.ID, id)
+			case args[2] == "user":
+				err = store.RevokeUser(ctx, c.ID, id)
+			default:
+				err = store.RevokeGroup(ctx, c.ID, id)
+			}
+
+			if err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("%s the access of %s %s to %s\n", map[string]string{"grant": "Granted", "revoke": "Revoked"}[command],
+				args[2], args[3], c.Name)
+		default:
+			log.Fatalln(collectionUsage)
+		}
+	}
+}
+
+// Manage the groups of users.
+func groupHandler(store *database.Store) {
+	ctx := context.Background()
+	args := positionalArgs("group")
+	if len(args) == 0 {
+		log.Fatalln(groupUsage)
+	}
+
+	switch command := args[0]; {
+	case command == "list" && len(args) == 1:
+		groups, err := store.ListGroups(ctx)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, group := range groups {
+			fmt.Printf("%-30s %d members\n", group.Name, group.Members)
+		}
+	case command == "add" && len(args) == 2:
+		group, err := store.CreateGroup(ctx, args[1])
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Created group %s\n", group.Name)
+	case command == "remove" && len(args) == 2:
+		group := groupByName(ctx, store, args[1])
+		if err := store.DeleteGroup(ctx, group.ID); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Removed group %s\n", group.Name)
+	case command == "members" && len(args) == 2:
+		group := groupByName(ctx, store, args[1])
+		members, err := store.GroupMembers(ctx, group.ID)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, name := range members {
+			fmt.Println(name)
+		}
+	case (command == "join" || command == "leave") && len(args) == 3:
+		group := groupByName(ctx, store, args[1])
+		user := userByName(ctx, store, args[2])
+
+		update := store.AddGroupMember
+		if command == "leave" {
+			update = store.RemoveGroupMember
+		}
+
+		if err := update(ctx, group.ID, user.ID); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("%s %s %s\n", user.Name, map[string]string{"join": "joined", "leave": "left"}[command], group.Name)
+	default:
+		log.Fatalln(groupUsage)
+	}
+}
+
+// The collection named name. Exits if there is none.
+func collectionByName(ctx context.Context, store *database.Store, name string) database.Collection {
+	c, err := store.GetCollectionByName(ctx, name)
+	if err != nil {
+		log.Fatalf("unknown collection %q: %v\n", name, err)
+	}
+	return c
+}
+
+// The group named name. Exits if there is none.
+func groupByName(ctx context.Context, store *database.Store, name string) database.Group {
+	group, err := store.GetGroupByName(ctx, name)
+	if err != nil {
+		log.Fatalf("unknown group %q: %v\n", name, err)
+	}
+	return group
+}
+
+// The ID of the user or the group named name, given by kind.
+func granteeID(ctx context.Context, store *database.Store, kind, name string) int {
+	if kind == "user" {
+		return userByName(ctx, store, name).ID
+	}
+	return groupByName(ctx, store, name).ID
+}
@@ -1,23 +1,410 @@
 package cli
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/viewer"
+)
+
 // Config holds the configuration for the CLI.
+//
+// Settings are read, from lowest to highest precedence, from the defaults,
+// the config file, PDFSEARCH_* environment variables and command line flags.
+// The toml tag of a field is its key in the config file. Its environment
+// variable is the key in upper case with the PDFSEARCH_ prefix,
+// e.g. cache_dir is set by PDFSEARCH_CACHE_DIR.
 type Config struct {
 	// the directory to index
-	Directory string
+	Directory string `toml:"directory"`
 
 	// Bulk file upload(faster but errors on duplicates).
 	// Otherwise, use the slow, one-by-one way(ignores duplicates)
-	Once bool
+	Once bool `toml:"once"`
 
 	// Number of workers to use when processing pdfs. Default is 2.
-	NumWorkers int
+	NumWorkers int `toml:"workers"`
+
+	// Also populate the trigram index used for substring searches.
+	Trigram bool `toml:"trigram"`
 
 	// server port. default is 8080
-	Port int
+	Port int `toml:"port"`
+
+	// Address the server listens on, e.g. 127.0.0.1. Empty listens on all interfaces.
+	Host string `toml:"host"`
+
+	// Certificate and private key in PEM files to serve over HTTPS.
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+
+	// Serve over HTTPS with a self-signed certificate generated on first
+	// use, for LAN use. Ignored if TLSCert is set.
+	TLSSelfSigned bool `toml:"tls_self_signed"`
+
+	// Port of a plain HTTP listener redirecting to HTTPS. 0 disables it.
+	RedirectPort int `toml:"redirect_port"`
+
+	// Listen on this Unix socket instead of Host and Port, e.g. behind a
+	// local reverse proxy.
+	Socket string `toml:"socket"`
+
+	// Path to the sqlite3 database.
+	Database string `toml:"database"`
+
+	// Directory for the pages generated from pdfs.
+	CacheDir string `toml:"cache_dir"`
+
+	// Path to the synonyms dictionary used to expand queries.
+	SynonymsFile string `toml:"synonyms_file"`
+
+	// Hours between optimizations of the index while the server is idle.
+	// 0 disables them.
+	OptimizeInterval int `toml:"optimize_interval"`
+
+	// Directory of the backups created by the backup command and /admin/backup.
+	BackupDir string `toml:"backup_dir"`
+
+	// Number of backups kept in BackupDir. 0 keeps them all.
+	BackupKeep int `toml:"backup_keep"`
+
+	// Compress the backups with gzip.
+	BackupCompress bool `toml:"backup_compress"`
+
+	// Command template of the PDF viewer, e.g. "zathura -P {page} {path}".
+	// Empty detects the viewer.
+	Viewer string `toml:"viewer"`
+
+	// Record the searches of the web interface for /admin/analytics.
+	LogQueries bool `toml:"log_queries"`
+
+	// Days the logged searches are kept. 0 keeps them forever.
+	QueryLogRetention int `toml:"query_log_retention"`
+
+	// Require users to log in to serve. Create them with the user command.
+	Auth bool `toml:"auth"`
+
+	// Hours a login lasts.
+	SessionHours int `toml:"session_hours"`
+
+	// The fields below are arguments of a single command, not settings.
+
+	// Synonym group to add to the dictionary, as a comma separated list of terms.
+	AddSynonyms string `toml:"-"`
+
+	// Term to remove from the synonyms dictionary.
+	RemoveSynonym string `toml:"-"`
+
+	// Schema version to migrate to. 0 migrates to the latest version.
+	MigrateTo int `toml:"-"`
+
+	// Print the applied and pending migrations instead of migrating.
+	MigrateStatus bool `toml:"-"`
+
+	// Library root the paths of an exported or imported archive are relative to.
+	ArchiveRoot string `toml:"-"`
+
+	// Import files without checking that their content matches the archive.
+	SkipVerify bool `toml:"-"`
+
+	// Book to search, by ID or file name.
+	SearchBook string `toml:"-"`
+
+	// Maximum number of search results printed. 0 prints them all.
+	SearchLimit int `toml:"-"`
+
+	// Output format of the search results: text, json or csv.
+	SearchFormat string `toml:"-"`
+
+	// Search the exact terms, without expanding synonyms.
+	Exact bool `toml:"-"`
+
+	// Only search the files in this language.
+	SearchLanguage string `toml:"-"`
+
+	// Search mode of a saved search: fulltext or substring.
+	SearchMode string `toml:"-"`
+
+	// Mark the new matches of the saved searches as seen once printed.
+	MarkSeen bool `toml:"-"`
+
+	// Name of the user whose saved searches are managed. Empty for the
+	// searches saved without authentication.
+	SavedSearchUser string `toml:"-"`
+
+	// Only list the files whose name matches this glob or contains this text.
+	ListName string `toml:"-"`
+
+	// Only list the files in this language.
+	ListLanguage string `toml:"-"`
+
+	// Order of the listed files: name, pages or date.
+	ListSort string `toml:"-"`
+
+	// Print the files that would be removed without removing them.
+	DryRun bool `toml:"-"`
+
+	// Pages to extract, numbered from 1, e.g. 120-134,140.
+	ExtractPages string `toml:"-"`
+
+	// Output file of the extract command.
+	Output string `toml:"-"`
+
+	// Only export the searches of the query log made in the last days. 0 exports them all.
+	ExportDays int `toml:"-"`
+
+	// Output format of the exported query log: json or csv.
+	ExportFormat string `toml:"-"`
+
+	// Give the admin role to the user created or changed by the user command.
+	Admin bool `toml:"-"`
+
+	// Restrict the documents of the collection added by the collection command.
+	Restricted bool `toml:"-"`
+
+	// Where each setting was read from, by key. Set by LoadConfig.
+	sources map[string]Source
+
+	// The settings before the command line flags were parsed.
+	beforeFlags *Config
 }
 
+// Where the value of a setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "config file"
+	SourceEnv     Source = "environment"
+	SourceFlag    Source = "flag"
+)
+
+// Prefix of the environment variables of the settings.
+const envPrefix = "PDFSEARCH_"
+
 var DefaultConfig = Config{
-	Port:       8080,
-	Once:       true,
-	NumWorkers: 2,
+	Port:         8080,
+	Once:         true,
+	NumWorkers:   2,
+	Database:     filepath.Join(dataDir(), "pdfsearch", "pdfsearch.db"),
+	CacheDir:     filepath.Join(cacheDir(), "pdfsearch"),
+	SynonymsFile: filepath.Join(configDir(), "pdfsearch", "synonyms.txt"),
+
+	BackupDir:      filepath.Join(dataDir(), "pdfsearch", "backups"),
+	BackupKeep:     7,
+	BackupCompress: true,
+
+	QueryLogRetention: 90,
+	SessionHours:      7 * 24,
+
+	SearchLimit:  20,
+	SearchFormat: FormatText,
+	ExportFormat: FormatCSV,
+	ListSort:     SortName,
+}
+
+// BackupOptions returns the options of the backups.
+func (config *Config) BackupOptions() database.BackupOptions {
+	return database.BackupOptions{
+		Dir:      config.BackupDir,
+		Keep:     config.BackupKeep,
+		Compress: config.BackupCompress,
+	}
+}
+
+// QueryLogOptions returns the options of the query log.
+func (config *Config) QueryLogOptions() database.QueryLogOptions {
+	return database.QueryLogOptions{
+		Enabled:   config.LogQueries,
+		Retention: config.QueryLogRetention,
+	}
+}
+
+// TLSFiles returns the certificate and key files served over HTTPS: the
+// configured ones, or the self-signed ones kept in the data directory.
+// They are empty if TLS is disabled.
+func (config *Config) TLSFiles() (cert, key string) {
+	if config.TLSCert != "" || !config.TLSSelfSigned {
+		return config.TLSCert, config.TLSKey
+	}
+
+	dir := filepath.Join(dataDir(), "pdfsearch", "tls")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// DocumentViewer returns the viewer that opens documents at a page.
+func (config *Config) DocumentViewer() viewer.Viewer {
+	return viewer.Viewer{Command: config.Viewer}
+}
+
+// ConfigFile returns the path to the config file: $PDFSEARCH_CONFIG if set,
+// otherwise pdfsearch/config.toml in the user's config directory
+// ($XDG_CONFIG_HOME or ~/.config on Linux).
+func ConfigFile() string {
+	if path := os.Getenv(envPrefix + "CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(configDir(), "pdfsearch", "config.toml")
+}
+
+// LoadConfig overrides the settings of config with those of the config file
+// and of the environment. A missing config file is not an error.
+// Call it before parsing the command line flags.
+func LoadConfig(config *Config) error {
+	config.sources = make(map[string]Source)
+	for _, key := range settingKeys() {
+		config.sources[key] = SourceDefault
+	}
+
+	path := ConfigFile()
+	meta, err := toml.DecodeFile(path, config)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read config file %s: %w", path, err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown settings in %s: %v", path, undecoded)
+	}
+
+	for _, key := range meta.Keys() {
+		config.sources[key.String()] = SourceFile
+	}
+
+	err = loadEnv(config)
+	if err != nil {
+		return err
+	}
+
+	beforeFlags := *config
+	config.beforeFlags = &beforeFlags
+	return nil
+}
+
+// Override the settings with the PDFSEARCH_* environment variables.
+func loadEnv(config *Config) error {
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get("toml")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		name := envPrefix + strings.ToUpper(key)
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := value.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(env)
+		case reflect.Int:
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return fmt.Errorf("invalid integer for %s: %q", name, env)
+			}
+			field.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(env)
+			if err != nil {
+				return fmt.Errorf("invalid boolean for %s: %q", name, env)
+			}
+			field.SetBool(b)
+		}
+		config.sources[key] = SourceEnv
+	}
+	return nil
+}
+
+// Write the settings of config in the config file format, each followed by
+// a comment saying where its value comes from.
+func (config *Config) Show(w io.Writer) error {
+	fmt.Fprintf(w, "# Config file: %s\n", ConfigFile())
+
+	value := reflect.ValueOf(config).Elem()
+	var before reflect.Value
+	if config.beforeFlags != nil {
+		before = reflect.ValueOf(config.beforeFlags).Elem()
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get("toml")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		source := config.sources[key]
+		if source == "" {
+			source = SourceDefault
+		}
+
+		if before.IsValid() && !value.Field(i).Equal(before.Field(i)) {
+			source = SourceFlag
+		}
+
+		setting, err := toml.Marshal(map[string]any{key: value.Field(i).Interface()})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%-60s # %s\n", strings.TrimSpace(string(setting)), source)
+	}
+	return nil
+}
+
+// Keys of the settings that can be set in the config file.
+func settingKeys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("toml")
+		if key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// The user's config directory, e.g. ~/.config on Linux.
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+// The user's cache directory, e.g. ~/.cache on Linux.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return os.TempDir()
+	}
+	return dir
+}
+
+// The user's data directory: $XDG_DATA_HOME or ~/.local/share on Unix.
+// Windows and macOS have no separate data directory, the config one is used.
+func dataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return configDir()
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(home, ".local", "share")
 }
@@ -1,38 +1,493 @@
 package cli
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/abiiranathan/goflag"
+	"github.com/abiiranathan/pdfsearch/archive"
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/saved"
 	"github.com/abiiranathan/pdfsearch/search"
+	"github.com/abiiranathan/pdfsearch/synonyms"
 )
 
-func DefineFlags(config *Config, runserver func()) *goflag.Context {
+func DefineFlags(config *Config, runserver func(store *database.Store)) *goflag.Context {
 	// Create flag context.
 	ctx := goflag.NewContext()
 
 	// build_index subcommand
-	buildCmd := ctx.AddSubCommand("build_index", "Build a file index for a specified folder", serializeHandler(config))
+	buildCmd := ctx.AddSubCommand("build_index", "Build a file index for a specified folder", withDatabase(config, serializeHandler(config)))
 	buildCmd.AddFlag(goflag.FlagDirPath, "directory", "d", &config.Directory, "The directory to index", true)
 	buildCmd.AddFlag(goflag.FlagBool, "once", "o", &config.Once,
 		"Bulk file upload(faster but errors on duplicates). Otherwise, use the slow, one-by-one way(ignores duplicates)", false)
 	buildCmd.AddFlag(goflag.FlagInt, "workers", "w", &config.NumWorkers,
 		"Number of workers to use when processing pdfs", false)
+	buildCmd.AddFlag(goflag.FlagBool, "trigram", "t", &config.Trigram,
+		"Also build the trigram index for substring searches(needs about 3x more disk space)", false)
+	buildCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
 
 	// Server subcommand
-	srv := ctx.AddSubCommand("serve", "Start an Http server for search", runserver)
+	srv := ctx.AddSubCommand("serve", "Start an Http server for search", requireDatabase(config, withDatabase(config, runserver)))
 	srv.AddFlag(goflag.FlagInt, "port", "p", &config.Port, "The port to run the server on", false)
+	srv.AddFlag(goflag.FlagString, "host", "", &config.Host, "The address to listen on, e.g. 127.0.0.1. Defaults to all interfaces", false)
+	srv.AddFlag(goflag.FlagString, "tls-cert", "", &config.TLSCert, "Certificate PEM file to serve over HTTPS", false)
+	srv.AddFlag(goflag.FlagString, "tls-key", "", &config.TLSKey, "Private key PEM file of the certificate", false)
+	srv.AddFlag(goflag.FlagBool, "tls-self-signed", "", &config.TLSSelfSigned,
+		"Serve over HTTPS with a generated self-signed certificate, for LAN use", false)
+	srv.AddFlag(goflag.FlagInt, "redirect-port", "", &config.RedirectPort,
+		"Port of a plain HTTP listener redirecting to HTTPS, e.g. 80. 0 disables it", false)
+	srv.AddFlag(goflag.FlagString, "socket", "", &config.Socket, "Listen on this Unix socket instead, e.g. behind a reverse proxy", false)
+	srv.AddFlag(goflag.FlagString, "synonyms", "s", &config.SynonymsFile, "The synonyms dictionary used to expand queries", false)
+	srv.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+	srv.AddFlag(goflag.FlagString, "cache-dir", "", &config.CacheDir, "Directory for the pages generated from pdfs", false)
+	srv.AddFlag(goflag.FlagInt, "optimize-interval", "", &config.OptimizeInterval,
+		"Hours between optimizations of the index while the server is idle. 0 disables them", false)
+	srv.AddFlag(goflag.FlagString, "viewer", "", &config.Viewer, "PDF viewer command, e.g. \"zathura -P {page} {path}\"", false)
+	srv.AddFlag(goflag.FlagBool, "auth", "", &config.Auth, "Require users to log in. Create them with the user command", false)
+	srv.AddFlag(goflag.FlagInt, "session-hours", "", &config.SessionHours, "Hours a login lasts", false)
+	srv.AddFlag(goflag.FlagBool, "log-queries", "", &config.LogQueries, "Record the searches for /admin/analytics", false)
+	srv.AddFlag(goflag.FlagInt, "query-log-retention", "", &config.QueryLogRetention,
+		"Days the logged searches are kept. 0 keeps them forever", false)
+
+	// Search subcommand
+	searchCmd := ctx.AddSubCommand("search", "Search the index from the terminal: search \"query\"",
+		requireDatabase(config, withDatabase(config, searchHandler(config))))
+	searchCmd.AddFlag(goflag.FlagString, "book", "b", &config.SearchBook, "Only search the book with this ID or file name", false)
+	searchCmd.AddFlag(goflag.FlagInt, "limit", "l", &config.SearchLimit, "Maximum number of results. 0 prints them all", false)
+	searchCmd.AddFlag(goflag.FlagString, "format", "f", &config.SearchFormat, "Output format: text, json or csv", false,
+		goflag.Choices([]string{FormatText, FormatJSON, FormatCSV}))
+	searchCmd.AddFlag(goflag.FlagBool, "exact", "e", &config.Exact, "Search the exact terms, without expanding synonyms", false)
+	searchCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Saved searches subcommand
+	savedCmd := ctx.AddSubCommand("saved-search", "Manage the saved searches: saved-search list|add <name> <query>|remove <name>|check [name]",
+		requireDatabase(config, withDatabase(config, savedSearchHandler(config))))
+	savedCmd.AddFlag(goflag.FlagString, "book", "b", &config.SearchBook, "Only search the book with this ID or file name", false)
+	savedCmd.AddFlag(goflag.FlagString, "lang", "l", &config.SearchLanguage, "Only search files in this language, e.g. fr", false)
+	savedCmd.AddFlag(goflag.FlagString, "mode", "m", &config.SearchMode, "Search mode: fulltext or substring", false,
+		goflag.Choices([]string{saved.ModeFullText, saved.ModeSubstring}))
+	savedCmd.AddFlag(goflag.FlagBool, "exact", "e", &config.Exact, "Search the exact terms, without expanding synonyms", false)
+	savedCmd.AddFlag(goflag.FlagBool, "mark-seen", "", &config.MarkSeen, "Mark the new matches printed by check as seen", false)
+	savedCmd.AddFlag(goflag.FlagString, "user", "u", &config.SavedSearchUser,
+		"Manage the saved searches of this user instead of those saved without authentication", false)
+	savedCmd.AddFlag(goflag.FlagString, "synonyms", "s", &config.SynonymsFile, "The synonyms dictionary used to expand queries", false)
+	savedCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Library subcommands
+	listCmd := ctx.AddSubCommand("list", "List the indexed files", requireDatabase(config, withDatabase(config, listHandler(config))))
+	listCmd.AddFlag(goflag.FlagString, "name", "n", &config.ListName, "Only list files whose name matches this glob or contains this text", false)
+	listCmd.AddFlag(goflag.FlagString, "lang", "l", &config.ListLanguage, "Only list files in this language, e.g. fr", false)
+	listCmd.AddFlag(goflag.FlagString, "sort", "s", &config.ListSort, "Sort by name, pages or date", false,
+		goflag.Choices([]string{SortName, SortPages, SortDate}))
+	listCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	infoCmd := ctx.AddSubCommand("info", "Show the metadata of a file: info <id|path>", requireDatabase(config, withDatabase(config, infoHandler)))
+	infoCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	removeCmd := ctx.AddSubCommand("remove", "Remove files from the index: remove <id|path|glob>...",
+		requireDatabase(config, withDatabase(config, removeHandler(config))))
+	removeCmd.AddFlag(goflag.FlagBool, "dry-run", "", &config.DryRun, "Print the files that would be removed without removing them", false)
+	removeCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	tuiCmd := ctx.AddSubCommand("tui", "Search the index interactively in the terminal",
+		requireDatabase(config, withDatabase(config, tuiHandler(config))))
+	tuiCmd.AddFlag(goflag.FlagString, "viewer", "", &config.Viewer, "PDF viewer command, e.g. \"zathura -P {page} {path}\"", false)
+	tuiCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	extractCmd := ctx.AddSubCommand("extract", "Extract pages of a file to a pdf: extract <id|path> --pages 120-134,140",
+		requireDatabase(config, withDatabase(config, extractHandler(config))))
+	extractCmd.AddFlag(goflag.FlagString, "pages", "p", &config.ExtractPages, "Pages to extract, numbered from 1, e.g. 120-134,140", true)
+	extractCmd.AddFlag(goflag.FlagString, "output", "o", &config.Output, "Output pdf. Defaults to <name>-pages-<pages>.pdf", false)
+	extractCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Query log subcommand
+	analyticsCmd := ctx.AddSubCommand("analytics", "Export or prune the query log: analytics export|prune",
+		requireDatabase(config, withDatabase(config, analyticsHandler(config))))
+	analyticsCmd.AddFlag(goflag.FlagString, "format", "f", &config.ExportFormat, "Output format of export: json or csv", false,
+		goflag.Choices([]string{FormatJSON, FormatCSV}))
+	analyticsCmd.AddFlag(goflag.FlagInt, "days", "", &config.ExportDays, "Only export the searches of the last days. 0 exports them all", false)
+	analyticsCmd.AddFlag(goflag.FlagString, "output", "o", &config.Output, "Output file of export. Defaults to the standard output", false)
+	analyticsCmd.AddFlag(goflag.FlagInt, "query-log-retention", "", &config.QueryLogRetention,
+		"Days the logged searches are kept by prune", false)
+	analyticsCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Users subcommand
+	userCmd := ctx.AddSubCommand("user",
+		"Manage the users: user list|add <name>|remove <name>|passwd <name>|role <name> user|admin|token <name> <token name>|tokens <name>|revoke <name> <token id>",
+		requireDatabase(config, withDatabase(config, userHandler(config))))
+	userCmd.AddFlag(goflag.FlagBool, "admin", "", &config.Admin, "Give the admin role to the added user", false)
+	userCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Collections subcommand
+	collectionCmd := ctx.AddSubCommand("collection",
+		"Manage the collections and who may access them: collection list|add <name>|remove <name>|show <name>|"+
+			"restrict <name>|unrestrict <name>|include <name> <id|path|glob>...|exclude <name> <id|path|glob>...|"+
+			"grant <name> user|group <name>|revoke <name> user|group <name>",
+		requireDatabase(config, withDatabase(config, collectionHandler(config))))
+	collectionCmd.AddFlag(goflag.FlagBool, "restricted", "", &config.Restricted,
+		"Restrict the documents of the added collection to the users granted access", false)
+	collectionCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Groups subcommand
+	groupCmd := ctx.AddSubCommand("group",
+		"Manage the groups of users: group list|add <name>|remove <name>|members <name>|join <name> <user>|leave <name> <user>",
+		requireDatabase(config, withDatabase(config, groupHandler)))
+	groupCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Synonyms subcommand
+	synonymsCmd := ctx.AddSubCommand("synonyms", "List and edit the synonyms dictionary", synonymsHandler(config))
+	synonymsCmd.AddFlag(goflag.FlagString, "file", "f", &config.SynonymsFile, "The synonyms dictionary", false)
+	synonymsCmd.AddFlag(goflag.FlagString, "add", "a", &config.AddSynonyms,
+		"Comma separated terms to add as a synonym group. e.g \"MI,myocardial infarction\"", false)
+	synonymsCmd.AddFlag(goflag.FlagString, "remove", "r", &config.RemoveSynonym, "Term to remove from the dictionary", false)
+
+	// Migrate subcommand
+	migrateCmd := ctx.AddSubCommand("migrate", "Apply pending database schema migrations", migrateHandler(config))
+	migrateCmd.AddFlag(goflag.FlagInt, "to", "t", &config.MigrateTo, "The schema version to migrate to. 0 is the latest", false)
+	migrateCmd.AddFlag(goflag.FlagBool, "status", "s", &config.MigrateStatus, "Print the applied and pending migrations and exit", false)
+	migrateCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Database maintenance subcommand
+	dbCmd := ctx.AddSubCommand("db", "Maintain the database: db optimize|vacuum|check|stats", requireDatabase(config, withDatabase(config, dbHandler)))
+	dbCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Export and import subcommands
+	exportCmd := ctx.AddSubCommand("export", "Export the index to a portable archive: export library.zip", requireDatabase(config, withDatabase(config, exportHandler(config))))
+	exportCmd.AddFlag(goflag.FlagString, "root", "r", &config.ArchiveRoot,
+		"Library root the paths are made relative to. Defaults to the directory containing every file", false)
+	exportCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	importCmd := ctx.AddSubCommand("import", "Import an exported archive: import library.zip --root /mnt/library", withDatabase(config, importHandler(config)))
+	importCmd.AddFlag(goflag.FlagString, "root", "r", &config.ArchiveRoot, "Library root on this machine", true)
+	importCmd.AddFlag(goflag.FlagBool, "skip-verify", "", &config.SkipVerify,
+		"Import files without checking that they exist and match the exported ones", false)
+	importCmd.AddFlag(goflag.FlagBool, "trigram", "t", &config.Trigram, "Also add the imported pages to the trigram index", false)
+	importCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Backup and restore subcommands
+	backupCmd := ctx.AddSubCommand("backup", "Back up the database, even while it is being served", requireDatabase(config, withDatabase(config, backupHandler(config))))
+	backupCmd.AddFlag(goflag.FlagString, "dir", "", &config.BackupDir, "Directory of the backups", false)
+	backupCmd.AddFlag(goflag.FlagInt, "keep", "k", &config.BackupKeep, "Number of backups to keep. 0 keeps them all", false)
+	backupCmd.AddFlag(goflag.FlagBool, "compress", "c", &config.BackupCompress, "Compress the backup with gzip", false)
+	backupCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	restoreCmd := ctx.AddSubCommand("restore", "Replace the database with a backup: restore backup.db.gz", withDatabase(config, restoreHandler))
+	restoreCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+
+	// Config subcommand
+	configCmd := ctx.AddSubCommand("config", "Print the effective configuration: config show", configHandler(config))
+	configCmd.AddFlag(goflag.FlagString, "db", "", &config.Database, "Path to the sqlite3 database", false)
+	configCmd.AddFlag(goflag.FlagString, "cache-dir", "", &config.CacheDir, "Directory for the pages generated from pdfs", false)
 
 	return ctx
 }
 
-func serializeHandler(config *Config) func() {
+// Connect to the database and apply the pending migrations before running handler.
+// The database is created if it does not exist.
+func withDatabase(config *Config, handler func(store *database.Store)) func() {
+	return func() {
+		store := connect(config)
+		defer store.Close()
+
+		if err := store.Migrate(context.Background(), 0); err != nil {
+			log.Fatalf("unable to migrate database: %v\n", err)
+		}
+		handler(store)
+	}
+}
+
+// Refuse to run handler if the database does not exist, instead of
+// silently creating an empty one.
+func requireDatabase(config *Config, handler func()) func() {
+	return func() {
+		if _, err := os.Stat(config.Database); err == nil {
+			handler()
+			return
+		}
+
+		msg := fmt.Sprintf("database %s does not exist. Run the `build_index` command to create it", config.Database)
+		if abs, err := filepath.Abs(legacyDatabase); err == nil && abs != config.Database {
+			if _, err := os.Stat(legacyDatabase); err == nil {
+				msg += fmt.Sprintf(" or pass --db %s to use the one in the current directory", abs)
+			}
+		}
+		// Not 1, which means no match for the search command.
+		log.Println(msg)
+		os.Exit(exitError)
+	}
+}
+
+// Location of the database before it was configurable, relative to
+// the current directory.
+const legacyDatabase = "pdfsearch.db"
+
+// Create the directory of the database and connect to it.
+func connect(config *Config) *database.Store {
+	err := os.MkdirAll(filepath.Dir(config.Database), 0755)
+	if err != nil {
+		log.Fatalf("unable to create database directory: %v\n", err)
+	}
+
+	store, err := database.Open(config.Database)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return store
+}
+
+func configHandler(config *Config) func() {
 	return func() {
-		err := search.Serialize(config.Directory, config.Once, config.NumWorkers)
+		args := positionalArgs("config")
+		if len(args) != 1 || args[0] != "show" {
+			log.Fatalln("usage: pdfsearch config show")
+		}
+
+		if err := config.Show(os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+// Positional arguments of the subcommand name: the arguments that follow it
+// up to the first flag, e.g. "show" in `pdfsearch config show --db x.db`.
+func positionalArgs(name string) []string {
+	args := []string{}
+	for i, arg := range os.Args {
+		if arg != name {
+			continue
+		}
+
+		for _, arg := range os.Args[i+1:] {
+			if strings.HasPrefix(arg, "-") {
+				break
+			}
+			args = append(args, arg)
+		}
+		break
+	}
+	return args
+}
+
+// Run the database maintenance command given as positional argument.
+func dbHandler(store *database.Store) {
+	ctx := context.Background()
+	args := positionalArgs("db")
+	if len(args) != 1 {
+		log.Fatalln("usage: pdfsearch db optimize|vacuum|check|stats")
+	}
+
+	switch args[0] {
+	case "optimize":
+		if err := store.Optimize(ctx); err != nil {
+			log.Fatalf("unable to optimize database: %v\n", err)
+		}
+		log.Println("Database optimized")
+	case "vacuum":
+		if err := store.Vacuum(ctx); err != nil {
+			log.Fatalf("unable to vacuum database: %v\n", err)
+		}
+		log.Println("Database vacuumed")
+	case "check":
+		problems, err := store.Check(ctx)
+		if err != nil {
+			log.Fatalf("unable to check database: %v\n", err)
+		}
+
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("ok")
+	case "stats":
+		stats, err := store.Stats(ctx)
+		if err != nil {
+			log.Fatalf("unable to get database stats: %v\n", err)
+		}
+		printStats(stats)
+	default:
+		log.Fatalf("unknown db command %q: expected optimize, vacuum, check or stats\n", args[0])
+	}
+}
+
+func printStats(stats database.Stats) {
+	fmt.Printf("Documents:   %d\n", stats.Documents)
+	fmt.Printf("Pages:       %d\n", stats.Pages)
+	fmt.Printf("Tokens:      %d\n", stats.Tokens)
+	fmt.Printf("Terms:       %d\n", stats.Terms)
+	fmt.Printf("Index size:  %s (%s free, reclaimed by `db vacuum`)\n", formatBytes(stats.Size), formatBytes(stats.FreeSize))
+
+	if len(stats.LargestBooks) == 0 {
+		return
+	}
+
+	fmt.Println("Largest books:")
+	for _, book := range stats.LargestBooks {
+		fmt.Printf("  %6d pages %10d chars  %s\n", book.Pages, book.Characters, book.Name)
+	}
+}
+
+// Format a size in bytes with a binary unit, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func exportHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		args := positionalArgs("export")
+		if len(args) != 1 {
+			log.Fatalln("usage: pdfsearch export <archive> [--root dir]")
+		}
+
+		manifest, err := archive.Export(context.Background(), store, args[0], config.ArchiveRoot)
+		if err != nil {
+			log.Fatalf("unable to export index: %v\n", err)
+		}
+		log.Printf("Exported %d files and %d pages relative to %s into %s\n",
+			manifest.Files, manifest.Pages, manifest.Root, args[0])
+	}
+}
+
+func importHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		args := positionalArgs("import")
+		if len(args) != 1 {
+			log.Fatalln("usage: pdfsearch import <archive> --root dir")
+		}
+
+		result, err := archive.Import(ctx, store, args[0], archive.ImportOptions{
+			Root:       config.ArchiveRoot,
+			SkipVerify: config.SkipVerify,
+		})
+		if err != nil {
+			log.Fatalf("unable to import index: %v\n", err)
+		}
+
+		log.Printf("Imported %d files and %d pages. %d files were already indexed, %d skipped\n",
+			result.Files, result.Pages, result.Existing, len(result.Skipped))
+
+		if result.Files == 0 {
+			return
+		}
+
+		if config.Trigram {
+			if err := store.UpdateTrigramIndex(ctx); err != nil {
+				log.Fatalf("unable to build trigram index: %v\n", err)
+			}
+		}
+
+		checkSavedSearches(config, store)
+	}
+}
+
+func backupHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		backup, err := store.BackupTo(context.Background(), config.BackupOptions())
+		if err != nil {
+			log.Fatalf("unable to back up database: %v\n", err)
+		}
+		log.Printf("Backed up %s to %s [%s]\n", config.Database, backup.Path, formatBytes(backup.Size))
+	}
+}
+
+// Restore the backup given as positional argument, then migrate it
+// to the latest schema.
+func restoreHandler(store *database.Store) {
+	ctx := context.Background()
+	args := positionalArgs("restore")
+	if len(args) != 1 {
+		log.Fatalln("usage: pdfsearch restore <backup>")
+	}
+
+	version, err := store.Restore(ctx, args[0])
+	if err != nil {
+		log.Fatalf("unable to restore backup: %v\n", err)
+	}
+
+	if err := store.Migrate(ctx, 0); err != nil {
+		log.Fatalf("unable to migrate database: %v\n", err)
+	}
+	log.Printf("Restored %s (schema version %d)\n", args[0], version)
+}
+
+func migrateHandler(config *Config) func() {
+	return func() {
+		ctx := context.Background()
+		store := connect(config)
+		defer store.Close()
+
+		if !config.MigrateStatus {
+			if err := store.Migrate(ctx, config.MigrateTo); err != nil {
+				log.Fatalf("unable to migrate database: %v\n", err)
+			}
+		}
+
+		statuses, err := store.GetMigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("unable to get migration status: %v\n", err)
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt
+			}
+			fmt.Printf("%04d  %-30s %s\n", status.Version, status.Name, state)
+		}
+	}
+}
+
+func synonymsHandler(config *Config) func() {
+	return func() {
+		dict, err := synonyms.Load(config.SynonymsFile)
+		if err != nil {
+			log.Fatalf("unable to load synonyms: %v\n", err)
+		}
+
+		if config.AddSynonyms != "" || config.RemoveSynonym != "" {
+			if config.AddSynonyms != "" {
+				if err := dict.Add(config.AddSynonyms); err != nil {
+					log.Fatalln(err)
+				}
+			}
+
+			if config.RemoveSynonym != "" && !dict.Remove(config.RemoveSynonym) {
+				log.Fatalf("%q is not in the synonyms dictionary\n", config.RemoveSynonym)
+			}
+
+			if err := dict.Save(config.SynonymsFile); err != nil {
+				log.Fatalf("unable to save synonyms: %v\n", err)
+			}
+		}
+
+		fmt.Print(dict.String())
+	}
+}
+
+func serializeHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		err := search.Serialize(store, config.Directory, config.Once, config.NumWorkers, config.Trigram)
 		if err != nil {
 			log.Fatalf("unable to serialize files: %v\n", err)
 		}
+		checkSavedSearches(config, store)
 	}
 }
 
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/language"
+	"github.com/abiiranathan/pdfsearch/pdf"
+	"github.com/abiiranathan/pdfsearch/tui"
+)
+
+// Sort orders of the list command.
+const (
+	SortName  = "name"  // Alphabetical
+	SortPages = "pages" // Most pages first
+	SortDate  = "date"  // Most recently indexed first
+)
+
+// List the indexed files matching the filters of config.
+func listHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		files, err := store.GetFileStats(context.Background())
+		if err != nil {
+			log.Fatalf("unable to list files: %v\n", err)
+		}
+
+		// A name without wildcards matches the names containing it.
+		name := config.ListName
+		if name != "" && !strings.ContainsAny(name, "*?[") {
+			name = "*" + name + "*"
+		}
+
+		filtered := []database.FileStats{}
+		for _, file := range files {
+			if config.ListLanguage != "" && file.Language != config.ListLanguage {
+				continue
+			}
+
+			if name != "" && !matchName(name, file.File) {
+				continue
+			}
+			filtered = append(filtered, file)
+		}
+
+		sortFiles(filtered, config.ListSort)
+
+		fmt.Printf("%10s %6s %-4s %-19s %s\n", "ID", "PAGES", "LANG", "INDEXED", "NAME")
+		for _, file := range filtered {
+			fmt.Printf("%10d %6d %-4s %-19s %s\n", file.ID, file.Pages, file.Language, orUnknown(file.IndexedAt), file.Name)
+		}
+	}
+}
+
+// Sort files in place by name, pages or date.
+func sortFiles(files []database.FileStats, by string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		switch by {
+		case SortPages:
+			return files[i].Pages > files[j].Pages
+		case SortDate:
+			return files[i].IndexedAt > files[j].IndexedAt
+		default:
+			return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
+		}
+	})
+}
+
+// Print the metadata and extraction statistics of the file given by ID or path.
+func infoHandler(store *database.Store) {
+	ctx := context.Background()
+	args := positionalArgs("info")
+	if len(args) != 1 {
+		log.Fatalln("usage: pdfsearch info <id|path>")
+	}
+
+	files, err := store.GetFileStats(ctx)
+	if err != nil {
+		log.Fatalf("unable to list files: %v\n", err)
+	}
+
+	matches := findFiles(files, args[0])
+	if len(matches) == 0 {
+		log.Fatalf("no file matches %q\n", args[0])
+	}
+
+	if len(matches) > 1 {
+		log.Fatalf("%q matches %d files, use the ID of one of them\n", args[0], len(matches))
+	}
+
+	file := matches[0]
+	fmt.Printf("ID:          %d\n", file.ID)
+	fmt.Printf("Name:        %s\n", file.Name)
+	fmt.Printf("Path:        %s\n", file.Path)
+	fmt.Printf("Language:    %s (%s)\n", language.Names[file.Language], file.Language)
+	fmt.Printf("Indexed at:  %s\n", orUnknown(file.IndexedAt))
+	fmt.Printf("Pages:       %d (%d without text)\n", file.Pages, file.EmptyPages)
+
+	perPage := 0
+	if file.Pages > 0 {
+		perPage = file.Characters / file.Pages
+	}
+	fmt.Printf("Characters:  %d (%d per page)\n", file.Characters, perPage)
+
+	if stat, err := os.Stat(file.Path); err == nil {
+		fmt.Printf("File size:   %s\n", formatBytes(stat.Size()))
+	} else {
+		fmt.Printf("File size:   missing (%v)\n", err)
+	}
+}
+
+// Remove the files given by ID, path or glob from the index.
+func removeHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		args := positionalArgs("remove")
+		if len(args) == 0 {
+			log.Fatalln("usage: pdfsearch remove <id|path|glob>...")
+		}
+
+		files, err := store.GetFileStats(ctx)
+		if err != nil {
+			log.Fatalf("unable to list files: %v\n", err)
+		}
+
+		ids := []int{}
+		seen := make(map[int]bool)
+		for _, arg := range args {
+			matches := findFiles(files, arg)
+			if len(matches) == 0 {
+				log.Printf("no file matches %q\n", arg)
+			}
+
+			for _, file := range matches {
+				if !seen[file.ID] {
+					seen[file.ID] = true
+					ids = append(ids, file.ID)
+					fmt.Printf("%10d %s\n", file.ID, file.Path)
+				}
+			}
+		}
+
+		if len(ids) == 0 {
+			os.Exit(1)
+		}
+
+		if config.DryRun {
+			log.Printf("Would remove %d files\n", len(ids))
+			return
+		}
+
+		if err := store.RemoveFiles(ctx, ids...); err != nil {
+			log.Fatalf("unable to remove files: %v\n", err)
+		}
+
+		log.Printf("Removed %d files\n", len(ids))
+	}
+}
+
+// Find the files given by ID, path or a glob on their path or name.
+func findFiles(files []database.FileStats, arg string) []database.FileStats {
+	id, err := strconv.Atoi(arg)
+	matches := []database.FileStats{}
+	for _, file := range files {
+		if (err == nil && file.ID == id) || file.Path == arg || matchName(arg, file.File) {
+			matches = append(matches, file)
+		}
+	}
+	return matches
+}
+
+// Reports whether the glob pattern matches the path or the name of file,
+// ignoring case.
+func matchName(pattern string, file database.File) bool {
+	pattern = strings.ToLower(pattern)
+	for _, name := range []string{file.Path, file.Name} {
+		matched, err := filepath.Match(pattern, strings.ToLower(name))
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// Run the interactive terminal interface.
+func tuiHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		if err := tui.Run(store, config.DocumentViewer()); err != nil {
+			log.Fatalf("unable to run the terminal interface: %v\n", err)
+		}
+	}
+}
+
+// Extract pages of the file given by ID or path to a pdf with a cover page.
+func extractHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		args := positionalArgs("extract")
+		if len(args) != 1 {
+			log.Fatalln("usage: pdfsearch extract <id|path> --pages 120-134,140 [--output extract.pdf]")
+		}
+
+		files, err := store.GetFileStats(context.Background())
+		if err != nil {
+			log.Fatalf("unable to list files: %v\n", err)
+		}
+
+		matches := findFiles(files, args[0])
+		if len(matches) == 0 {
+			log.Fatalf("no file matches %q\n", args[0])
+		}
+
+		if len(matches) > 1 {
+			log.Fatalf("%q matches %d files, use the ID of one of them\n", args[0], len(matches))
+		}
+
+		file := matches[0]
+		doc := pdf.Open(file.Path)
+		numPages := doc.NumPages
+		doc.Close()
+
+		pages, err := pdf.ParsePageRanges(config.ExtractPages, numPages)
+		if err != nil {
+			log.Fatalf("invalid pages: %v\n", err)
+		}
+
+		output := config.Output
+		if output == "" {
+			output = pdf.ExtractFileName(file.Name, pages)
+		}
+
+		cover := pdf.ExtractCover(file.Path, file.ID, pages, numPages)
+		if !pdf.ExtractPages(file.Path, pages, cover, output) {
+			log.Fatalf("unable to extract the pages of %s\n", file.Path)
+		}
+		log.Printf("Extracted pages %s of %s to %s\n", pdf.FormatPageRanges(pages), file.Name, output)
+	}
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+func TestFindFiles(t *testing.T) {
+	files := []database.FileStats{
+		{File: database.File{ID: 1, Name: "Cardiology.pdf", Path: "/books/heart/Cardiology.pdf"}},
+		{File: database.File{ID: 2, Name: "cardiac surgery.pdf", Path: "/books/heart/cardiac surgery.pdf"}},
+		{File: database.File{ID: 3, Name: "sepsis.pdf", Path: "/books/infections/sepsis.pdf"}},
+	}
+
+	tests := []struct {
+		arg      string
+		expected []int
+	}{
+		{"3", []int{3}},
+		{"/books/heart/Cardiology.pdf", []int{1}},
+		{"cardi*", []int{1, 2}},
+		{"/books/heart/*", []int{1, 2}},
+		{"*.PDF", []int{1, 2, 3}},
+		{"sepsis", nil},
+	}
+
+	for _, test := range tests {
+		matches := findFiles(files, test.arg)
+		if len(matches) != len(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.arg, test.expected, matches)
+			continue
+		}
+
+		for i, match := range matches {
+			if match.ID != test.expected[i] {
+				t.Errorf("%q: expected %v, got %v", test.arg, test.expected, matches)
+			}
+		}
+	}
+}
+
+func TestSortFiles(t *testing.T) {
+	files := []database.FileStats{
+		{File: database.File{ID: 1, Name: "b.pdf", IndexedAt: "2024-01-02 00:00:00"}, Pages: 10},
+		{File: database.File{ID: 2, Name: "A.pdf", IndexedAt: "2024-01-01 00:00:00"}, Pages: 30},
+		{File: database.File{ID: 3, Name: "c.pdf", IndexedAt: "2024-01-03 00:00:00"}, Pages: 20},
+	}
+
+	tests := map[string][]int{
+		SortName:  {2, 1, 3},
+		SortPages: {2, 3, 1},
+		SortDate:  {3, 1, 2},
+	}
+
+	for by, expected := range tests {
+		sortFiles(files, by)
+		for i, file := range files {
+			if file.ID != expected[i] {
+				t.Errorf("sort by %s: expected %v, got ID %d at %d", by, expected, file.ID, i)
+			}
+		}
+	}
+}
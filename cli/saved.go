@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/saved"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// Maximum number of new matches printed per saved search.
+const maxPrintedMatches = 200
+
+// Re-run the saved searches after an update of the index and log those
+// that match new pages.
+func checkSavedSearches(config *Config, store *database.Store) {
+	dict, err := synonyms.Load(config.SynonymsFile)
+	if err != nil {
+		log.Printf("unable to load synonyms, saved searches are not checked: %v\n", err)
+		return
+	}
+
+	results, err := saved.Check(context.Background(), store, dict)
+	if err != nil {
+		log.Printf("unable to check saved searches: %v\n", err)
+		return
+	}
+
+	for _, result := range results {
+		if result.New > 0 {
+			log.Printf("Saved search %q matched %d new pages\n", result.Search.Name, result.New)
+		}
+	}
+}
+
+// Manage the saved searches: saved-search list|add|remove|check.
+// check exits with status 0 if there are new matches, 1 otherwise, like search.
+func savedSearchHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		args := positionalArgs("saved-search")
+		if len(args) == 0 {
+			fail("usage: pdfsearch saved-search list|add <name> <query>|remove <name>|check [name]")
+		}
+
+		dict, err := synonyms.Load(config.SynonymsFile)
+		if err != nil {
+			fail(fmt.Sprintf("unable to load synonyms: %v", err))
+		}
+
+		// The searches saved without authentication, or those of --user.
+		owner := 0
+		if config.SavedSearchUser != "" {
+			owner = userByName(ctx, store, config.SavedSearchUser).ID
+		}
+
+		switch command := args[0]; {
+		case command == "list" && len(args) == 1:
+			searches, err := store.ListSavedSearches(ctx, owner)
+			if err != nil {
+				fail(err.Error())
+			}
+
+			for _, search := range searches {
+				fmt.Printf("%-20s %4d new  %s\n", search.Name, search.NewMatches, describeSavedSearch(search))
+			}
+		case command == "add" && len(args) == 3:
+			search := database.SavedSearch{
+				UserID:   owner,
+				Name:     args[1],
+				Query:    args[2],
+				Language: config.SearchLanguage,
+				Mode:     config.SearchMode,
+				Expand:   !config.Exact,
+			}
+
+			if config.SearchBook != "" {
+				search.Book, err = findBook(ctx, store, config.SearchBook)
+				if err != nil {
+					fail(err.Error())
+				}
+			}
+
+			search, err = saved.Save(ctx, store, dict, search)
+			if err != nil {
+				fail(err.Error())
+			}
+
+			matches, _ := store.SavedMatches(ctx, search.ID, maxPrintedMatches, false)
+			log.Printf("Saved search %q, matching %d pages now\n", search.Name, len(matches))
+		case command == "remove" && len(args) == 2:
+			search := savedSearchByName(ctx, store, owner, args[1])
+			if err := store.DeleteSavedSearch(ctx, owner, search.ID); err != nil {
+				fail(err.Error())
+			}
+			log.Printf("Removed saved search %q\n", search.Name)
+		case command == "check" && len(args) <= 2:
+			os.Exit(checkHandler(ctx, config, store, dict, owner, args[1:]))
+		default:
+			fail("usage: pdfsearch saved-search list|add <name> <query>|remove <name>|check [name]")
+		}
+	}
+}
+
+// Re-run the saved searches, then print the new matches of the saved search
+// of owner named by args, or of all their searches. Returns the exit status.
+func checkHandler(ctx context.Context, config *Config, store *database.Store, dict *synonyms.Dictionary,
+	owner int, args []string) int {
+	if _, err := saved.Check(ctx, store, dict); err != nil {
+		fail(err.Error())
+	}
+
+	searches, err := store.ListSavedSearches(ctx, owner)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	if len(args) == 1 {
+		searches = []database.SavedSearch{savedSearchByName(ctx, store, owner, args[0])}
+	}
+
+	found := false
+	for _, search := range searches {
+		if search.NewMatches == 0 {
+			continue
+		}
+
+		matches, err := store.SavedMatches(ctx, search.ID, maxPrintedMatches, true)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		results := make([]database.SearchResult, len(matches))
+		for i, match := range matches {
+			results[i] = database.SearchResult{FileID: match.FileID, PageNum: match.PageNum, Text: match.Snippet, BaseName: match.Name}
+		}
+
+		fmt.Printf("%s: %d new pages\n", search.Name, search.NewMatches)
+		if err := printResults(os.Stdout, results, FormatText, useColor(os.Stdout)); err != nil {
+			fail(err.Error())
+		}
+		found = true
+
+		if config.MarkSeen {
+			if err := store.MarkMatchesSeen(ctx, search.ID); err != nil {
+				fail(err.Error())
+			}
+		}
+	}
+
+	store.Close()
+	if !found {
+		return exitNoMatch
+	}
+	return exitMatch
+}
+
+// The saved search of owner named name. Fails if there is none.
+func savedSearchByName(ctx context.Context, store *database.Store, owner int, name string) database.SavedSearch {
+	search, err := store.GetSavedSearchByName(ctx, owner, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		fail(fmt.Sprintf("no saved search named %q", name))
+	}
+
+	if err != nil {
+		fail(err.Error())
+	}
+	return search
+}
+
+// The query and the filters of a saved search.
+func describeSavedSearch(search database.SavedSearch) string {
+	description := fmt.Sprintf("%q", search.Query)
+	if search.Mode == saved.ModeSubstring {
+		description += " substring"
+	}
+
+	if !search.Expand {
+		description += " exact"
+	}
+
+	if search.Language != "" {
+		description += " lang=" + search.Language
+	}
+
+	if search.Book != 0 {
+		description += fmt.Sprintf(" book=%d", search.Book)
+	}
+	return description
+}
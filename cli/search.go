@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// Output formats of the search command.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Exit statuses of the search command, the same as grep's.
+const (
+	exitMatch   = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+// ANSI escape sequences that replace the <b> tags of the snippets.
+const (
+	ansiBold  = "\x1b[1;31m"
+	ansiReset = "\x1b[0m"
+)
+
+// A search result as printed by the search command.
+type searchHit struct {
+	BookID  int    `json:"book_id"`
+	Book    string `json:"book"`
+	Page    int    `json:"page"` // Numbered from 1
+	Snippet string `json:"snippet"`
+}
+
+// Search the index from the command line. Exits with status 0 if
+// something matched, 1 if nothing did and 2 on errors, like grep.
+func searchHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		query := strings.Join(positionalArgs("search"), " ")
+		if query == "" {
+			fail("usage: pdfsearch search \"query\" [--book X] [--limit N] [--format text|json|csv]")
+		}
+
+		books := []int{}
+		if config.SearchBook != "" {
+			id, err := findBook(ctx, store, config.SearchBook)
+			if err != nil {
+				fail(err.Error())
+			}
+			books = append(books, id)
+		}
+
+		if !config.Exact {
+			dict, err := synonyms.Load(config.SynonymsFile)
+			if err != nil {
+				fail(fmt.Sprintf("unable to load synonyms: %v", err))
+			}
+			query = dict.Expand(query)
+		}
+
+		results, err := store.Search(ctx, query, books...)
+		if err != nil {
+			fail(fmt.Sprintf("invalid query %q: %v", query, err))
+		}
+
+		if config.SearchLimit > 0 && len(results) > config.SearchLimit {
+			results = results[:config.SearchLimit]
+		}
+
+		err = printResults(os.Stdout, results, config.SearchFormat, useColor(os.Stdout))
+		if err != nil {
+			fail(err.Error())
+		}
+
+		store.Close()
+		if len(results) == 0 {
+			os.Exit(exitNoMatch)
+		}
+		os.Exit(exitMatch)
+	}
+}
+
+// Print msg to stderr and exit with the error status.
+func fail(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(exitError)
+}
+
+// Find the ID of a book given by ID or by file name.
+func findBook(ctx context.Context, store *database.Store, book string) (int, error) {
+	if id, err := strconv.Atoi(book); err == nil {
+		return id, nil
+	}
+
+	files, err := store.GetFiles(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		if strings.EqualFold(file.Name, book) || file.Path == book {
+			return file.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no book named %q in the index", book)
+}
+
+// Highlight the matches of terminals. NO_COLOR disables it,
+// see https://no-color.org.
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Print results to w in format. Highlighted terms are wrapped in ANSI
+// escape sequences if color is true, plain otherwise.
+func printResults(w io.Writer, results []database.SearchResult, format string, color bool) error {
+	hits := make([]searchHit, len(results))
+	for i, result := range results {
+		hits[i] = searchHit{
+			BookID:  result.FileID,
+			Book:    result.BaseName,
+			Page:    result.PageNum + 1,
+			Snippet: formatSnippet(result.Text, color && format == FormatText),
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(hits)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"book_id", "book", "page", "snippet"})
+		for _, hit := range hits {
+			cw.Write([]string{strconv.Itoa(hit.BookID), hit.Book, strconv.Itoa(hit.Page), hit.Snippet})
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatText, "":
+		for _, hit := range hits {
+			_, err := fmt.Fprintf(w, "%s:%d: %s\n", hit.Book, hit.Page, hit.Snippet)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q: expected text, json or csv", format)
+	}
+}
+
+// Put the snippet on a single line and replace its <b> tags with ANSI
+// escape sequences, or remove them if color is false.
+func formatSnippet(snippet string, color bool) string {
+	open, close := "", ""
+	if color {
+		open, close = ansiBold, ansiReset
+	}
+
+	snippet = strings.NewReplacer("<b>", open, "</b>", close).Replace(snippet)
+	return strings.Join(strings.Fields(snippet), " ")
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+func TestFormatSnippet(t *testing.T) {
+	snippet := "acute <b>myocardial</b>\n<b>infarction</b>  is"
+
+	plain := formatSnippet(snippet, false)
+	if plain != "acute myocardial infarction is" {
+		t.Fatalf("unexpected plain snippet %q", plain)
+	}
+
+	colored := formatSnippet(snippet, true)
+	expected := "acute " + ansiBold + "myocardial" + ansiReset + " " + ansiBold + "infarction" + ansiReset + " is"
+	if colored != expected {
+		t.Fatalf("expected %q, got %q", expected, colored)
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	results := []database.SearchResult{
+		{FileID: 7, PageNum: 11, BaseName: "heart, lungs.pdf", Text: "<b>MI</b> treatment"},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{FormatText, "heart, lungs.pdf:12: MI treatment\n"},
+		{FormatCSV, "book_id,book,page,snippet\n7,\"heart, lungs.pdf\",12,MI treatment\n"},
+		{FormatJSON, `"page": 12`},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := printResults(&buf, results, test.format, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(buf.String(), test.expected) {
+			t.Errorf("%s: expected %q in %q", test.format, test.expected, buf.String())
+		}
+	}
+
+	if err := printResults(&bytes.Buffer{}, results, "xml", false); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"golang.org/x/term"
+)
+
+const userUsage = "usage: pdfsearch user list|add <name> [--admin]|remove <name>|passwd <name>|role <name> user|admin|" +
+	"token <name> <token name>|tokens <name>|revoke <name> <token id>"
+
+// Manage the users of the server and their API tokens. Passwords are read
+// from the terminal, or from the first line of the standard input if it is
+// not a terminal.
+func userHandler(config *Config) func(store *database.Store) {
+	return func(store *database.Store) {
+		ctx := context.Background()
+		args := positionalArgs("user")
+		if len(args) == 0 {
+			log.Fatalln(userUsage)
+		}
+
+		switch command := args[0]; {
+		case command == "list" && len(args) == 1:
+			users, err := store.ListUsers(ctx)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			for _, user := range users {
+				fmt.Printf("%-20s %-6s created %s\n", user.Name, user.Role, user.CreatedAt)
+			}
+		case command == "add" && len(args) == 2:
+			password, err := readPassword()
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			role := database.RoleUser
+			if config.Admin {
+				role = database.RoleAdmin
+			}
+
+			user, err := store.CreateUser(ctx, args[1], password, role)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("Created %s %s\n", user.Role, user.Name)
+		case command == "remove" && len(args) == 2:
+			user := userByName(ctx, store, args[1])
+			if err := store.DeleteUser(ctx, user.ID); err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("Removed %s with their bookmarks\n", user.Name)
+		case command == "passwd" && len(args) == 2:
+			user := userByName(ctx, store, args[1])
+			password, err := readPassword()
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			if err := store.SetPassword(ctx, user.ID, password); err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("Changed the password of %s and logged them out\n", user.Name)
+		case command == "role" && len(args) == 3:
+			user := userByName(ctx, store, args[1])
+			if err := store.SetRole(ctx, user.ID, args[2]); err != nil {
+				log.Fatalln(err)
+			}
+			log.Printf("%s is now %s\n", user.Name, args[2])
+		case command == "token" && len(args) == 3:
+			user := userByName(ctx, store, args[1])
+			token, secret, err := store.CreateToken(ctx, user.ID, args[2])
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			log.Printf("Created token %d %q of %s. It is only shown once:\n", token.ID, token.Name, user.Name)
+			fmt.Println(secret)
+		case command == "tokens" && len(args) == 2:
+			user := userByName(ctx, store, args[1])
+			tokens, err := store.ListTokens(ctx, user.ID)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			for _, token := range tokens {
+				lastUsed := token.LastUsedAt
+				if lastUsed == "" {
+					lastUsed = "never"
+				}
+				fmt.Printf("%4d  %-30s created %s, last used %s\n", token.ID, token.Name, token.CreatedAt, lastUsed)
+			}
+		case command == "revoke" && len(args) == 3:
+			user := userByName(ctx, store, args[1])
+			id, err := strconv.Atoi(args[2])
+			if err != nil {
+				log.Fatalf("invalid token id %q\n", args[2])
+			}
+
+			if err := store.DeleteToken(ctx, user.ID, id); err != nil {
+				log.Fatalf("unable to revoke token %d of %s: %v\n", id, user.Name, err)
+			}
+			log.Printf("Revoked token %d of %s\n", id, user.Name)
+		default:
+			log.Fatalln(userUsage)
+		}
+	}
+}
+
+// The user named name. Exits if there is none.
+func userByName(ctx context.Context, store *database.Store, name string) database.User {
+	user, err := store.GetUserByName(ctx, name)
+	if err != nil {
+		log.Fatalf("unknown user %q: %v\n", name, err)
+	}
+	return user
+}
+
+// Read a new password twice from the terminal, or once from the first line
+// of the standard input if it is not a terminal.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("unable to read the password from the standard input: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Repeat the password: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if string(again) != string(password) {
+		return "", errors.New("the passwords do not match")
+	}
+	return string(password), nil
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Number of database pages copied per step of a backup. The source is only
+// locked during a step, so writers are not blocked for the whole backup.
+const backupStepPages = 1024
+
+// Names of the backups created by BackupTo.
+const (
+	backupPrefix     = "pdfsearch-"
+	backupTimeLayout = "20060102-150405"
+)
+
+// Options of BackupTo.
+type BackupOptions struct {
+	Dir      string // Directory of the backups
+	Keep     int    // Number of backups kept in Dir. 0 keeps them all.
+	Compress bool   // Compress the backup with gzip
+}
+
+// A backup created by BackupTo.
+type Backup struct {
+	Path string
+	Size int64 // Size of the file in bytes
+}
+
+// Backup copies the database to path with the SQLite online backup API.
+// The copy is consistent even while other connections write to the database.
+func (s *Store) Backup(ctx context.Context, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	err = copyDatabase(ctx, dest, s.db)
+	if err != nil {
+		return err
+	}
+
+	// Closing the last connection checkpoints the WAL into the file.
+	return dest.Close()
+}
+
+// BackupTo creates a timestamped backup in opts.Dir, compressed if
+// opts.Compress is set, then deletes the oldest backups beyond opts.Keep.
+func (s *Store) BackupTo(ctx context.Context, opts BackupOptions) (Backup, error) {
+	err := os.MkdirAll(opts.Dir, 0755)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	path := filepath.Join(opts.Dir, backupPrefix+time.Now().UTC().Format(backupTimeLayout)+".db")
+	if !opts.Compress {
+		err = s.Backup(ctx, path)
+	} else {
+		tmp := path + ".tmp"
+		defer os.Remove(tmp)
+
+		err = s.Backup(ctx, tmp)
+		if err == nil {
+			path += ".gz"
+			err = compressFile(tmp, path)
+		}
+	}
+
+	if err != nil {
+		os.Remove(path)
+		return Backup{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	err = rotateBackups(opts.Dir, opts.Keep)
+	return Backup{Path: path, Size: stat.Size()}, err
+}
+
+// Restore replaces the content of the database with the backup at path,
+// which may be gzip compressed. The backup must pass an integrity check and
+// must not have a newer schema than this version of pdfsearch knows.
+// Returns the schema version of the backup. Call Migrate afterwards to
+// upgrade an older backup.
+func (s *Store) Restore(ctx context.Context, path string) (int, error) {
+	if strings.HasSuffix(path, ".gz") {
+		tmp, err := os.CreateTemp(filepath.Dir(path), "restore-*.db")
+		if err != nil {
+			return 0, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+
+		err = decompressFile(path, tmp.Name())
+		if err != nil {
+			return 0, fmt.Errorf("unable to decompress %s: %w", path, err)
+		}
+		path = tmp.Name()
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	src, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := validateBackup(ctx, src)
+	if err != nil {
+		return 0, fmt.Errorf("invalid backup %s: %w", path, err)
+	}
+
+	err = copyDatabase(ctx, s.db, src)
+	return version, err
+}
+
+// Check that src is a healthy pdfsearch database with a known schema.
+// Returns its schema version.
+func validateBackup(ctx context.Context, src *sql.DB) (int, error) {
+	var result string
+	err := src.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&result)
+	if err != nil {
+		return 0, err
+	}
+
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var hasFiles, hasVersions bool
+	err = src.QueryRowContext(ctx, `SELECT
+		EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'files'),
+		EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'schema_version')`).Scan(&hasFiles, &hasVersions)
+	if err != nil {
+		return 0, err
+	}
+
+	if !hasFiles {
+		return 0, errors.New("not a pdfsearch database")
+	}
+
+	// Databases created before migrations have no schema_version table.
+	version := 0
+	if hasVersions {
+		err = src.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	if version > latest {
+		return 0, fmt.Errorf("schema version %d is newer than the latest known version %d: upgrade pdfsearch", version, latest)
+	}
+	return version, nil
+}
+
+// Copy the main database of src into dest with the online backup API.
+func copyDatabase(ctx context.Context, dest, src *sql.DB) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			destSqlite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup needs a sqlite3 connection")
+			}
+
+			srcSqlite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup needs a sqlite3 connection")
+			}
+
+			backup, err := destSqlite.Backup("main", srcSqlite, "main")
+			if err != nil {
+				return err
+			}
+
+			for {
+				done, err := backup.Step(backupStepPages)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+
+				if done {
+					return backup.Finish()
+				}
+
+				if err := ctx.Err(); err != nil {
+					backup.Finish()
+					return err
+				}
+
+				// Let writers of the source make progress.
+				time.Sleep(time.Millisecond)
+			}
+		})
+	})
+}
+
+// Delete the oldest backups of dir beyond keep. Backups are sorted by the
+// timestamp in their name.
+func rotateBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	backups := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, backupPrefix) && (strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db.gz")) {
+			backups = append(backups, name)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i := keep; i < len(backups); i++ {
+		err := os.Remove(filepath.Join(dir, backups[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gzip the file at src into dest.
+func compressFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Decompress the gzip file at src into dest.
+func decompressFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, zr); err != nil {
+		return err
+	}
+	return out.Close()
+}
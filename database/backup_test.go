@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	s := openStore(t)
+	if err := s.Migrate(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.InsertFiles(ctx, []File{{ID: 1, Name: "a.pdf", Path: "/a.pdf", Language: "en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.InsertPages(ctx, []Page{{FileID: 1, PageNum: 0, Text: "myocardial infarction", Language: "en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compress := range []bool{false, true} {
+		backup, err := s.BackupTo(ctx, BackupOptions{Dir: t.TempDir(), Compress: compress})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restored, err := OpenMemory(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer restored.Close()
+
+		version, err := restored.Restore(ctx, backup.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		latest, _ := LatestSchemaVersion()
+		if version != latest {
+			t.Fatalf("expected schema version %d, got %d", latest, version)
+		}
+
+		results, err := restored.Search(ctx, "infarction")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result in the restored database, got %d", len(results))
+		}
+	}
+}
+
+func TestRestoreNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	s := openStore(t)
+	if err := s.Migrate(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO schema_version (version, name) VALUES(9999, 'future')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := s.Backup(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if _, err := restored.Restore(ctx, path); err == nil {
+		t.Fatal("expected an error for a backup with a newer schema")
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"pdfsearch-20240101-000000.db",
+		"pdfsearch-20240102-000000.db.gz",
+		"pdfsearch-20240103-000000.db",
+		"notes.txt",
+	}
+
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := rotateBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := []string{}
+	for _, entry := range entries {
+		kept = append(kept, entry.Name())
+	}
+
+	expected := []string{"notes.txt", "pdfsearch-20240102-000000.db.gz", "pdfsearch-20240103-000000.db"}
+	if len(kept) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, kept)
+	}
+
+	for i := range kept {
+		if kept[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, kept)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/abiiranathan/pdfsearch/pdf"
+)
+
+// A bookmarked page with an optional note. Bookmarks refer to the content
+// of a document rather than its file, so that they survive reindexing.
+type Bookmark struct {
+	ID        int
+	UserID    int    // Owner of the bookmark, 0 if made without authentication
+	Document  string // Hex encoded SHA-256 hash of the content of the document
+	FileID    int    // ID of an indexed file with this content, 0 if there is none
+	Name      string // File name of the document
+	PageNum   int    // 0-indexed page number
+	Note      string
+	CreatedAt string // UTC time the page was bookmarked
+	UpdatedAt string // UTC time the note was last changed
+}
+
+// Columns of a Bookmark, resolving its document to an indexed file.
+const bookmarkColumns = `bookmarks.id, bookmarks.user_id, bookmarks.document,
+	COALESCE((SELECT id FROM files WHERE sha256 = bookmarks.document ORDER BY id LIMIT 1), 0),
+	COALESCE((SELECT name FROM files WHERE sha256 = bookmarks.document ORDER BY id LIMIT 1), bookmarks.name) AS file_name,
+	bookmarks.page_num, bookmarks.note, bookmarks.created_at, bookmarks.updated_at`
+
+func scanBookmark(row interface{ Scan(...any) error }) (Bookmark, error) {
+	var b Bookmark
+	err := row.Scan(&b.ID, &b.UserID, &b.Document, &b.FileID, &b.Name, &b.PageNum, &b.Note, &b.CreatedAt, &b.UpdatedAt)
+	return b, err
+}
+
+// DocumentHash returns the content hash of an indexed file. Files indexed
+// before hashes were stored are hashed now and updated.
+func (s *Store) DocumentHash(ctx context.Context, fileId int) (string, error) {
+	file, err := s.GetFile(ctx, fileId)
+	if err != nil || file.SHA256 != "" {
+		return file.SHA256, err
+	}
+
+	hash, err := pdf.GetContentHash(file.Path)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash %s: %w", file.Path, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE files SET sha256 = ? WHERE id = ?`, hash, fileId)
+	return hash, err
+}
+
+// AddBookmark bookmarks a page of an indexed file with note for a user. If
+// the user already bookmarked the page, its note is replaced.
+func (s *Store) AddBookmark(ctx context.Context, userId, fileId, pageNum int, note string) (Bookmark, error) {
+	hash, err := s.DocumentHash(ctx, fileId)
+	if err != nil {
+		return Bookmark{}, err
+	}
+
+	file, err := s.GetFile(ctx, fileId)
+	if err != nil {
+		return Bookmark{}, err
+	}
+
+	query := `INSERT INTO bookmarks (user_id, document, page_num, name, note) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, document, page_num) DO UPDATE SET note = excluded.note, updated_at = CURRENT_TIMESTAMP
+		RETURNING id`
+
+	var id int
+	err = s.db.QueryRowContext(ctx, query, userId, hash, pageNum, file.Name, strings.TrimSpace(note)).Scan(&id)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	return s.GetBookmark(ctx, userId, id)
+}
+
+// GetBookmark returns a bookmark of a user by ID, sql.ErrNoRows if the user
+// has none.
+func (s *Store) GetBookmark(ctx context.Context, userId, id int) (Bookmark, error) {
+	query := fmt.Sprintf(`SELECT %s FROM bookmarks WHERE id = ? AND user_id = ?`, bookmarkColumns)
+	return scanBookmark(s.db.QueryRowContext(ctx, query, id, userId))
+}
+
+// ListBookmarks returns the bookmarks of a user on the documents of fileIds,
+// or all their bookmarks if there are none, ordered by document name and page.
+func (s *Store) ListBookmarks(ctx context.Context, userId int, fileIds ...int) ([]Bookmark, error) {
+	access, args := s.accessible("bookmarks.document")
+	query := fmt.Sprintf(`SELECT %s FROM bookmarks WHERE %s AND user_id = ?`, bookmarkColumns, access)
+
+	args = append(args, userId)
+	if len(fileIds) > 0 {
+		query += fmt.Sprintf(` AND document IN (SELECT sha256 FROM files WHERE id IN (%s))`,
+			strings.TrimSuffix(strings.Repeat("?,", len(fileIds)), ","))
+		for _, id := range fileIds {
+			args = append(args, id)
+		}
+	}
+	query += ` ORDER BY file_name, bookmarks.page_num`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		b, err := scanBookmark(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// UpdateBookmark replaces the note of a bookmark of a user. Returns
+// sql.ErrNoRows if the user has no bookmark with id.
+func (s *Store) UpdateBookmark(ctx context.Context, userId, id int, note string) (Bookmark, error) {
+	query := `UPDATE bookmarks SET note = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?`
+	result, err := s.db.ExecContext(ctx, query, strings.TrimSpace(note), id, userId)
+	if err != nil {
+		return Bookmark{}, err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return Bookmark{}, sql.ErrNoRows
+	}
+	return s.GetBookmark(ctx, userId, id)
+}
+
+// DeleteBookmark deletes a bookmark of a user. Returns sql.ErrNoRows if the
+// user has no bookmark with id.
+func (s *Store) DeleteBookmark(ctx context.Context, userId, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM bookmarks WHERE id = ? AND user_id = ?`, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SearchNotes runs the full-text query pattern against the notes of the
+// bookmarks of a user on indexed documents, restricted to books if not
+// empty. The Text of the results is the note with its matches between <b>
+// and </b>.
+func (s *Store) SearchNotes(ctx context.Context, userId int, pattern string, books ...int) ([]SearchResult, error) {
+	query := `SELECT files.id, bookmarks.page_num, highlight(notes, 0, '<b>', '</b>'), files.name, notes.rank
+		FROM notes
+		JOIN bookmarks ON bookmarks.id = notes.rowid
+		JOIN files ON files.id = (SELECT id FROM files WHERE sha256 = bookmarks.document ORDER BY id LIMIT 1)
+		WHERE notes MATCH ? AND bookmarks.user_id = ?`
+
+	args := []any{pattern, userId}
+	access, accessArgs := s.accessible("bookmarks.document")
+	query += " AND " + access
+	args = append(args, accessArgs...)
+	if len(books) > 0 {
+		query += fmt.Sprintf(" AND files.id IN (%s)", strings.TrimSuffix(strings.Repeat("?,", len(books)), ","))
+		for _, book := range books {
+			args = append(args, book)
+		}
+	}
+	query += fmt.Sprintf(" ORDER BY notes.rank LIMIT %d", maxResults)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		result := SearchResult{Note: true}
+		err := rows.Scan(&result.FileID, &result.PageNum, &result.Text, &result.BaseName, &result.rank)
+		if err != nil {
+			return nil, err
+		}
+		result.Title = fmt.Sprintf("Note on page %d", result.PageNum+1)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
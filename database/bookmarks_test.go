@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBookmarksSurviveReindexing(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{{ID: 1, Name: "peds.pdf", Path: "/old/peds.pdf", Language: "en", SHA256: "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bookmark, err := s.AddBookmark(ctx, 0, 1, 41, "  use this table for peds dosing ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bookmark.FileID != 1 || bookmark.PageNum != 41 || bookmark.Note != "use this table for peds dosing" {
+		t.Fatalf("unexpected bookmark %+v", bookmark)
+	}
+
+	// Bookmarking the page again replaces the note.
+	again, err := s.AddBookmark(ctx, 0, 1, 41, "weight based dosing")
+	if err != nil || again.ID != bookmark.ID || again.Note != "weight based dosing" {
+		t.Fatalf("expected the note of bookmark %d to be replaced, got %+v, %v", bookmark.ID, again, err)
+	}
+
+	// Moving the library changes the file ids but not the content.
+	if err := s.RemoveFiles(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan, err := s.GetBookmark(ctx, 0, bookmark.ID)
+	if err != nil || orphan.FileID != 0 || orphan.Name != "peds.pdf" {
+		t.Fatalf("expected an orphan bookmark of peds.pdf, got %+v, %v", orphan, err)
+	}
+
+	err = s.InsertFiles(ctx, []File{{ID: 2, Name: "peds.pdf", Path: "/new/peds.pdf", Language: "en", SHA256: "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, err := s.ListBookmarks(ctx, 0, 2)
+	if err != nil || len(bookmarks) != 1 || bookmarks[0].FileID != 2 {
+		t.Fatalf("expected the bookmark to follow the document, got %+v, %v", bookmarks, err)
+	}
+
+	results, err := s.SearchNotes(ctx, 0, "weight")
+	if err != nil || len(results) != 1 || results[0].FileID != 2 || results[0].Text != "<b>weight</b> based dosing" {
+		t.Fatalf("expected the note to match, got %+v, %v", results, err)
+	}
+
+	if _, err := s.UpdateBookmark(ctx, 0, bookmark.ID, "renal dosing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if results, _ := s.SearchNotes(ctx, 0, "weight"); len(results) != 0 {
+		t.Errorf("expected the old note to be removed from the index, got %+v", results)
+	}
+
+	if err := s.DeleteBookmark(ctx, 0, bookmark.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteBookmark(ctx, 0, bookmark.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	if results, _ := s.SearchNotes(ctx, 0, "renal"); len(results) != 0 {
+		t.Errorf("expected the note to be removed from the index, got %+v", results)
+	}
+}
+
+func TestDocumentHashOfOldFiles(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files indexed before hashes were stored have none.
+	if err := s.InsertFiles(ctx, []File{{ID: 1, Name: "a.pdf", Path: path}}); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := s.DocumentHash(ctx, 1)
+	if err != nil || len(hash) != 64 {
+		t.Fatalf("expected a SHA-256 hash, got %q, %v", hash, err)
+	}
+
+	file, _ := s.GetFile(ctx, 1)
+	if file.SHA256 != hash {
+		t.Errorf("expected the hash to be stored, got %q", file.SHA256)
+	}
+}
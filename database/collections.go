@@ -0,0 +1,362 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A named set of documents. The documents of a restricted collection are
+// only accessible to the admins and to the users granted access to it,
+// directly or through a group. Documents in no restricted collection are
+// accessible to every user.
+type Collection struct {
+	ID         int
+	Name       string
+	Restricted bool
+	Documents  int    // Number of documents in the collection
+	CreatedAt  string // UTC time the collection was created
+}
+
+// A named group of users.
+type Group struct {
+	ID      int
+	Name    string
+	Members int // Number of users in the group
+}
+
+// The documents a user may not access: those of the restricted collections
+// they were not granted, directly or through a group. Takes the ID of the
+// user twice.
+const hiddenDocuments = `SELECT cf.document FROM collection_files cf
+	JOIN collections c ON c.id = cf.collection_id WHERE c.restricted = 1
+	EXCEPT
+	SELECT document FROM collection_files WHERE collection_id IN (
+		SELECT collection_id FROM collection_users WHERE user_id = ?
+		UNION
+		SELECT cg.collection_id FROM collection_groups cg
+		JOIN group_members gm ON gm.group_id = cg.group_id WHERE gm.user_id = ?)`
+
+// As returns a view of the store restricted to the documents user may
+// access. Files, pages, search results, bookmarks and saved search matches
+// of the other documents are left out of the view as if they were not
+// indexed. Admins access every document. The view shares the connection
+// of s and must not be closed.
+func (s *Store) As(user User) *Store {
+	if user.IsAdmin() {
+		return &Store{db: s.db}
+	}
+	return &Store{db: s.db, viewer: user.ID}
+}
+
+// A condition true for the documents the viewer of s may access, given the
+// column of their content hash, and its arguments. Always true if s is not
+// restricted to a viewer.
+func (s *Store) accessible(column string) (string, []any) {
+	if s.viewer == 0 {
+		return "1", nil
+	}
+	return fmt.Sprintf("%s NOT IN (%s)", column, hiddenDocuments), []any{s.viewer, s.viewer}
+}
+
+// Returns sql.ErrNoRows if the viewer of s may not access the file fileId.
+func (s *Store) checkAccess(ctx context.Context, fileId int) error {
+	if s.viewer == 0 {
+		return nil
+	}
+	_, err := s.GetFile(ctx, fileId)
+	return err
+}
+
+func scanCollection(row interface{ Scan(...any) error }) (Collection, error) {
+	var c Collection
+	err := row.Scan(&c.ID, &c.Name, &c.Restricted, &c.Documents, &c.CreatedAt)
+	return c, err
+}
+
+const collectionColumns = `id, name, restricted,
+	(SELECT COUNT(*) FROM collection_files WHERE collection_id = collections.id), created_at`
+
+// CreateCollection creates an empty collection.
+func (s *Store) CreateCollection(ctx context.Context, name string, restricted bool) (Collection, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Collection{}, errors.New("a collection needs a name")
+	}
+
+	var id int
+	err := s.db.QueryRowContext(ctx, `INSERT INTO collections (name, restricted) VALUES (?, ?) RETURNING id`,
+		name, restricted).Scan(&id)
+	if err != nil {
+		return Collection{}, fmt.Errorf("unable to create collection %q: %w", name, err)
+	}
+	return s.GetCollection(ctx, id)
+}
+
+// GetCollection returns a collection by ID, sql.ErrNoRows if there is none.
+func (s *Store) GetCollection(ctx context.Context, id int) (Collection, error) {
+	query := fmt.Sprintf(`SELECT %s FROM collections WHERE id = ?`, collectionColumns)
+	return scanCollection(s.db.QueryRowContext(ctx, query, id))
+}
+
+// GetCollectionByName returns a collection by name, ignoring case,
+// sql.ErrNoRows if there is none.
+func (s *Store) GetCollectionByName(ctx context.Context, name string) (Collection, error) {
+	query := fmt.Sprintf(`SELECT %s FROM collections WHERE name = ?`, collectionColumns)
+	return scanCollection(s.db.QueryRowContext(ctx, query, strings.TrimSpace(name)))
+}
+
+// ListCollections returns the collections ordered by name.
+func (s *Store) ListCollections(ctx context.Context) ([]Collection, error) {
+	query := fmt.Sprintf(`SELECT %s FROM collections ORDER BY name`, collectionColumns)
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// SetRestricted restricts the documents of a collection to the users
+// granted access, or opens them to everyone.
+func (s *Store) SetRestricted(ctx context.Context, id int, restricted bool) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE collections SET restricted = ? WHERE id = ?`, restricted, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteCollection deletes a collection and the access granted to it. Its
+// documents are kept in the index. Returns sql.ErrNoRows if there is no
+// collection with id.
+func (s *Store) DeleteCollection(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"collection_files", "collection_users", "collection_groups"} {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE collection_id = ?`, table), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM collections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// AddToCollection adds the documents of indexed files to a collection.
+func (s *Store) AddToCollection(ctx context.Context, id int, fileIds ...int) error {
+	for _, fileId := range fileIds {
+		hash, err := s.DocumentHash(ctx, fileId)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.ExecContext(ctx, `INSERT INTO collection_files (collection_id, document) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, id, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFromCollection removes the documents of indexed files from a collection.
+func (s *Store) RemoveFromCollection(ctx context.Context, id int, fileIds ...int) error {
+	for _, fileId := range fileIds {
+		hash, err := s.DocumentHash(ctx, fileId)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.ExecContext(ctx, `DELETE FROM collection_files WHERE collection_id = ? AND document = ?`, id, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectionFiles returns the indexed files of the documents of a
+// collection, ordered by name.
+func (s *Store) CollectionFiles(ctx context.Context, id int) ([]File, error) {
+	query := `SELECT id, name, path, language, COALESCE(indexed_at, ''), sha256 FROM files
+		WHERE sha256 IN (SELECT document FROM collection_files WHERE collection_id = ?) ORDER BY name`
+	return s.queryFiles(ctx, query, id)
+}
+
+// GrantUser gives a user access to a collection.
+func (s *Store) GrantUser(ctx context.Context, id, userId int) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO collection_users (collection_id, user_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`, id, userId)
+	return err
+}
+
+// RevokeUser takes back the access of a user to a collection. They keep
+// the access granted to their groups.
+func (s *Store) RevokeUser(ctx context.Context, id, userId int) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM collection_users WHERE collection_id = ? AND user_id = ?`, id, userId)
+	return err
+}
+
+// GrantGroup gives the members of a group access to a collection.
+func (s *Store) GrantGroup(ctx context.Context, id, groupId int) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO collection_groups (collection_id, group_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`, id, groupId)
+	return err
+}
+
+// RevokeGroup takes back the access of a group to a collection.
+func (s *Store) RevokeGroup(ctx context.Context, id, groupId int) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM collection_groups WHERE collection_id = ? AND group_id = ?`, id, groupId)
+	return err
+}
+
+// CollectionAccess returns the names of the users and of the groups granted
+// access to a collection.
+func (s *Store) CollectionAccess(ctx context.Context, id int) (users, groups []string, err error) {
+	users, err = s.queryNames(ctx, `SELECT u.name FROM collection_users cu
+		JOIN users u ON u.id = cu.user_id WHERE cu.collection_id = ? ORDER BY u.name`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups, err = s.queryNames(ctx, `SELECT g.name FROM collection_groups cg
+		JOIN user_groups g ON g.id = cg.group_id WHERE cg.collection_id = ? ORDER BY g.name`, id)
+	return users, groups, err
+}
+
+// CreateGroup creates a group without members.
+func (s *Store) CreateGroup(ctx context.Context, name string) (Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Group{}, errors.New("a group needs a name")
+	}
+
+	var id int
+	err := s.db.QueryRowContext(ctx, `INSERT INTO user_groups (name) VALUES (?) RETURNING id`, name).Scan(&id)
+	if err != nil {
+		return Group{}, fmt.Errorf("unable to create group %q: %w", name, err)
+	}
+	return Group{ID: id, Name: name}, nil
+}
+
+// GetGroupByName returns a group by name, ignoring case, sql.ErrNoRows if
+// there is none.
+func (s *Store) GetGroupByName(ctx context.Context, name string) (Group, error) {
+	var g Group
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, (SELECT COUNT(*) FROM group_members WHERE group_id = id)
+		FROM user_groups WHERE name = ?`, strings.TrimSpace(name)).Scan(&g.ID, &g.Name, &g.Members)
+	return g, err
+}
+
+// ListGroups returns the groups ordered by name.
+func (s *Store) ListGroups(ctx context.Context) ([]Group, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, (SELECT COUNT(*) FROM group_members WHERE group_id = id)
+		FROM user_groups ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.Members); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// GroupMembers returns the names of the members of a group.
+func (s *Store) GroupMembers(ctx context.Context, id int) ([]string, error) {
+	return s.queryNames(ctx, `SELECT u.name FROM group_members gm
+		JOIN users u ON u.id = gm.user_id WHERE gm.group_id = ? ORDER BY u.name`, id)
+}
+
+// DeleteGroup deletes a group, its members lose the access granted to it.
+// Returns sql.ErrNoRows if there is no group with id.
+func (s *Store) DeleteGroup(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"group_members", "collection_groups"} {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE group_id = ?`, table), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_groups WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// AddGroupMember adds a user to a group.
+func (s *Store) AddGroupMember(ctx context.Context, id, userId int) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO group_members (group_id, user_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`, id, userId)
+	return err
+}
+
+// RemoveGroupMember removes a user from a group.
+func (s *Store) RemoveGroupMember(ctx context.Context, id, userId int) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, id, userId)
+	return err
+}
+
+// Query a column of names.
+func (s *Store) queryNames(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
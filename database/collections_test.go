@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestRestrictedCollections(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{
+		{ID: 1, Name: "cardiology.pdf", Path: "/cardiology.pdf", Language: "en", SHA256: "open"},
+		{ID: 2, Name: "cardiology exam.pdf", Path: "/cardiology exam.pdf", Language: "en", SHA256: "exam"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.InsertPages(ctx, []Page{
+		{FileID: 1, PageNum: 0, Text: "Acute myocardial infarction is an emergency.", Language: "en"},
+		{FileID: 2, PageNum: 0, Text: "Question 1: the infarction shown is anterior.", Language: "en"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := map[string]User{}
+	for name, role := range map[string]string{"alice": RoleAdmin, "bob": RoleUser, "carol": RoleUser, "dave": RoleUser} {
+		if users[name], err = s.CreateUser(ctx, name, "correct horse", role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exams, err := s.CreateCollection(ctx, "Exams", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddToCollection(ctx, exams.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// carol is granted access through a group, dave directly.
+	faculty, err := s.CreateGroup(ctx, "faculty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range []error{
+		s.AddGroupMember(ctx, faculty.ID, users["carol"].ID),
+		s.GrantGroup(ctx, exams.ID, faculty.ID),
+		s.GrantUser(ctx, exams.ID, users["dave"].ID),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// bob bookmarked the exam before it was restricted.
+	if _, err := s.AddBookmark(ctx, users["bob"].ID, 2, 0, "anterior infarction"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, allowed := range map[string]bool{"alice": true, "bob": false, "carol": true, "dave": true} {
+		view := s.As(users[name])
+
+		files, err := view.GetFiles(ctx)
+		if err != nil || len(files) != map[bool]int{true: 2, false: 1}[allowed] {
+			t.Errorf("%s: unexpected files %+v, %v", name, files, err)
+		}
+
+		if _, err := view.GetFile(ctx, 2); (err == nil) != allowed {
+			t.Errorf("%s: GetFile of the exam returned %v", name, err)
+		}
+
+		stats, err := view.GetFileStats(ctx)
+		if err != nil || len(stats) != len(files) {
+			t.Errorf("%s: unexpected file stats %+v, %v", name, stats, err)
+		}
+
+		if _, err := view.GetFileStatsByID(ctx, 2); (err == nil) != allowed {
+			t.Errorf("%s: GetFileStatsByID of the exam returned %v", name, err)
+		}
+
+		results, err := view.Search(ctx, "infarction")
+		if err != nil || len(results) != len(files) {
+			t.Errorf("%s: unexpected results %+v, %v", name, results, err)
+		}
+
+		_, err = view.GetPage(ctx, 2, 0)
+		if allowed && err != nil || !allowed && !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("%s: GetPage of the exam returned %v", name, err)
+		}
+
+		if text, err := view.HighlightPage(ctx, 2, 0, "anterior", "[", "]"); !allowed && (err == nil || text != "") {
+			t.Errorf("%s: HighlightPage of the exam returned %q, %v", name, text, err)
+		}
+
+		if pages, err := view.ListPages(ctx, 2); (err == nil) != allowed {
+			t.Errorf("%s: ListPages of the exam returned %+v, %v", name, pages, err)
+		}
+
+		completions, err := view.Complete(ctx, "cardio", 10)
+		if err != nil || len(completions.Books) != len(files) {
+			t.Errorf("%s: unexpected completions %+v, %v", name, completions, err)
+		}
+	}
+
+	bob := s.As(users["bob"])
+	if bookmarks, _ := bob.ListBookmarks(ctx, users["bob"].ID); len(bookmarks) != 0 {
+		t.Errorf("expected the bookmarks of bob on the exam to be hidden, got %+v", bookmarks)
+	}
+
+	if results, _ := bob.SearchNotes(ctx, users["bob"].ID, "anterior"); len(results) != 0 {
+		t.Errorf("expected the notes of bob on the exam to be hidden, got %+v", results)
+	}
+
+	// The exam stays restricted when reindexed under another id.
+	err = s.InsertFiles(ctx, []File{{ID: 3, Name: "exam.pdf", Path: "/moved/exam.pdf", Language: "en", SHA256: "exam"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bob.GetFile(ctx, 3); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the moved exam to stay hidden, got %v", err)
+	}
+
+	// The saved searches of bob do not show the exam, even though it matches.
+	search, err := s.CreateSavedSearch(ctx, SavedSearch{UserID: users["bob"].ID, Name: "mi", Query: "infarction", Expand: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.Search(ctx, "infarction")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RecordMatches(ctx, search.ID, results, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if matches, _ := bob.SavedMatches(ctx, search.ID, 10, false); len(matches) != 1 || matches[0].FileID != 1 {
+		t.Errorf("expected bob to see the open match only, got %+v", matches)
+	}
+
+	if searches, _ := bob.ListSavedSearches(ctx, users["bob"].ID); len(searches) != 1 || searches[0].NewMatches != 1 {
+		t.Errorf("expected 1 new match of the saved search for bob, got %+v", searches)
+	}
+
+	if n, _ := bob.CountNewMatches(ctx, users["bob"].ID); n != 1 {
+		t.Errorf("expected 1 new match for bob, got %d", n)
+	}
+
+	// Revoking the access of dave, or opening the collection.
+	if err := s.RevokeUser(ctx, exams.ID, users["dave"].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.As(users["dave"]).GetFile(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the access of dave to be revoked, got %v", err)
+	}
+
+	if err := s.SetRestricted(ctx, exams.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bob.GetFile(ctx, 2); err != nil {
+		t.Errorf("expected the exam to be open to bob, got %v", err)
+	}
+}
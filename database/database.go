@@ -5,76 +5,89 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/abiiranathan/pdfsearch/language"
 	"github.com/abiiranathan/pdfsearch/pdf"
 	"github.com/mattn/go-sqlite3"
 )
 
-var db *sql.DB
+// A Store is a pdfsearch index in a sqlite3 database.
+// It is safe for concurrent use.
+type Store struct {
+	db *sql.DB
 
-// Connect to sqlite3 database.
-func Connect(dbname string) *sql.DB {
-	var err error
-	db, err = sql.Open("sqlite3", dbname)
+	// The user whose access restricts the documents of a view returned by As,
+	// 0 for all documents.
+	viewer int
+}
+
+// Open connects to the sqlite3 database at path, creating it if needed.
+// Call Migrate to create or upgrade the schema.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
-		log.Fatalf("unable to connect to database: %v\n", err)
+		return nil, fmt.Errorf("unable to open database: %w", err)
 	}
 
 	// ping the database to ensure we are connected.
 	err = db.Ping()
 	if err != nil {
-		log.Fatalf("unable to ping database: %v\n", err)
+		db.Close()
+		return nil, fmt.Errorf("unable to connect to database %s: %w", path, err)
 	}
 
 	// Enable foreign key constraints and WAL mode.
 	_, err = db.Exec(`PRAGMA foreign_keys = ON ; PRAGMA journal_mode = WAL`)
 	if err != nil {
-		log.Fatalf("unable to set pragma: %v\n", err)
+		db.Close()
+		return nil, fmt.Errorf("unable to set pragma: %w", err)
 	}
-
-	return db
+	return &Store{db: db}, nil
 }
 
-func CreateTables() error {
-	// create table for filenames
-	_, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS files(
-		id INTEGER NOT NULL PRIMARY KEY,
-		name TEXT NOT NULL,
-		path TEXT NOT NULL UNIQUE
-	)
-	`)
-
+// OpenMemory creates an empty store in memory, with the latest schema.
+// Its content is lost when it is closed. Meant for tests.
+func OpenMemory(ctx context.Context) (*Store, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Create virtual table with the sqlite3 FTS5 extension to use for our searches.
-	// Virtual tables do not support primary key.
-	// See official documentation for more information: https://www.sqlite.org/fts5.html
-	// tokenize='porter unicode61 remove_diacritics 2' is used to tokenize the text.
-	// This is a custom tokenizer that uses the porter stemmer, unicode61 tokenization, and removes diacritics.
-	_, err = db.Exec(`
-		CREATE VIRTUAL TABLE IF NOT EXISTS pages USING fts5(
-			file_id UNINDEXED,
-			page_num UNINDEXED,
-			text,
-			tokenize='porter unicode61 remove_diacritics 2'
-		)
-	`)
+	// Every connection to :memory: opens a new database.
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	s := &Store{db: db}
+	err = s.Migrate(ctx, 0)
 	if err != nil {
-		return err
+		db.Close()
+		return nil, err
 	}
-	return err
+	return s, nil
 }
 
-func GetFiles(ctx context.Context) ([]File, error) {
-	query := `SELECT id, name, path FROM files ORDER BY name`
+// Close the database connection.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) GetFiles(ctx context.Context) ([]File, error) {
+	condition, args := s.accessible("sha256")
+	query := fmt.Sprintf(`SELECT id, name, path, language, COALESCE(indexed_at, ''), sha256 FROM files
+		WHERE %s ORDER BY name`, condition)
+	return s.queryFiles(ctx, query, args...)
+}
 
+// Query files with the columns of File.
+func (s *Store) queryFiles(ctx context.Context, query string, args ...any) ([]File, error) {
 	files := []File{}
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +95,7 @@ func GetFiles(ctx context.Context) ([]File, error) {
 
 	for rows.Next() {
 		var file File
-		err := rows.Scan(&file.ID, &file.Name, &file.Path)
+		err := rows.Scan(&file.ID, &file.Name, &file.Path, &file.Language, &file.IndexedAt, &file.SHA256)
 		if err != nil {
 			return nil, err
 		}
@@ -95,16 +108,69 @@ func GetFiles(ctx context.Context) ([]File, error) {
 	return files, nil
 }
 
-func GetFile(ctx context.Context, fileId int) (file File, err error) {
-	query := `SELECT id, name, path FROM files WHERE id=$1 LIMIT 1`
+func (s *Store) GetFile(ctx context.Context, fileId int) (file File, err error) {
+	condition, args := s.accessible("sha256")
+	query := fmt.Sprintf(`SELECT id, name, path, language, COALESCE(indexed_at, ''), sha256 FROM files
+		WHERE id = ? AND %s LIMIT 1`, condition)
 
-	row := db.QueryRowContext(ctx, query, fileId)
-	err = row.Scan(&file.ID, &file.Name, &file.Path)
+	row := s.db.QueryRowContext(ctx, query, append([]any{fileId}, args...)...)
+	err = row.Scan(&file.ID, &file.Name, &file.Path, &file.Language, &file.IndexedAt, &file.SHA256)
 	return
 }
 
-func InsertFiles(ctx context.Context, files []File) error {
-	tx, err := db.BeginTx(ctx, nil)
+// EachPage calls fn with every page of the index in all languages,
+// ordered by file and page number. Stops at the first error of fn.
+func (s *Store) EachPage(ctx context.Context, fn func(Page) error) error {
+	query := `SELECT file_id, page_num, text, 'en' AS lang FROM pages
+		UNION ALL
+		SELECT file_id, page_num, text, lang FROM pages_intl
+		ORDER BY file_id, page_num`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var page Page
+		err := rows.Scan(&page.FileID, &page.PageNum, &page.Text, &page.Language)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetLanguages returns the distinct languages of the indexed files the
+// viewer of s may access.
+func (s *Store) GetLanguages(ctx context.Context) ([]string, error) {
+	condition, args := s.accessible("sha256")
+	query := fmt.Sprintf(`SELECT DISTINCT language FROM files WHERE %s ORDER BY language`, condition)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	languages := []string{}
+	for rows.Next() {
+		var lang string
+		err := rows.Scan(&lang)
+		if err != nil {
+			return nil, err
+		}
+		languages = append(languages, lang)
+	}
+	return languages, rows.Err()
+}
+
+func (s *Store) InsertFiles(ctx context.Context, files []File) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -126,7 +192,7 @@ func InsertFiles(ctx context.Context, files []File) error {
 
 		batch := files[i:end] // end is exclusive, no out of bounds error
 		placeholder, args := fileValueTuple(&batch)
-		query := fmt.Sprintf("INSERT INTO files (id, name, path) VALUES %s", placeholder)
+		query := fmt.Sprintf("INSERT INTO files (id, name, path, language, sha256, indexed_at) VALUES %s", placeholder)
 		stmt, err := tx.PrepareContext(ctx, query)
 		if err != nil {
 			return err
@@ -149,16 +215,16 @@ func InsertFiles(ctx context.Context, files []File) error {
 }
 
 // Insert files one by one, ignoring any conflicts.
-func InsertOneByOne(ctx context.Context, files []File) error {
-	query := `INSERT INTO files (id, name, path) VALUES ($1, $2, $3) ON CONFLICT(path) DO NOTHING`
-	tx, err := db.Begin()
+func (s *Store) InsertOneByOne(ctx context.Context, files []File) error {
+	query := `INSERT INTO files (id, name, path, language, sha256, indexed_at) VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP) ON CONFLICT(path) DO NOTHING`
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	for _, file := range files {
-		_, err := tx.ExecContext(ctx, query, pdf.GetPathHash(file.Path), filepath.Base(file.Path), file.Path)
+		_, err := tx.ExecContext(ctx, query, pdf.GetPathHash(file.Path), filepath.Base(file.Path), file.Path, fileLanguage(file), file.SHA256)
 		if err != nil {
 			if sqliteErr, ok := err.(sqlite3.Error); ok {
 				if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
@@ -175,29 +241,117 @@ func InsertOneByOne(ctx context.Context, files []File) error {
 
 }
 
-// Perform a full-text search on the pages table.
-func Search(ctx context.Context, pattern string, books ...int) ([]SearchResult, error) {
-	var query = `SELECT DISTINCT file_id, page_num, snippet(pages, 2, '<b>', '</b>','...', 16) title,
-		snippet(pages, 2, '<b>', '</b>','...', 60) text,
-		files.name AS base_name
-        FROM pages JOIN files ON pages.file_id = files.id 
-		WHERE pages MATCH $1 order by rank limit 200`
+// Perform a full-text search on the pages of all languages.
+func (s *Store) Search(ctx context.Context, pattern string, books ...int) ([]SearchResult, error) {
+	return s.SearchInLanguage(ctx, pattern, "", books...)
+}
 
-	if len(books) > 0 {
-		query = `SELECT DISTINCT file_id, page_num, snippet(pages, 2, '<b>', '</b>','...', 16) title,
-		snippet(pages, 2, '<b>', '</b>','...', 60) text,
-		files.name AS base_name
-        FROM pages 
-		JOIN files ON pages.file_id = files.id
-		WHERE pages MATCH $1 AND file_id IN ($2) order by rank limit 200`
+// Perform a full-text search on the pages of documents in lang.
+// English pages are matched with the porter stemmer, the others with
+// prefixes of their stems. If lang is empty, all languages are searched
+// and the results merged by their rank relative to the best of each table.
+func (s *Store) SearchInLanguage(ctx context.Context, pattern, lang string, books ...int) ([]SearchResult, error) {
+	if lang == language.English {
+		return s.searchTable(ctx, "pages", pattern, books)
 	}
 
-	results := []SearchResult{}
+	intlPattern := language.PrefixQuery(lang, pattern)
+	if lang != "" {
+		return s.searchTable(ctx, "pages_intl", intlPattern, books, "lang = ?", lang)
+	}
+
+	results, err := s.searchTable(ctx, "pages", pattern, books)
+	if err != nil {
+		return nil, err
+	}
+
+	intlResults, err := s.searchTable(ctx, "pages_intl", intlPattern, books)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bm25 ranks of two tables are not comparable since they depend on
+	// the statistics of each table. Scale them so the best of each is -1.
+	results = append(normalizeRanks(results), normalizeRanks(intlResults)...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].rank < results[j].rank
+	})
+
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+	return results, nil
+}
+
+// Divide the ranks of results, sorted by rank, by the absolute rank of
+// the first one.
+func normalizeRanks(results []SearchResult) []SearchResult {
+	if len(results) == 0 || results[0].rank == 0 {
+		return results
+	}
+
+	best := math.Abs(results[0].rank)
+	for i := range results {
+		results[i].rank /= best
+	}
+	return results
+}
+
+// Perform a substring search on the pages_trigram table.
+// Every word of the pattern with at least 3 characters must appear
+// somewhere in the page, even inside a longer token, e.g. "BRCA" in "BRCA1/2".
+// If lang is not empty, only documents in that language are searched.
+func (s *Store) SearchSubstring(ctx context.Context, pattern, lang string, books ...int) ([]SearchResult, error) {
+	phrases := []string{}
+	for _, word := range strings.Fields(pattern) {
+		if utf8.RuneCountInString(word) >= 3 {
+			phrases = append(phrases, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+		}
+	}
+
+	if len(phrases) == 0 {
+		return nil, fmt.Errorf("substring search needs words of at least 3 characters")
+	}
+	pattern = strings.Join(phrases, " ")
+	if lang != "" {
+		return s.searchTable(ctx, "pages_trigram", pattern, books, "files.language = ?", lang)
+	}
+	return s.searchTable(ctx, "pages_trigram", pattern, books)
+}
+
+// Maximum number of results of a search.
+const maxResults = 200
+
+// Run the full-text query pattern against table, which must be one of the
+// FTS5 tables with the (file_id, page_num, text) columns.
+// An optional condition with its argument further filters the pages.
+func (s *Store) searchTable(ctx context.Context, table, pattern string, books []int, condition ...any) ([]SearchResult, error) {
+	query := fmt.Sprintf(`SELECT DISTINCT file_id, page_num, snippet(%[1]s, 2, '<b>', '</b>','...', 16) title,
+		snippet(%[1]s, 2, '<b>', '</b>','...', 60) text,
+		files.name AS base_name, rank
+		FROM %[1]s JOIN files ON %[1]s.file_id = files.id
+		WHERE %[1]s MATCH ?`, table)
+
 	args := []interface{}{pattern}
 	if len(books) > 0 {
-		args = append(args, books)
+		query += fmt.Sprintf(" AND file_id IN (%s)", strings.TrimSuffix(strings.Repeat("?,", len(books)), ","))
+		for _, book := range books {
+			args = append(args, book)
+		}
 	}
-	rows, err := db.QueryContext(ctx, query, args...)
+
+	if len(condition) == 2 {
+		query += fmt.Sprintf(" AND %s", condition[0])
+		args = append(args, condition[1])
+	}
+
+	access, accessArgs := s.accessible("files.sha256")
+	query += " AND " + access
+	args = append(args, accessArgs...)
+	query += fmt.Sprintf(" ORDER BY rank LIMIT %d", maxResults)
+
+	results := []SearchResult{}
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -205,7 +359,7 @@ func Search(ctx context.Context, pattern string, books ...int) ([]SearchResult,
 
 	for rows.Next() {
 		var result SearchResult
-		err := rows.Scan(&result.FileID, &result.PageNum, &result.Title, &result.Text, &result.BaseName)
+		err := rows.Scan(&result.FileID, &result.PageNum, &result.Title, &result.Text, &result.BaseName, &result.rank)
 		if err != nil {
 			return nil, err
 		}
@@ -219,57 +373,154 @@ func Search(ctx context.Context, pattern string, books ...int) ([]SearchResult,
 	return results, nil
 }
 
-// Insert a page into the pages table.
-func InsertPage(ctx context.Context, page Page) error {
-	query := `INSERT INTO pages (file_id, page_num, text) VALUES($1, $2, $3) 
-			  ON CONFLICT(file_id, page_num) IGNORE`
-	tx, err := db.Begin()
+// UpdateTrigramIndex copies the pages of the files that are not yet in the
+// trigram index from the pages tables of all languages.
+func (s *Store) UpdateTrigramIndex(ctx context.Context) error {
+	query := `INSERT INTO pages_trigram (file_id, page_num, text)
+		SELECT file_id, page_num, text FROM (
+			SELECT file_id, page_num, text FROM pages
+			UNION ALL
+			SELECT file_id, page_num, text FROM pages_intl
+		)
+		WHERE file_id NOT IN (SELECT DISTINCT file_id FROM pages_trigram)`
+
+	result, err := s.db.ExecContext(ctx, query)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	_, err = tx.ExecContext(ctx, query, page.FileID, page.PageNum, page.Text)
+	numPages, _ := result.RowsAffected()
+	log.Printf("Inserted %d pages into the trigram index\n", numPages)
+	return nil
+}
+
+// HasTrigramIndex reports whether the trigram index has been populated.
+func (s *Store) HasTrigramIndex(ctx context.Context) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM pages_trigram)`).Scan(&exists)
+	return exists, err
+}
+
+// Insert a page into the pages table of its language.
+func (s *Store) InsertPage(ctx context.Context, page Page) error {
+	return s.InsertPagesOneByOne(ctx, []Page{page})
+}
+
+// Insert multiple pages into the pages tables of their language one by one.
+func (s *Store) InsertPagesOneByOne(ctx context.Context, pages []Page) error {
+	err := s.EnsureVocabulary(ctx)
 	if err != nil {
 		return err
 	}
-	return tx.Commit()
-}
 
-// Insert multiple pages into the pages table at once.
-func InsertPagesOneByOne(ctx context.Context, pages []Page) error {
-	query := `INSERT INTO pages (file_id, page_num, text) VALUES($1, $2, $3)`
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	for _, page := range pages {
-		_, err := tx.ExecContext(ctx, query, page.FileID, page.PageNum, page.Text)
+		err := insertPage(ctx, tx, page)
 		if err != nil {
 			return err
 		}
 	}
-	return tx.Commit()
-}
 
-func InsertPages(ctx context.Context, pages []Page) error {
-	tx, err := db.BeginTx(ctx, nil)
+	err = addPageTerms(ctx, tx, pages)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	return tx.Commit()
+}
+
+func insertPage(ctx context.Context, tx *sql.Tx, page Page) error {
+	var err error
+	if isEnglish(page.Language) {
+		query := `INSERT INTO pages (file_id, page_num, text) VALUES($1, $2, $3)`
+		_, err = tx.ExecContext(ctx, query, page.FileID, page.PageNum, page.Text)
+	} else {
+		query := `INSERT INTO pages_intl (file_id, page_num, text, lang) VALUES($1, $2, $3, $4)`
+		_, err = tx.ExecContext(ctx, query, page.FileID, page.PageNum, page.Text, page.Language)
+	}
+	return err
+}
+
+// Pages without a detected language are treated as English.
+func isEnglish(lang string) bool {
+	return lang == "" || lang == language.English
+}
 
+// Language of file, English if it was not detected.
+func fileLanguage(file File) string {
+	if file.Language == "" {
+		return language.English
+	}
+	return file.Language
+}
+
+// Insert pages into the pages tables of their language in batches and add
+// their terms to the vocabulary.
+func (s *Store) InsertPages(ctx context.Context, pages []Page) error {
 	numPages := len(pages)
 	if numPages == 0 {
 		return nil
 	}
 
+	err := s.EnsureVocabulary(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	log.Printf("Storing %d pages into the database. This may take a minute or two!!", numPages)
+
+	// English pages go to the pages table, the others to pages_intl.
+	englishPages := []Page{}
+	intlPages := []Page{}
+	for _, page := range pages {
+		if isEnglish(page.Language) {
+			englishPages = append(englishPages, page)
+		} else {
+			intlPages = append(intlPages, page)
+		}
+	}
+
+	err = insertPageBatches(ctx, tx, "pages (file_id, page_num, text)", englishPages, false)
+	if err != nil {
+		return err
+	}
+
+	err = insertPageBatches(ctx, tx, "pages_intl (file_id, page_num, text, lang)", intlPages, true)
+	if err != nil {
+		return err
+	}
+
+	err = addPageTerms(ctx, tx, pages)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Inserted %d pages into the database\n", numPages)
+	return nil
+}
+
+// Insert pages into table in batches.
+// withLanguage adds the language of the page as the last column.
+func insertPageBatches(ctx context.Context, tx *sql.Tx, table string, pages []Page, withLanguage bool) error {
 	// Split pages into batches
 	// This is done to avoid hitting the SQLITE_MAX_VARIABLE_NUMBER limit of 999
 	batchSize := 500
+	numPages := len(pages)
 	for i := 0; i < numPages; i += batchSize {
 		end := i + batchSize
 		if end > numPages {
@@ -277,8 +528,8 @@ func InsertPages(ctx context.Context, pages []Page) error {
 		}
 
 		batch := pages[i:end]
-		placeholders, args := pageValueTuple(&batch)
-		query := fmt.Sprintf("INSERT INTO pages (file_id, page_num, text) VALUES %s", placeholders)
+		placeholders, args := pageValueTuple(&batch, withLanguage)
+		query := fmt.Sprintf("INSERT INTO %s VALUES %s", table, placeholders)
 		stmt, err := tx.PrepareContext(ctx, query)
 		if err != nil {
 			return err
@@ -290,23 +541,21 @@ func InsertPages(ctx context.Context, pages []Page) error {
 			return err
 		}
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Inserted %d pages into the database\n", numPages)
 	return nil
 }
 
-func pageValueTuple(pages *[]Page) (string, []interface{}) {
+func pageValueTuple(pages *[]Page, withLanguage bool) (string, []interface{}) {
 	query := ""
 	var args []interface{}
 	for _, page := range *pages {
 		// Use placeholders for values
-		query += "(?, ?, ?),"
-		args = append(args, page.FileID, page.PageNum, page.Text)
+		if withLanguage {
+			query += "(?, ?, ?, ?),"
+			args = append(args, page.FileID, page.PageNum, page.Text, page.Language)
+		} else {
+			query += "(?, ?, ?),"
+			args = append(args, page.FileID, page.PageNum, page.Text)
+		}
 	}
 	// Remove trailing comma
 	query = strings.TrimSuffix(query, ",")
@@ -319,8 +568,8 @@ func fileValueTuple(files *[]File) (string, []interface{}) {
 	var args []interface{}
 	for _, file := range *files {
 		// Use placeholders for values
-		query += "(?, ?, ?),"
-		args = append(args, file.ID, file.Name, file.Path)
+		query += "(?, ?, ?, ?, ?, CURRENT_TIMESTAMP),"
+		args = append(args, file.ID, file.Name, file.Path, fileLanguage(file), file.SHA256)
 	}
 	// Remove trailing comma
 	query = strings.TrimSuffix(query, ",")
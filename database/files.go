@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Pages with fewer characters than this are counted as empty. They are
+// usually scanned images without a text layer.
+const minPageCharacters = 20
+
+// A file with statistics on the text extracted from it.
+type FileStats struct {
+	File
+	Pages      int // Number of indexed pages
+	EmptyPages int // Pages without text, e.g. scanned images
+	Characters int // Number of characters of text
+}
+
+// GetFileStats returns every file of the index with the statistics of
+// its pages, ordered by name.
+func (s *Store) GetFileStats(ctx context.Context) ([]FileStats, error) {
+	return s.fileStats(ctx, "1")
+}
+
+// GetFileStatsByID returns a file of the index with the statistics of its pages.
+func (s *Store) GetFileStatsByID(ctx context.Context, fileId int) (FileStats, error) {
+	stats, err := s.fileStats(ctx, "files.id = ?", fileId)
+	if err != nil {
+		return FileStats{}, err
+	}
+
+	if len(stats) == 0 {
+		return FileStats{}, fmt.Errorf("no file with id %d", fileId)
+	}
+	return stats[0], nil
+}
+
+// Query the files matching condition with the statistics of their pages.
+func (s *Store) fileStats(ctx context.Context, condition string, args ...any) ([]FileStats, error) {
+	access, accessArgs := s.accessible("files.sha256")
+	args = append(args, accessArgs...)
+
+	query := fmt.Sprintf(`SELECT files.id, files.name, files.path, files.language, COALESCE(files.indexed_at, ''),
+		COUNT(p.file_id), COALESCE(SUM(length(trim(p.text)) < %d), 0), COALESCE(SUM(length(p.text)), 0)
+		FROM files
+		LEFT JOIN (SELECT file_id, text FROM pages UNION ALL SELECT file_id, text FROM pages_intl) AS p
+		ON p.file_id = files.id
+		WHERE %s AND %s
+		GROUP BY files.id
+		ORDER BY files.name`, minPageCharacters, condition, access)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []FileStats{}
+	for rows.Next() {
+		var f FileStats
+		err := rows.Scan(&f.ID, &f.Name, &f.Path, &f.Language, &f.IndexedAt, &f.Pages, &f.EmptyPages, &f.Characters)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, f)
+	}
+	return stats, rows.Err()
+}
+
+// RemoveFiles deletes files and their pages from every table of the index
+// in a single transaction and subtracts their terms from the vocabulary.
+func (s *Store) RemoveFiles(ctx context.Context, fileIds ...int) error {
+	if len(fileIds) == 0 {
+		return nil
+	}
+
+	err := s.EnsureVocabulary(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(fileIds)), ",")
+	args := make([]any, len(fileIds))
+	for i, id := range fileIds {
+		args[i] = id
+	}
+
+	err = removeFileTerms(ctx, tx, placeholders, args)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range ftsTables {
+		query := fmt.Sprintf("DELETE FROM %s WHERE file_id IN (%s)", table, placeholders)
+		_, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("unable to delete pages from %s: %w", table, err)
+		}
+	}
+
+	query := fmt.Sprintf("DELETE FROM files WHERE id IN (%s)", placeholders)
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Subtract the terms of the pages of the files given by placeholders and
+// args from the vocabulary.
+func removeFileTerms(ctx context.Context, tx *sql.Tx, placeholders string, args []any) error {
+	query := fmt.Sprintf(`SELECT text FROM pages WHERE file_id IN (%[1]s)
+		UNION ALL SELECT text FROM pages_intl WHERE file_id IN (%[1]s)`, placeholders)
+	rows, err := tx.QueryContext(ctx, query, append(args, args...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	words := make(map[string]int)
+	phrases := make(map[string]int)
+	for rows.Next() {
+		var text string
+		err := rows.Scan(&text)
+		if err != nil {
+			return err
+		}
+		countTerms(text, words, phrases)
+	}
+
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	return updateVocabulary(ctx, tx, words, phrases, -1)
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFileStatsAndRemove(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{
+		{ID: 1, Name: "a.pdf", Path: "/a.pdf", Language: "en"},
+		{ID: 2, Name: "b.pdf", Path: "/b.pdf", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.InsertPages(ctx, []Page{
+		{FileID: 1, PageNum: 0, Text: "acute myocardial infarction", Language: "en"},
+		{FileID: 1, PageNum: 1, Text: " ", Language: "en"},
+		{FileID: 2, PageNum: 0, Text: "les infections graves", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UpdateTrigramIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.GetFileStatsByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Pages != 2 || stats.EmptyPages != 1 || stats.IndexedAt == "" {
+		t.Fatalf("expected 2 pages, 1 empty and an indexing time, got %+v", stats)
+	}
+
+	if err := s.RemoveFiles(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.GetFileStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 0 {
+		t.Fatalf("expected no files left, got %+v", all)
+	}
+
+	var pages int
+	err = s.db.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM pages) + (SELECT COUNT(*) FROM pages_intl) + (SELECT COUNT(*) FROM pages_trigram)`).Scan(&pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pages != 0 {
+		t.Fatalf("expected the pages to be removed from every table, %d left", pages)
+	}
+}
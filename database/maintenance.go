@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// FTS5 tables of the pages. Incremental inserts add segments to them
+// that slow searches down until they are merged by Optimize.
+var ftsTables = []string{"pages", "pages_intl", "pages_trigram"}
+
+// Number of books listed in Stats.LargestBooks.
+const numLargestBooks = 10
+
+// Statistics of the index.
+type Stats struct {
+	Documents int   // Number of indexed files
+	Pages     int   // Number of pages in all languages
+	Tokens    int   // Number of words in all the pages
+	Terms     int   // Number of distinct (stemmed) words
+	Size      int64 // Size of the database file in bytes, excluding the WAL
+	FreeSize  int64 // Bytes of unused pages, reclaimed by Vacuum
+
+	LargestBooks []BookStats // Books with the most text, largest first
+}
+
+// Size of a book in the index.
+type BookStats struct {
+	File
+	Pages      int // Number of pages
+	Characters int // Number of characters of text
+}
+
+// Optimize merges the segments of every FTS5 table into one, which makes
+// searches faster after many incremental inserts, then checkpoints the WAL.
+// It may take a while on large indexes.
+func (s *Store) Optimize(ctx context.Context) error {
+	for _, table := range ftsTables {
+		query := fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES('optimize')`, table)
+		_, err := s.db.ExecContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("unable to optimize %s: %w", table, err)
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, `PRAGMA optimize`)
+	if err != nil {
+		return err
+	}
+	return s.Checkpoint(ctx)
+}
+
+// Vacuum rebuilds the database file to reclaim the space of deleted pages.
+// Needs as much free disk space as the size of the database.
+func (s *Store) Vacuum(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `VACUUM`)
+	if err != nil {
+		return err
+	}
+	return s.Checkpoint(ctx)
+}
+
+// Checkpoint copies the content of the WAL into the database file and
+// truncates the WAL.
+func (s *Store) Checkpoint(ctx context.Context) error {
+	var busy, logFrames, checkpointed int
+	err := s.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return err
+	}
+
+	if busy != 0 {
+		log.Printf("WAL checkpoint incomplete: the database is in use\n")
+	}
+	return nil
+}
+
+// Check verifies the integrity of the database file and of the FTS5 indexes.
+// Returns the problems found, none if the database is healthy.
+func (s *Store) Check(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var message string
+		err := rows.Scan(&message)
+		if err != nil {
+			return nil, err
+		}
+
+		if message != "ok" {
+			problems = append(problems, message)
+		}
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	// The FTS5 integrity-check command fails if the index does not
+	// match the content of the table.
+	for _, table := range ftsTables {
+		query := fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES('integrity-check')`, table)
+		_, err := s.db.ExecContext(ctx, query)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", table, err))
+		}
+	}
+	return problems, nil
+}
+
+// Stats returns statistics on the content and size of the index.
+func (s *Store) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	query := `SELECT
+		(SELECT COUNT(*) FROM files),
+		(SELECT COUNT(*) FROM pages) + (SELECT COUNT(*) FROM pages_intl),
+		(SELECT COALESCE(SUM(cnt), 0) FROM pages_vocab) + (SELECT COALESCE(SUM(cnt), 0) FROM pages_intl_vocab),
+		(SELECT COUNT(*) FROM pages_vocab) + (SELECT COUNT(*) FROM pages_intl_vocab)`
+
+	err := s.db.QueryRowContext(ctx, query).Scan(&stats.Documents, &stats.Pages, &stats.Tokens, &stats.Terms)
+	if err != nil {
+		return stats, err
+	}
+
+	var pageSize, pageCount, freePages int64
+	err = s.db.QueryRowContext(ctx, `SELECT page_size, page_count, freelist_count
+		FROM pragma_page_size, pragma_page_count, pragma_freelist_count`).Scan(&pageSize, &pageCount, &freePages)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Size = pageSize * pageCount
+	stats.FreeSize = pageSize * freePages
+
+	stats.LargestBooks, err = s.largestBooks(ctx, numLargestBooks)
+	return stats, err
+}
+
+// The limit books with the most characters of text.
+func (s *Store) largestBooks(ctx context.Context, limit int) ([]BookStats, error) {
+	query := `SELECT files.id, files.name, files.path, files.language, COUNT(*), SUM(length(text)) AS characters
+		FROM (SELECT file_id, text FROM pages UNION ALL SELECT file_id, text FROM pages_intl) AS p
+		JOIN files ON files.id = p.file_id
+		GROUP BY files.id
+		ORDER BY characters DESC
+		LIMIT $1`
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []BookStats{}
+	for rows.Next() {
+		var book BookStats
+		err := rows.Scan(&book.ID, &book.Name, &book.Path, &book.Language, &book.Pages, &book.Characters)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	s := openStore(t)
+	ctx := context.Background()
+
+	if err := s.Migrate(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.InsertFiles(ctx, []File{
+		{ID: 1, Name: "a.pdf", Path: "/a.pdf", Language: "en"},
+		{ID: 2, Name: "b.pdf", Path: "/b.pdf", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert the pages one at a time to create several segments.
+	pages := []Page{
+		{FileID: 1, PageNum: 0, Text: "myocardial infarction", Language: "en"},
+		{FileID: 1, PageNum: 1, Text: "acute myocardial infarction and heart failure", Language: "en"},
+		{FileID: 2, PageNum: 0, Text: "les infections graves", Language: "fr"},
+	}
+	for _, page := range pages {
+		if err := s.InsertPage(ctx, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Optimize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Vacuum(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := s.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(problems) > 0 {
+		t.Fatalf("expected a healthy database, got %v", problems)
+	}
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Documents != 2 || stats.Pages != 3 || stats.Tokens != 11 {
+		t.Fatalf("expected 2 documents, 3 pages and 11 tokens, got %+v", stats)
+	}
+
+	if len(stats.LargestBooks) != 2 || stats.LargestBooks[0].ID != 1 || stats.LargestBooks[0].Pages != 2 {
+		t.Fatalf("expected a.pdf with 2 pages to be the largest book, got %+v", stats.LargestBooks)
+	}
+
+	results, err := s.Search(ctx, "infarction")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results after optimizing, got %d", len(results))
+	}
+}
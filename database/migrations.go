@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Forward migrations of the schema, applied in order of their version.
+// Files are named <version>_<name>.sql, e.g. 0001_initial.sql.
+// Never edit a migration once released, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationsFs embed.FS
+
+// A Migration of the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// A Migration and whether it was applied to the database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt string // UTC time the migration was applied, empty if pending
+}
+
+// Migrations returns the migrations embedded in the binary, sorted by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFs, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	for _, entry := range entries {
+		version, name, found := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		versionInt, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		sql, err := migrationsFs.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: versionInt,
+			Name:    name,
+			SQL:     string(sql),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Create the table that records the applied migrations.
+func (s *Store) createSchemaVersionTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_version(
+		version INTEGER NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	return err
+}
+
+// SchemaVersion returns the version of the last migration applied to
+// the database, 0 for a new database.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	err := s.createSchemaVersionTable(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// LatestSchemaVersion returns the version of the last embedded migration.
+func LatestSchemaVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Migrate applies the pending migrations up to and including version target.
+// If target is 0, all the pending migrations are applied.
+// Each migration runs in its own transaction, so a failed migration leaves
+// the database at the previous version.
+func (s *Store) Migrate(ctx context.Context, target int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d: upgrade pdfsearch", current, latest)
+	}
+
+	if target == 0 {
+		target = latest
+	}
+
+	if target < current {
+		return fmt.Errorf("database is at version %d: migrating down to %d is not supported", current, target)
+	}
+
+	if target > latest {
+		return fmt.Errorf("unknown schema version %d, the latest is %d", target, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+
+		log.Printf("Applying migration %04d_%s\n", m.Version, m.Name)
+		err := s.applyMigration(ctx, m)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply m and record its version in a single transaction.
+func (s *Store) applyMigration(ctx context.Context, m Migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, m.SQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_version (version, name) VALUES($1, $2)`, m.Version, m.Name)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMigrationStatus returns every embedded migration and whether it was
+// applied to the database.
+func (s *Store) GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.createSchemaVersionTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
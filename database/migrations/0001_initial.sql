@@ -0,0 +1,18 @@
+-- Files and pages as created by pdfsearch before versioned migrations.
+-- IF NOT EXISTS lets this run on those databases too.
+CREATE TABLE IF NOT EXISTS files(
+	id INTEGER NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL UNIQUE
+);
+
+-- Virtual tables do not support primary key.
+-- See official documentation for more information: https://www.sqlite.org/fts5.html
+-- tokenize='porter unicode61 remove_diacritics 2' uses the porter stemmer,
+-- unicode61 tokenization, and removes diacritics.
+CREATE VIRTUAL TABLE IF NOT EXISTS pages USING fts5(
+	file_id UNINDEXED,
+	page_num UNINDEXED,
+	text,
+	tokenize='porter unicode61 remove_diacritics 2'
+);
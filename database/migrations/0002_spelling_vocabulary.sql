@@ -0,0 +1,4 @@
+-- Vocabulary of the pages table, one row per distinct (stemmed) term.
+-- Used to suggest spelling corrections for queries with few hits.
+-- See https://www.sqlite.org/fts5.html#the_fts5vocab_virtual_table_module
+CREATE VIRTUAL TABLE IF NOT EXISTS pages_vocab USING fts5vocab(pages, row);
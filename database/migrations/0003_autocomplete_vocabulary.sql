@@ -0,0 +1,6 @@
+-- Precomputed words and phrases with their frequencies for autocompletion.
+-- WITHOUT ROWID keeps the rows ordered by term for fast prefix range scans.
+CREATE TABLE IF NOT EXISTS vocabulary(
+	term TEXT NOT NULL PRIMARY KEY,
+	frequency INTEGER NOT NULL
+) WITHOUT ROWID;
@@ -0,0 +1,10 @@
+-- Optional secondary index with the trigram tokenizer for substring matches.
+-- It is only populated when indexing with --trigram since it is much larger
+-- than the pages table. Requires SQLite 3.34 or later.
+-- See https://www.sqlite.org/fts5.html#the_trigram_tokenizer
+CREATE VIRTUAL TABLE IF NOT EXISTS pages_trigram USING fts5(
+	file_id UNINDEXED,
+	page_num UNINDEXED,
+	text,
+	tokenize='trigram'
+);
@@ -0,0 +1,15 @@
+-- Documents indexed before language detection were all stemmed as English.
+ALTER TABLE files ADD COLUMN language TEXT NOT NULL DEFAULT 'en';
+
+-- Pages of documents that are not in English. The porter stemmer only
+-- knows English, so these are tokenized without stemming and searched
+-- with prefixes of stems from the language package instead.
+CREATE VIRTUAL TABLE IF NOT EXISTS pages_intl USING fts5(
+	file_id UNINDEXED,
+	page_num UNINDEXED,
+	text,
+	lang UNINDEXED,
+	tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS pages_intl_vocab USING fts5vocab(pages_intl, row);
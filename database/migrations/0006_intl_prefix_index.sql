@@ -0,0 +1,21 @@
+-- Pages in languages other than English are searched with prefix queries.
+-- Add prefix indexes to make them fast.
+--
+-- FTS5 tables cannot be altered, so the table is rebuilt in place:
+-- create the new definition, copy the rows, drop the old table and rename.
+-- pages_intl_vocab refers to the table by name and keeps working.
+CREATE VIRTUAL TABLE pages_intl_new USING fts5(
+	file_id UNINDEXED,
+	page_num UNINDEXED,
+	text,
+	lang UNINDEXED,
+	tokenize='unicode61 remove_diacritics 2',
+	prefix='3 4 5'
+);
+
+INSERT INTO pages_intl_new (rowid, file_id, page_num, text, lang)
+SELECT rowid, file_id, page_num, text, lang FROM pages_intl;
+
+DROP TABLE pages_intl;
+
+ALTER TABLE pages_intl_new RENAME TO pages_intl;
@@ -0,0 +1,4 @@
+-- Time each file was indexed, in UTC. Unknown for files indexed before
+-- this migration. ALTER TABLE cannot add a column with a CURRENT_TIMESTAMP
+-- default, so it is set by the inserts instead.
+ALTER TABLE files ADD COLUMN indexed_at TEXT;
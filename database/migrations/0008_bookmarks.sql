@@ -0,0 +1,42 @@
+-- Hex encoded SHA-256 hash of the content of each file. File ids are hashes
+-- of the paths, which change when a library is moved, so bookmarks refer to
+-- documents by their content instead. Empty for files indexed before this
+-- migration until they are bookmarked.
+ALTER TABLE files ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS files_sha256 ON files(sha256);
+
+-- Bookmarked pages with an optional note. name is the file name of the
+-- document when it was bookmarked, shown if it is no longer indexed.
+-- Bookmarks are not deleted with the files, so they survive reindexing.
+CREATE TABLE IF NOT EXISTS bookmarks(
+	id INTEGER PRIMARY KEY,
+	document TEXT NOT NULL,
+	page_num INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(document, page_num)
+);
+
+-- Full-text index of the notes, kept in sync with the bookmarks by triggers.
+CREATE VIRTUAL TABLE IF NOT EXISTS notes USING fts5(
+	note,
+	content='bookmarks',
+	content_rowid='id',
+	tokenize='porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_insert AFTER INSERT ON bookmarks BEGIN
+	INSERT INTO notes (rowid, note) VALUES (new.id, new.note);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_delete AFTER DELETE ON bookmarks BEGIN
+	INSERT INTO notes (notes, rowid, note) VALUES ('delete', old.id, old.note);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_update AFTER UPDATE OF note ON bookmarks BEGIN
+	INSERT INTO notes (notes, rowid, note) VALUES ('delete', old.id, old.note);
+	INSERT INTO notes (rowid, note) VALUES (new.id, new.note);
+END;
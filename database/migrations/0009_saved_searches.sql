@@ -0,0 +1,29 @@
+-- Searches re-run after every update of the index to find new pages.
+-- book is the only file searched, 0 for all files. checked_at is the UTC
+-- time the search was last run.
+CREATE TABLE IF NOT EXISTS saved_searches(
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	query TEXT NOT NULL,
+	lang TEXT NOT NULL DEFAULT '',
+	mode TEXT NOT NULL DEFAULT 'fulltext',
+	expand INTEGER NOT NULL DEFAULT 1,
+	book INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	checked_at TEXT
+);
+
+-- Pages matched by the saved searches. The pages matched when a search is
+-- saved are not new. Pages matched by later runs are new until seen.
+CREATE TABLE IF NOT EXISTS saved_search_matches(
+	search_id INTEGER NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+	file_id INTEGER NOT NULL,
+	page_num INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	snippet TEXT NOT NULL,
+	new INTEGER NOT NULL DEFAULT 0,
+	found_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(search_id, file_id, page_num)
+);
+
+CREATE INDEX IF NOT EXISTS saved_search_matches_new ON saved_search_matches(search_id, new);
@@ -0,0 +1,21 @@
+-- Searches of the web interface, only recorded if query logging is enabled.
+-- book is the only file searched, 0 for all files. hits is the number of
+-- results and latency_ms the time taken to search. clicks is the number of
+-- results opened, the last of which is clicked_file_id, clicked_page_num.
+CREATE TABLE IF NOT EXISTS query_log(
+	id INTEGER PRIMARY KEY,
+	query TEXT NOT NULL,
+	lang TEXT NOT NULL DEFAULT '',
+	mode TEXT NOT NULL DEFAULT 'fulltext',
+	expand INTEGER NOT NULL DEFAULT 1,
+	notes INTEGER NOT NULL DEFAULT 0,
+	book INTEGER NOT NULL DEFAULT 0,
+	hits INTEGER NOT NULL,
+	latency_ms INTEGER NOT NULL,
+	clicks INTEGER NOT NULL DEFAULT 0,
+	clicked_file_id INTEGER,
+	clicked_page_num INTEGER,
+	searched_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS query_log_searched_at ON query_log(searched_at);
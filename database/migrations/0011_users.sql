@@ -0,0 +1,71 @@
+-- Local accounts. password_hash is a bcrypt hash. role is user or admin.
+CREATE TABLE IF NOT EXISTS users(
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'user',
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions of the users logged in with a cookie. Only the SHA-256 hash of
+-- the token of the cookie is stored. expires_at is a UTC time.
+CREATE TABLE IF NOT EXISTS sessions(
+	token_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions(user_id);
+
+-- Tokens of the scripts using the API. Only their SHA-256 hash is stored.
+CREATE TABLE IF NOT EXISTS api_tokens(
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TEXT
+);
+
+-- Bookmarks and logged searches belong to a user, 0 for those made without
+-- authentication. The bookmarks table is recreated to make a page unique per
+-- user. The ids are kept, so the notes index stays valid.
+DROP TRIGGER IF EXISTS bookmarks_insert;
+DROP TRIGGER IF EXISTS bookmarks_delete;
+DROP TRIGGER IF EXISTS bookmarks_update;
+
+CREATE TABLE bookmarks_new(
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL DEFAULT 0,
+	document TEXT NOT NULL,
+	page_num INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, document, page_num)
+);
+
+INSERT INTO bookmarks_new (id, document, page_num, name, note, created_at, updated_at)
+	SELECT id, document, page_num, name, note, created_at, updated_at FROM bookmarks;
+
+DROP TABLE bookmarks;
+ALTER TABLE bookmarks_new RENAME TO bookmarks;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_insert AFTER INSERT ON bookmarks BEGIN
+	INSERT INTO notes (rowid, note) VALUES (new.id, new.note);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_delete AFTER DELETE ON bookmarks BEGIN
+	INSERT INTO notes (notes, rowid, note) VALUES ('delete', old.id, old.note);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_update AFTER UPDATE OF note ON bookmarks BEGIN
+	INSERT INTO notes (notes, rowid, note) VALUES ('delete', old.id, old.note);
+	INSERT INTO notes (rowid, note) VALUES (new.id, new.note);
+END;
+
+ALTER TABLE query_log ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS query_log_user_id ON query_log(user_id, id);
@@ -0,0 +1,46 @@
+-- Collections of documents. The documents of a restricted collection are
+-- only accessible to the admins and to the users granted access to it,
+-- directly or through a group. Like the bookmarks, collections refer to
+-- documents by the hash of their content, so that they stay restricted
+-- when they are moved or reindexed.
+CREATE TABLE IF NOT EXISTS collections(
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	restricted INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS collection_files(
+	collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+	document TEXT NOT NULL,
+	PRIMARY KEY (collection_id, document)
+);
+
+CREATE INDEX IF NOT EXISTS collection_files_document ON collection_files(document);
+
+-- Named groups of users, granted access to collections together.
+CREATE TABLE IF NOT EXISTS user_groups(
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE
+);
+
+CREATE TABLE IF NOT EXISTS group_members(
+	group_id INTEGER NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_members_user_id ON group_members(user_id);
+
+-- The users and groups granted access to the collections.
+CREATE TABLE IF NOT EXISTS collection_users(
+	collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (collection_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS collection_groups(
+	collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+	group_id INTEGER NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+	PRIMARY KEY (collection_id, group_id)
+);
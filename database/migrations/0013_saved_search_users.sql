@@ -0,0 +1,42 @@
+-- Saved searches belong to a user, 0 for those saved without
+-- authentication, and their names are unique per user. Both tables are
+-- recreated: the name of a search is no longer unique and the matches
+-- reference the new table. The ids are kept.
+CREATE TABLE saved_searches_copy(
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL DEFAULT 0,
+	name TEXT NOT NULL,
+	query TEXT NOT NULL,
+	lang TEXT NOT NULL DEFAULT '',
+	mode TEXT NOT NULL DEFAULT 'fulltext',
+	expand INTEGER NOT NULL DEFAULT 1,
+	book INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	checked_at TEXT,
+	UNIQUE(user_id, name)
+);
+
+INSERT INTO saved_searches_copy (id, user_id, name, query, lang, mode, expand, book, created_at, checked_at)
+	SELECT id, (SELECT COALESCE(MIN(id), 0) FROM users), name, query, lang, mode, expand, book, created_at, checked_at
+	FROM saved_searches;
+
+CREATE TABLE saved_search_matches_copy(
+	search_id INTEGER NOT NULL REFERENCES saved_searches_copy(id) ON DELETE CASCADE,
+	file_id INTEGER NOT NULL,
+	page_num INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	snippet TEXT NOT NULL,
+	new INTEGER NOT NULL DEFAULT 0,
+	found_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(search_id, file_id, page_num)
+);
+
+INSERT INTO saved_search_matches_copy SELECT search_id, file_id, page_num, name, snippet, new, found_at
+	FROM saved_search_matches;
+
+DROP TABLE saved_search_matches;
+DROP TABLE saved_searches;
+ALTER TABLE saved_searches_copy RENAME TO saved_searches;
+ALTER TABLE saved_search_matches_copy RENAME TO saved_search_matches;
+
+CREATE INDEX IF NOT EXISTS saved_search_matches_new ON saved_search_matches(search_id, new);
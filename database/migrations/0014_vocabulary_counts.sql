@@ -0,0 +1,4 @@
+-- The vocabulary now keeps every term with its count so it can be updated
+-- as pages are inserted and removed. The old one left out the rare terms and
+-- is emptied to be rebuilt with their counts.
+DELETE FROM vocabulary;
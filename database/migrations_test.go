@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// Open a store in a temporary file, closed when the test ends.
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "pdfsearch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	s := openStore(t)
+	ctx := context.Background()
+
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Migrate(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 2 {
+		t.Fatalf("expected version 2, got %d", version)
+	}
+
+	if err := s.Migrate(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := s.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Fatalf("expected migration %d to be applied", status.Version)
+		}
+	}
+
+	if err := s.Migrate(ctx, 1); err == nil {
+		t.Fatal("expected an error when migrating down")
+	}
+
+	if err := s.Migrate(ctx, latest+1); err == nil {
+		t.Fatal("expected an error for an unknown version")
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	s := openStore(t)
+	ctx := context.Background()
+
+	// Schema created by CreateTables before migrations existed.
+	_, err := s.db.Exec(`
+	CREATE TABLE files(id INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, path TEXT NOT NULL UNIQUE);
+	CREATE VIRTUAL TABLE pages USING fts5(file_id UNINDEXED, page_num UNINDEXED, text,
+		tokenize='porter unicode61 remove_diacritics 2');
+	INSERT INTO files VALUES(1, 'a.pdf', '/a.pdf');
+	INSERT INTO pages VALUES(1, 0, 'myocardial infarction');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Migrate(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := s.GetFile(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Language != "en" {
+		t.Fatalf("expected existing files to be English, got %q", file.Language)
+	}
+
+	results, err := s.Search(ctx, "infarction")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+}
+
+func TestRebuiltFTSTableKeepsRows(t *testing.T) {
+	s := openStore(t)
+	ctx := context.Background()
+
+	// Insert a French page before the migration that rebuilds pages_intl.
+	if err := s.Migrate(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Raw inserts since the Store methods use the columns of the latest schema.
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO files (id, name, path, language) VALUES(1, 'a.pdf', '/a.pdf', 'fr');
+	INSERT INTO pages_intl (file_id, page_num, text, lang) VALUES(1, 3, 'les infections graves', 'fr');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Migrate(ctx, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.SearchInLanguage(ctx, "infections", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].PageNum != 3 {
+		t.Fatalf("expected page 3 to survive the rebuild, got %v", results)
+	}
+}
+
+func TestSavedSearchesGetAnOwner(t *testing.T) {
+	s := openStore(t)
+	ctx := context.Background()
+
+	if err := s.Migrate(ctx, 12); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO users (id, name, password_hash) VALUES(3, 'alice', '');
+	INSERT INTO saved_searches (id, name, query) VALUES(7, 'mi', 'infarction');
+	INSERT INTO saved_search_matches (search_id, file_id, page_num, name, snippet, new) VALUES(7, 1, 0, 'a.pdf', '', 1);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Migrate(ctx, 13); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.CountNewMatches(ctx, 3); err != nil || n != 1 {
+		t.Fatalf("expected the first user to own the search and its match, got %d, %v", n, err)
+	}
+
+	// The matches still reference the saved searches.
+	if err := s.DeleteSavedSearch(ctx, 3, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM saved_search_matches`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected the matches to be deleted, got %d, %v", n, err)
+	}
+
+	var references string
+	err = s.db.QueryRowContext(ctx, `SELECT "table" FROM pragma_foreign_key_list('saved_search_matches')`).Scan(&references)
+	if err != nil || references != "saved_searches" {
+		t.Fatalf("expected the matches to reference saved_searches, got %q, %v", references, err)
+	}
+}
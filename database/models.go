@@ -2,9 +2,12 @@ package database
 
 // Store files with their base name and path to the file system.
 type File struct {
-	ID   int
-	Name string
-	Path string
+	ID        int
+	Name      string
+	Path      string
+	Language  string // ISO 639-1 code of the detected language
+	IndexedAt string // UTC time the file was indexed, empty if unknown
+	SHA256    string // Hex encoded hash of the content, empty if unknown
 }
 
 // A page in a file. Related by FileID.
@@ -12,6 +15,9 @@ type Page struct {
 	FileID  int    //  ID of the file this page belongs to.
 	PageNum int    // 0-indexed page number.
 	Text    string // Full text of the page.
+
+	// Language of the document, decides the table and tokenizer used.
+	Language string
 }
 
 // A snippet of text from a page. Related by FileID and PageNum.
@@ -21,4 +27,7 @@ type SearchResult struct {
 	Title    string // Snippet representing the title of the match
 	Text     string // Snippet of text from the page
 	BaseName string // Filebase name of the file
+	Note     bool   // Whether the match is in the note of a bookmark, in Text
+
+	rank float64 // bm25 rank of the match, lower is better
 }
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/abiiranathan/pdfsearch/language"
+)
+
+// GetPage returns a page of a file in any language.
+func (s *Store) GetPage(ctx context.Context, fileId, pageNum int) (Page, error) {
+	if err := s.checkAccess(ctx, fileId); err != nil {
+		return Page{}, err
+	}
+
+	query := `SELECT file_id, page_num, text, 'en' FROM pages WHERE file_id = $1 AND page_num = $2
+		UNION ALL
+		SELECT file_id, page_num, text, lang FROM pages_intl WHERE file_id = $1 AND page_num = $2
+		LIMIT 1`
+
+	var page Page
+	err := s.db.QueryRowContext(ctx, query, fileId, pageNum).Scan(&page.FileID, &page.PageNum, &page.Text, &page.Language)
+	return page, err
+}
+
+// HighlightPage returns the full text of a page with the matches of query
+// between open and close, e.g. <b> and </b>. If query is empty or does not
+// match the page, the text is returned as it is.
+func (s *Store) HighlightPage(ctx context.Context, fileId, pageNum int, query, open, close string) (string, error) {
+	page, err := s.GetPage(ctx, fileId, pageNum)
+	if err != nil || query == "" {
+		return page.Text, err
+	}
+
+	table, pattern := "pages", query
+	if !isEnglish(page.Language) {
+		table, pattern = "pages_intl", language.PrefixQuery(page.Language, query)
+	}
+
+	highlightQuery := fmt.Sprintf(`SELECT highlight(%[1]s, 2, $1, $2) FROM %[1]s
+		WHERE %[1]s MATCH $3 AND file_id = $4 AND page_num = $5`, table)
+
+	var text string
+	err = s.db.QueryRowContext(ctx, highlightQuery, open, close, pattern, fileId, pageNum).Scan(&text)
+	if errors.Is(err, sql.ErrNoRows) {
+		return page.Text, nil
+	}
+	return text, err
+}
+
+// The size of a page of a file.
+type PageInfo struct {
+	PageNum    int // 0-indexed page number
+	Characters int // Number of characters of text
+}
+
+// ListPages returns the pages of a file in order, with their size.
+func (s *Store) ListPages(ctx context.Context, fileId int) ([]PageInfo, error) {
+	if err := s.checkAccess(ctx, fileId); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT page_num, length(text) FROM pages WHERE file_id = $1
+		UNION ALL
+		SELECT page_num, length(text) FROM pages_intl WHERE file_id = $1
+		ORDER BY page_num`
+
+	rows, err := s.db.QueryContext(ctx, query, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := []PageInfo{}
+	for rows.Next() {
+		var page PageInfo
+		if err := rows.Scan(&page.PageNum, &page.Characters); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHighlightPage(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertPages(ctx, []Page{
+		{FileID: 1, PageNum: 4, Text: "Acute myocardial infarction is an emergency.", Language: "en"},
+		{FileID: 2, PageNum: 0, Text: "Les infections graves.", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fileId, pageNum int
+		query, expected string
+	}{
+		{1, 4, "infarctions", "Acute myocardial [infarction] is an emergency."},
+		{1, 4, "", "Acute myocardial infarction is an emergency."},
+		{1, 4, "sepsis", "Acute myocardial infarction is an emergency."},
+		{2, 0, "infection", "Les [infections] graves."},
+	}
+
+	for _, test := range tests {
+		text, err := s.HighlightPage(ctx, test.fileId, test.pageNum, test.query, "[", "]")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if text != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.query, test.expected, text)
+		}
+	}
+
+	if _, err := s.GetPage(ctx, 1, 5); err == nil {
+		t.Fatal("expected an error for a missing page")
+	}
+}
+
+func TestSearchAllLanguages(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{
+		{ID: 1, Name: "cardiology.pdf", Path: "/cardiology.pdf", Language: "en", SHA256: "en"},
+		{ID: 2, Name: "neurologie.pdf", Path: "/neurologie.pdf", Language: "fr", SHA256: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.InsertPages(ctx, []Page{
+		{FileID: 1, PageNum: 0, Text: "MI is a myocardial infarction.", Language: "en"},
+		{FileID: 2, PageNum: 0, Text: "La migraine est une céphalée.", Language: "fr"},
+		{FileID: 2, PageNum: 1, Text: "Les infections graves.", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Short words are not searched as prefixes.
+	results, err := s.SearchInLanguage(ctx, "MI", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].FileID != 1 {
+		t.Errorf("expected MI to match the English page only, got %+v", results)
+	}
+
+	// The best result of each table has the same rank.
+	results, err = s.SearchInLanguage(ctx, "infarction OR infections", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0].rank != -1 || results[1].rank != -1 {
+		t.Errorf("expected the ranks of both tables to be normalized, got %+v", results)
+	}
+}
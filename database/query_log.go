@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Layout of the times stored by sqlite's CURRENT_TIMESTAMP, in UTC.
+const sqliteTime = "2006-01-02 15:04:05"
+
+// Options of the query log.
+type QueryLogOptions struct {
+	Enabled   bool // Record the searches of the web interface
+	Retention int  // Days the searches are kept. 0 keeps them forever.
+}
+
+// A search recorded in the query log.
+type QueryLogEntry struct {
+	ID             int64
+	UserID         int // User who searched, 0 without authentication
+	Query          string
+	Language       string // Only documents in this language were searched if not empty
+	Mode           string // fulltext or substring
+	Expand         bool   // The synonyms of the query were expanded
+	Notes          bool   // The notes of the bookmarks were searched too
+	Book           int    // Only this file was searched if not 0
+	Hits           int    // Number of results
+	Latency        time.Duration
+	Clicks         int    // Number of results opened
+	ClickedFileID  int    // File of the last result opened, 0 if none
+	ClickedPageNum int    // 0-indexed page of the last result opened
+	SearchedAt     string // UTC time of the search
+}
+
+// Statistics of the searches of a query in the query log.
+type QueryStat struct {
+	Query      string
+	Searches   int
+	AvgHits    float64
+	AvgLatency time.Duration
+	Clicks     int // Number of results opened
+	LastSearch string
+}
+
+// Format since as stored by sqlite.
+func sqliteSince(since time.Time) string {
+	return since.UTC().Format(sqliteTime)
+}
+
+// LogQuery records a search in the query log and returns its ID.
+func (s *Store) LogQuery(ctx context.Context, entry QueryLogEntry) (int64, error) {
+	query := `INSERT INTO query_log (user_id, query, lang, mode, expand, notes, book, hits, latency_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := s.db.ExecContext(ctx, query, entry.UserID, entry.Query, entry.Language, entry.Mode, entry.Expand,
+		entry.Notes, entry.Book, entry.Hits, entry.Latency.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("unable to log query %q: %w", entry.Query, err)
+	}
+	return result.LastInsertId()
+}
+
+// LogClick records that a result of the search id logged for a user was
+// opened. Returns sql.ErrNoRows if the user has no such search, e.g. it was
+// pruned.
+func (s *Store) LogClick(ctx context.Context, userId int, id int64, fileId, pageNum int) error {
+	query := `UPDATE query_log SET clicks = clicks + 1, clicked_file_id = ?, clicked_page_num = ?
+		WHERE id = ? AND user_id = ?`
+	result, err := s.db.ExecContext(ctx, query, fileId, pageNum, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PruneQueryLog deletes the searches older than days and returns how many
+// were deleted. 0 days deletes nothing.
+func (s *Store) PruneQueryLog(ctx context.Context, days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM query_log WHERE searched_at < ?`, sqliteSince(since))
+	if err != nil {
+		return 0, fmt.Errorf("unable to prune the query log: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// QueryLog returns the searches made since, oldest first.
+func (s *Store) QueryLog(ctx context.Context, since time.Time) ([]QueryLogEntry, error) {
+	query := `SELECT id, user_id, query, lang, mode, expand, notes, book, hits, latency_ms, clicks,
+		COALESCE(clicked_file_id, 0), COALESCE(clicked_page_num, 0), searched_at
+		FROM query_log WHERE searched_at >= ? ORDER BY id`
+	return s.queryLogEntries(ctx, query, sqliteSince(since))
+}
+
+// History returns the latest searches of a user, at most limit, newest first.
+func (s *Store) History(ctx context.Context, userId, limit int) ([]QueryLogEntry, error) {
+	query := `SELECT id, user_id, query, lang, mode, expand, notes, book, hits, latency_ms, clicks,
+		COALESCE(clicked_file_id, 0), COALESCE(clicked_page_num, 0), searched_at
+		FROM query_log WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	return s.queryLogEntries(ctx, query, userId, limit)
+}
+
+func (s *Store) queryLogEntries(ctx context.Context, query string, args ...any) ([]QueryLogEntry, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []QueryLogEntry{}
+	for rows.Next() {
+		var e QueryLogEntry
+		var latency int64
+		err := rows.Scan(&e.ID, &e.UserID, &e.Query, &e.Language, &e.Mode, &e.Expand, &e.Notes, &e.Book, &e.Hits,
+			&latency, &e.Clicks, &e.ClickedFileID, &e.ClickedPageNum, &e.SearchedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Latency = time.Duration(latency) * time.Millisecond
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Statistics of the queries searched since, grouped case insensitively,
+// filtered by the SQL condition having on the aggregates and ordered by order.
+func (s *Store) queryStats(ctx context.Context, since time.Time, having, order string, limit int) ([]QueryStat, error) {
+	query := fmt.Sprintf(`SELECT MIN(query), COUNT(*), AVG(hits), AVG(latency_ms), SUM(clicks), MAX(searched_at)
+		FROM query_log WHERE searched_at >= ?
+		GROUP BY lower(trim(query)) HAVING %s ORDER BY %s LIMIT ?`, having, order)
+
+	rows, err := s.db.QueryContext(ctx, query, sqliteSince(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []QueryStat{}
+	for rows.Next() {
+		var stat QueryStat
+		var latency float64
+		err := rows.Scan(&stat.Query, &stat.Searches, &stat.AvgHits, &latency, &stat.Clicks, &stat.LastSearch)
+		if err != nil {
+			return nil, err
+		}
+		stat.AvgLatency = time.Duration(latency * float64(time.Millisecond))
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// TopQueries returns the queries searched most often since.
+func (s *Store) TopQueries(ctx context.Context, since time.Time, limit int) ([]QueryStat, error) {
+	return s.queryStats(ctx, since, "1", "COUNT(*) DESC, MAX(searched_at) DESC", limit)
+}
+
+// ZeroResultQueries returns the queries searched since that never had a
+// result, most often searched first. They show what the library lacks.
+func (s *Store) ZeroResultQueries(ctx context.Context, since time.Time, limit int) ([]QueryStat, error) {
+	return s.queryStats(ctx, since, "MAX(hits) = 0", "COUNT(*) DESC, MAX(searched_at) DESC", limit)
+}
+
+// SlowQueries returns the queries searched since with the highest average
+// latency.
+func (s *Store) SlowQueries(ctx context.Context, since time.Time, limit int) ([]QueryStat, error) {
+	return s.queryStats(ctx, since, "1", "AVG(latency_ms) DESC", limit)
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueryLogStats(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	entries := []QueryLogEntry{
+		{Query: "sepsis", Mode: "fulltext", Hits: 12, Latency: 20 * time.Millisecond},
+		{Query: "Sepsis ", Mode: "fulltext", Hits: 12, Latency: 40 * time.Millisecond},
+		{Query: "kawasaki", Mode: "fulltext", Hits: 0, Latency: 900 * time.Millisecond},
+	}
+
+	var ids []int64
+	for _, entry := range entries {
+		id, err := s.LogQuery(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := s.LogClick(ctx, 0, ids[1], 7, 41); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.LogClick(ctx, 0, 99, 7, 41); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for an unknown search, got %v", err)
+	}
+
+	since := time.Now().Add(-time.Hour)
+	top, err := s.TopQueries(ctx, since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(top) != 2 || top[0].Searches != 2 || top[0].Clicks != 1 || top[0].AvgLatency != 30*time.Millisecond {
+		t.Fatalf("expected sepsis to be searched twice, got %+v", top)
+	}
+
+	zero, err := s.ZeroResultQueries(ctx, since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zero) != 1 || zero[0].Query != "kawasaki" {
+		t.Fatalf("expected kawasaki to have no results, got %+v", zero)
+	}
+
+	slow, err := s.SlowQueries(ctx, since, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(slow) != 1 || slow[0].Query != "kawasaki" {
+		t.Fatalf("expected kawasaki to be the slowest, got %+v", slow)
+	}
+
+	log, err := s.QueryLog(ctx, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log) != 3 || log[1].ClickedFileID != 7 || log[1].ClickedPageNum != 41 {
+		t.Fatalf("expected the click to be logged, got %+v", log)
+	}
+}
+
+func TestPruneQueryLog(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.LogQuery(ctx, QueryLogEntry{Query: "recent", Mode: "fulltext"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO query_log (query, hits, latency_ms, searched_at)
+		VALUES ('old', 1, 1, datetime('now', '-40 days'))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		days   int
+		pruned int64
+	}{{0, 0}, {60, 0}, {30, 1}} {
+		pruned, err := s.PruneQueryLog(ctx, test.days)
+		if err != nil || pruned != test.pruned {
+			t.Errorf("pruning after %d days: expected %d pruned, got %d, %v", test.days, test.pruned, pruned, err)
+		}
+	}
+
+	log, err := s.QueryLog(ctx, time.Time{})
+	if err != nil || len(log) != 1 || log[0].Query != "recent" {
+		t.Fatalf("expected only the recent search to be kept, got %+v, %v", log, err)
+	}
+}
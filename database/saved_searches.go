@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// A search saved with its filters, re-run after every update of the index.
+type SavedSearch struct {
+	ID        int
+	UserID    int // Owner of the search, 0 if saved without authentication
+	Name      string
+	Query     string
+	Language  string // Only search documents in this language if not empty
+	Mode      string // fulltext or substring
+	Expand    bool   // Expand the synonyms of the query
+	Book      int    // Only search this file if not 0
+	CreatedAt string // UTC time the search was saved
+	CheckedAt string // UTC time the search was last run, empty if never
+
+	NewMatches int // Number of pages matched since the matches were last seen
+}
+
+// A page matched by a saved search.
+type SavedMatch struct {
+	SearchID int
+	FileID   int
+	PageNum  int    // 0-indexed page number
+	Name     string // File name
+	Snippet  string // Snippet of the page with the matches between <b> and </b>
+	New      bool   // Matched after the search was saved and not yet seen
+	FoundAt  string // UTC time the page was first matched
+}
+
+// Columns of a SavedSearch, counting the new matches the viewer of s may
+// access, and their arguments.
+func (s *Store) savedSearchColumns() (string, []any) {
+	access, args := s.accessibleMatches()
+	return fmt.Sprintf(`id, user_id, name, query, lang, mode, expand, book, created_at, COALESCE(checked_at, ''),
+		(SELECT COUNT(*) FROM saved_search_matches WHERE search_id = saved_searches.id AND new = 1 AND %s)`,
+		access), args
+}
+
+func scanSavedSearch(row interface{ Scan(...any) error }) (SavedSearch, error) {
+	var s SavedSearch
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &s.Query, &s.Language, &s.Mode, &s.Expand, &s.Book,
+		&s.CreatedAt, &s.CheckedAt, &s.NewMatches)
+	return s, err
+}
+
+// CreateSavedSearch saves search for its user. Its name must be unique
+// among the searches of the user.
+// Record its current matches with RecordMatches(ctx, id, results, false).
+func (s *Store) CreateSavedSearch(ctx context.Context, search SavedSearch) (SavedSearch, error) {
+	query := `INSERT INTO saved_searches (user_id, name, query, lang, mode, expand, book)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	var id int
+	err := s.db.QueryRowContext(ctx, query, search.UserID, search.Name, search.Query, search.Language, search.Mode,
+		search.Expand, search.Book).Scan(&id)
+	if err != nil {
+		return SavedSearch{}, fmt.Errorf("unable to save search %q: %w", search.Name, err)
+	}
+	return s.GetSavedSearch(ctx, search.UserID, id)
+}
+
+// GetSavedSearch returns a saved search of a user by ID, sql.ErrNoRows if
+// the user has none.
+func (s *Store) GetSavedSearch(ctx context.Context, userID, id int) (SavedSearch, error) {
+	columns, args := s.savedSearchColumns()
+	query := fmt.Sprintf(`SELECT %s FROM saved_searches WHERE user_id = ? AND id = ?`, columns)
+	return scanSavedSearch(s.db.QueryRowContext(ctx, query, append(args, userID, id)...))
+}
+
+// GetSavedSearchByName returns a saved search of a user by name,
+// sql.ErrNoRows if the user has none.
+func (s *Store) GetSavedSearchByName(ctx context.Context, userID int, name string) (SavedSearch, error) {
+	columns, args := s.savedSearchColumns()
+	query := fmt.Sprintf(`SELECT %s FROM saved_searches WHERE user_id = ? AND name = ?`, columns)
+	return scanSavedSearch(s.db.QueryRowContext(ctx, query, append(args, userID, name)...))
+}
+
+// ListSavedSearches returns the saved searches of a user ordered by name.
+func (s *Store) ListSavedSearches(ctx context.Context, userID int) ([]SavedSearch, error) {
+	columns, args := s.savedSearchColumns()
+	return s.querySavedSearches(ctx, fmt.Sprintf(`SELECT %s FROM saved_searches WHERE user_id = ? ORDER BY name`, columns),
+		append(args, userID)...)
+}
+
+// AllSavedSearches returns the saved searches of every user, to run them
+// after an update of the index.
+func (s *Store) AllSavedSearches(ctx context.Context) ([]SavedSearch, error) {
+	columns, args := s.savedSearchColumns()
+	return s.querySavedSearches(ctx, fmt.Sprintf(`SELECT %s FROM saved_searches ORDER BY user_id, name`, columns), args...)
+}
+
+func (s *Store) querySavedSearches(ctx context.Context, query string, args ...any) ([]SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	return searches, rows.Err()
+}
+
+// CountNewMatches returns the number of new matches of the saved searches
+// of a user.
+func (s *Store) CountNewMatches(ctx context.Context, userID int) (int, error) {
+	access, args := s.accessibleMatches()
+	query := `SELECT COUNT(*) FROM saved_search_matches
+		WHERE search_id IN (SELECT id FROM saved_searches WHERE user_id = ?) AND new = 1 AND ` + access
+
+	var n int
+	err := s.db.QueryRowContext(ctx, query, append([]any{userID}, args...)...).Scan(&n)
+	return n, err
+}
+
+// DeleteSavedSearch deletes a saved search of a user and its matches.
+// Returns sql.ErrNoRows if the user has no saved search with id.
+func (s *Store) DeleteSavedSearch(ctx context.Context, userID, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM saved_search_matches
+		WHERE search_id IN (SELECT id FROM saved_searches WHERE user_id = ? AND id = ?)`, userID, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM saved_searches WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// RecordMatches records the pages of results not yet matched by the saved
+// search id, as new if markNew is true, and sets the time it was checked.
+// Returns the number of pages recorded.
+func (s *Store) RecordMatches(ctx context.Context, id int, results []SearchResult, markNew bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO saved_search_matches (search_id, file_id, page_num, name, snippet, new)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	recorded := 0
+	for _, result := range results {
+		res, err := stmt.ExecContext(ctx, id, result.FileID, result.PageNum, result.BaseName, result.Text, markNew)
+		if err != nil {
+			return 0, err
+		}
+
+		n, _ := res.RowsAffected()
+		recorded += int(n)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE saved_searches SET checked_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	return recorded, tx.Commit()
+}
+
+// SavedMatches returns the latest matches of a saved search, at most limit,
+// new matches first. If onlyNew is true, only the new matches are returned.
+func (s *Store) SavedMatches(ctx context.Context, id int, limit int, onlyNew bool) ([]SavedMatch, error) {
+	query := `SELECT search_id, file_id, page_num, name, snippet, new, found_at
+		FROM saved_search_matches WHERE search_id = ?`
+	if onlyNew {
+		query += ` AND new = 1`
+	}
+
+	access, args := s.accessibleMatches()
+	query += ` AND ` + access + ` ORDER BY new DESC, found_at DESC, name, page_num LIMIT ?`
+	args = append([]any{id}, args...)
+
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []SavedMatch{}
+	for rows.Next() {
+		var m SavedMatch
+		err := rows.Scan(&m.SearchID, &m.FileID, &m.PageNum, &m.Name, &m.Snippet, &m.New, &m.FoundAt)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// A condition true for the saved search matches the viewer of s may access,
+// and its arguments. The matches of files no longer indexed are left out of
+// restricted views, since their document is unknown.
+func (s *Store) accessibleMatches() (string, []any) {
+	if s.viewer == 0 {
+		return "1", nil
+	}
+	access, args := s.accessible("sha256")
+	return fmt.Sprintf("file_id IN (SELECT id FROM files WHERE %s)", access), args
+}
+
+// MarkMatchesSeen clears the new matches of a saved search.
+func (s *Store) MarkMatchesSeen(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE saved_search_matches SET new = 0 WHERE search_id = ? AND new = 1`, id)
+	return err
+}
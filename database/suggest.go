@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum number of corrected queries returned by Suggest.
+const maxSuggestions = 3
+
+// FTS5 query operators that must never be spell-corrected.
+var queryOperators = map[string]bool{
+	"AND":  true,
+	"OR":   true,
+	"NOT":  true,
+	"NEAR": true,
+}
+
+// A candidate replacement for a misspelled word.
+type candidate struct {
+	term     string // Word from the vocabulary
+	distance int    // Edit distance from the misspelled word
+	count    int    // Total number of occurrences in the index
+}
+
+// A word of the query and its byte offsets in the query string.
+type queryWord struct {
+	text       string
+	start, end int
+}
+
+// Suggest returns corrected versions of query for the words that do not
+// match any page in the index. Candidates are read from the unstemmed
+// vocabulary, so they are real words, and ranked by edit distance, with ties
+// broken by term frequency.
+// Returns an empty slice if every word matched or no candidates were found.
+func (s *Store) Suggest(ctx context.Context, query string) ([]string, error) {
+	words := splitQuery(query)
+
+	corrections := make(map[int][]candidate)
+	for i, word := range words {
+		if utf8.RuneCountInString(word.text) < 3 || queryOperators[word.text] {
+			continue
+		}
+
+		found, err := s.termExists(ctx, word.text)
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			continue
+		}
+
+		candidates, err := s.findCandidates(ctx, strings.ToLower(word.text))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(candidates) > 0 {
+			corrections[i] = candidates
+		}
+	}
+
+	suggestions := []string{}
+	if len(corrections) == 0 {
+		return suggestions, nil
+	}
+
+	// The n-th suggestion uses the n-th best candidate of each misspelled word,
+	// falling back to the best one when a word has fewer candidates.
+	seen := make(map[string]bool)
+	for n := 0; n < maxSuggestions; n++ {
+		var sb strings.Builder
+		offset := 0
+		for i, word := range words {
+			candidates, ok := corrections[i]
+			if !ok {
+				continue
+			}
+
+			c := candidates[0]
+			if n < len(candidates) {
+				c = candidates[n]
+			}
+
+			sb.WriteString(query[offset:word.start])
+			sb.WriteString(c.term)
+			offset = word.end
+		}
+		sb.WriteString(query[offset:])
+
+		suggestion := sb.String()
+		if !seen[suggestion] {
+			seen[suggestion] = true
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	return suggestions, nil
+}
+
+// Reports whether word matches at least one page in any language, among
+// the documents the viewer of s may access.
+func (s *Store) termExists(ctx context.Context, word string) (bool, error) {
+	return s.matchesAccessible(ctx, `"`+word+`"`, `"`+word+`"*`)
+}
+
+// Find vocabulary words close to word. To keep the scan small, only words
+// starting with the same letter and of similar length are considered.
+// Phrases of the vocabulary, rare words and words found only in documents
+// hidden from the viewer of s are skipped.
+func (s *Store) findCandidates(ctx context.Context, word string) ([]candidate, error) {
+	first, size := utf8.DecodeRuneInString(word)
+	length := utf8.RuneCountInString(word)
+
+	maxDistance := 1
+	if length > 4 {
+		maxDistance = 2
+	}
+
+	query := `SELECT term, frequency FROM vocabulary
+		WHERE term >= $1 AND term < $2 AND length(term) BETWEEN $3 AND $4
+		AND instr(term, ' ') = 0 AND frequency >= $5`
+
+	rows, err := s.db.QueryContext(ctx, query, word[:size], string(first+1),
+		length-maxDistance, length+maxDistance, minWordFrequency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []candidate{}
+	for rows.Next() {
+		var c candidate
+		err := rows.Scan(&c.term, &c.count)
+		if err != nil {
+			return nil, err
+		}
+
+		c.distance = editDistance(word, c.term)
+		if c.distance > 0 && c.distance <= maxDistance {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	rows.Close()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].count > candidates[j].count
+	})
+
+	accessible := []candidate{}
+	for _, c := range candidates {
+		if len(accessible) == maxSuggestions {
+			break
+		}
+
+		ok, err := s.termAccessible(ctx, c.term)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			accessible = append(accessible, c)
+		}
+	}
+	return accessible, nil
+}
+
+// Split the query into runs of letters and digits.
+func splitQuery(query string) []queryWord {
+	words := []queryWord{}
+	start := -1
+	for i, r := range query {
+		isWordRune := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			words = append(words, queryWord{text: query[start:i], start: start, end: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, queryWord{text: query[start:], start: start, end: len(query)})
+	}
+	return words
+}
+
+// Optimal string alignment distance between a and b.
+// Like the Levenshtein distance but a transposition of two adjacent
+// characters counts as a single edit, which is the most common typo.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
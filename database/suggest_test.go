@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tc := []struct {
+		a, b     string
+		distance int
+	}{
+		{a: "amoxicillin", b: "amoxicillin", distance: 0},
+		{a: "amoxycillin", b: "amoxicillin", distance: 1},
+		{a: "guillan", b: "guillain", distance: 1},
+		{a: "hepatitsi", b: "hepatitis", distance: 1},
+		{a: "barre", b: "barré", distance: 1},
+		{a: "", b: "abc", distance: 3},
+	}
+
+	for _, c := range tc {
+		t.Run(c.a+"/"+c.b, func(t *testing.T) {
+			got := editDistance(c.a, c.b)
+			if got != c.distance {
+				t.Fatalf("expected %d, got %d", c.distance, got)
+			}
+		})
+	}
+}
+
+func TestSplitQuery(t *testing.T) {
+	query := `"Guillan-Barre" AND syndrom*`
+	words := splitQuery(query)
+
+	expected := []string{"Guillan", "Barre", "AND", "syndrom"}
+	if len(words) != len(expected) {
+		t.Fatalf("expected %d words, got %d", len(expected), len(words))
+	}
+
+	for i, word := range words {
+		if word.text != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], word.text)
+		}
+
+		if query[word.start:word.end] != word.text {
+			t.Fatalf("offsets of %s do not match the query", word.text)
+		}
+	}
+}
+
+func TestSuggestWords(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{{ID: 1, Name: "medicine.pdf", Path: "/medicine.pdf", Language: "en", SHA256: "medicine"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.InsertPages(ctx, []Page{
+		{FileID: 1, PageNum: 0, Text: "Hypertension and nephrotic syndrome.", Language: "en"},
+		{FileID: 1, PageNum: 1, Text: "Hypertension in the nephrotic syndrome.", Language: "en"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RebuildVocabulary(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrections are words as written, not porter stems like "hypertens".
+	for query, expected := range map[string]string{"hypertensoin": "hypertension", "syndrme": "syndrome"} {
+		suggestions, err := s.Suggest(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Contains(suggestions, expected) {
+			t.Errorf("%s: expected %s in the suggestions, got %v", query, expected, suggestions)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles of the users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin" // Also manages the server: backups, analytics, synonyms and profiling
+)
+
+// Minimum length of a password, in characters.
+const minPasswordLength = 8
+
+// Prefix of the API tokens, to recognize them in scripts and logs.
+const tokenPrefix = "pds_"
+
+// ErrInvalidCredentials is returned for an unknown user or a wrong password.
+var ErrInvalidCredentials = errors.New("invalid user name or password")
+
+// A hash compared with the password of unknown users, so that they take as
+// long to reject as wrong passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// A local account.
+type User struct {
+	ID        int
+	Name      string
+	Role      string // user or admin
+	CreatedAt string // UTC time the user was created
+}
+
+// IsAdmin tells whether the user manages the server.
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// A token authenticating the scripts of a user on the API.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	CreatedAt  string // UTC time the token was created
+	LastUsedAt string // UTC time the token was last used, empty if never
+}
+
+// A random token and its hex encoded SHA-256 hash, the only part stored.
+func newToken(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return "", fmt.Errorf("passwords need at least %d characters", minPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.Role, &u.CreatedAt)
+	return u, err
+}
+
+// CreateUser creates a user with a password of at least 8 characters and
+// role. The first user created inherits the bookmarks, the saved searches
+// and the searches made without authentication.
+func (s *Store) CreateUser(ctx context.Context, name, password, role string) (User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return User{}, errors.New("a user needs a name")
+	}
+
+	if role != RoleUser && role != RoleAdmin {
+		return User{}, fmt.Errorf("invalid role %q: expected user or admin", role)
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	var first bool
+	if err := tx.QueryRowContext(ctx, `SELECT NOT EXISTS (SELECT 1 FROM users)`).Scan(&first); err != nil {
+		return User{}, err
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `INSERT INTO users (name, password_hash, role) VALUES (?, ?, ?) RETURNING id`,
+		name, hash, role).Scan(&id)
+	if err != nil {
+		return User{}, fmt.Errorf("unable to create user %q: %w", name, err)
+	}
+
+	if first {
+		for _, table := range []string{"bookmarks", "saved_searches", "query_log"} {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET user_id = ? WHERE user_id = 0`, table), id)
+			if err != nil {
+				return User{}, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, err
+	}
+	return s.GetUser(ctx, id)
+}
+
+// GetUser returns a user by ID, sql.ErrNoRows if there is none.
+func (s *Store) GetUser(ctx context.Context, id int) (User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, name, role, created_at FROM users WHERE id = ?`, id)
+	return scanUser(row)
+}
+
+// GetUserByName returns a user by name, ignoring case, sql.ErrNoRows if
+// there is none.
+func (s *Store) GetUserByName(ctx context.Context, name string) (User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, name, role, created_at FROM users WHERE name = ?`, name)
+	return scanUser(row)
+}
+
+// ListUsers returns the users ordered by name.
+func (s *Store) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, role, created_at FROM users ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CountUsers returns the number of users.
+func (s *Store) CountUsers(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n)
+	return n, err
+}
+
+// Authenticate returns the user with name and password, ErrInvalidCredentials
+// if there is none.
+func (s *Store) Authenticate(ctx context.Context, name, password string) (User, error) {
+	var hash string
+	var user User
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, role, created_at, password_hash FROM users WHERE name = ?`,
+		strings.TrimSpace(name)).Scan(&user.ID, &user.Name, &user.Role, &user.CreatedAt, &hash)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// SetPassword changes the password of a user and logs them out. Returns
+// sql.ErrNoRows if there is no user with id.
+func (s *Store) SetPassword(ctx context.Context, id int, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, hash, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, id)
+	return err
+}
+
+// SetRole changes the role of a user. Returns sql.ErrNoRows if there is no
+// user with id.
+func (s *Store) SetRole(ctx context.Context, id int, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("invalid role %q: expected user or admin", role)
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET role = ? WHERE id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUser deletes a user with their sessions, tokens, bookmarks, saved
+// searches and access.
+// Their logged searches are kept without a user. Returns sql.ErrNoRows if
+// there is no user with id.
+func (s *Store) DeleteUser(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM sessions WHERE user_id = ?`,
+		`DELETE FROM api_tokens WHERE user_id = ?`,
+		`DELETE FROM bookmarks WHERE user_id = ?`,
+		`DELETE FROM saved_searches WHERE user_id = ?`,
+		`DELETE FROM collection_users WHERE user_id = ?`,
+		`DELETE FROM group_members WHERE user_id = ?`,
+		`UPDATE query_log SET user_id = 0 WHERE user_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// CreateSession logs in a user for lifetime and returns the token of
+// their session cookie.
+func (s *Store) CreateSession(ctx context.Context, userId int, lifetime time.Duration) (string, error) {
+	token, hash, err := newToken("")
+	if err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(lifetime).UTC().Format(sqliteTime)
+	_, err = s.db.ExecContext(ctx, `INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		hash, userId, expires)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SessionUser returns the user logged in with the session token,
+// sql.ErrNoRows if the session does not exist or has expired.
+func (s *Store) SessionUser(ctx context.Context, token string) (User, error) {
+	query := `SELECT users.id, users.name, users.role, users.created_at FROM sessions
+		JOIN users ON users.id = sessions.user_id
+		WHERE sessions.token_hash = ? AND sessions.expires_at > ?`
+
+	now := time.Now().UTC().Format(sqliteTime)
+	return scanUser(s.db.QueryRowContext(ctx, query, hashToken(token), now))
+}
+
+// DeleteSession logs out the session token.
+func (s *Store) DeleteSession(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = ?`, hashToken(token))
+	return err
+}
+
+// DeleteExpiredSessions deletes the expired sessions and returns how many
+// were deleted.
+func (s *Store) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	now := time.Now().UTC().Format(sqliteTime)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateToken creates an API token named name for a user. The token is
+// only returned here, the store keeps its hash.
+func (s *Store) CreateToken(ctx context.Context, userId int, name string) (APIToken, string, error) {
+	token, hash, err := newToken(tokenPrefix)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `INSERT INTO api_tokens (user_id, name, token_hash) VALUES (?, ?, ?) RETURNING id`,
+		userId, strings.TrimSpace(name), hash).Scan(&id)
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("unable to create token %q: %w", name, err)
+	}
+
+	var t APIToken
+	err = s.db.QueryRowContext(ctx, `SELECT id, user_id, name, created_at FROM api_tokens WHERE id = ?`, id).
+		Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt)
+	return t, token, err
+}
+
+// TokenUser returns the user of an API token and records its use,
+// sql.ErrNoRows if there is no such token.
+func (s *Store) TokenUser(ctx context.Context, token string) (User, error) {
+	query := `SELECT users.id, users.name, users.role, users.created_at FROM api_tokens
+		JOIN users ON users.id = api_tokens.user_id
+		WHERE api_tokens.token_hash = ?`
+
+	hash := hashToken(token)
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		return user, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE token_hash = ?`, hash)
+	return user, err
+}
+
+// ListTokens returns the API tokens of a user, oldest first.
+func (s *Store) ListTokens(ctx context.Context, userId int) ([]APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, name, created_at, COALESCE(last_used_at, '')
+		FROM api_tokens WHERE user_id = ? ORDER BY id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken revokes an API token of a user. Returns sql.ErrNoRows if the
+// user has no token with id.
+func (s *Store) DeleteToken(ctx context.Context, userId, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
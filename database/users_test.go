@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsersAndSessions(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.CreateUser(ctx, "alice", "short", RoleAdmin); err == nil {
+		t.Fatal("expected a short password to be refused")
+	}
+
+	alice, err := s.CreateUser(ctx, "alice", "correct horse", RoleAdmin)
+	if err != nil || !alice.IsAdmin() {
+		t.Fatalf("expected an admin, got %+v, %v", alice, err)
+	}
+
+	if _, err := s.CreateUser(ctx, "Alice", "correct horse", RoleUser); err == nil {
+		t.Fatal("expected user names to be unique regardless of case")
+	}
+
+	if _, err := s.Authenticate(ctx, "alice", "wrong horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+
+	if _, err := s.Authenticate(ctx, "bob", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for an unknown user, got %v", err)
+	}
+
+	user, err := s.Authenticate(ctx, "alice", "correct horse")
+	if err != nil || user.ID != alice.ID {
+		t.Fatalf("expected alice to log in, got %+v, %v", user, err)
+	}
+
+	token, err := s.CreateSession(ctx, alice.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user, err := s.SessionUser(ctx, token); err != nil || user.ID != alice.ID {
+		t.Fatalf("expected the session of alice, got %+v, %v", user, err)
+	}
+
+	expired, err := s.CreateSession(ctx, alice.ID, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.SessionUser(ctx, expired); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected an expired session to be refused, got %v", err)
+	}
+
+	if n, err := s.DeleteExpiredSessions(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 expired session to be deleted, got %d, %v", n, err)
+	}
+
+	// Changing the password logs out.
+	if err := s.SetPassword(ctx, alice.ID, "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.SessionUser(ctx, token); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the session to end with the password change, got %v", err)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	bob, err := s.CreateUser(ctx, "bob", "correct horse", RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiToken, secret, err := s.CreateToken(ctx, bob.ID, "nightly export")
+	if err != nil || !strings.HasPrefix(secret, tokenPrefix) {
+		t.Fatalf("expected a token, got %q, %v", secret, err)
+	}
+
+	if user, err := s.TokenUser(ctx, secret); err != nil || user.ID != bob.ID {
+		t.Fatalf("expected the token of bob, got %+v, %v", user, err)
+	}
+
+	tokens, err := s.ListTokens(ctx, bob.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == "" {
+		t.Fatalf("expected the token to be used, got %+v, %v", tokens, err)
+	}
+
+	if err := s.DeleteToken(ctx, bob.ID+1, apiToken.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected users not to revoke the tokens of others, got %v", err)
+	}
+
+	if err := s.DeleteToken(ctx, bob.ID, apiToken.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.TokenUser(ctx, secret); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a revoked token to be refused, got %v", err)
+	}
+}
+
+func TestBookmarksArePerUser(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{{ID: 1, Name: "peds.pdf", Path: "/peds.pdf", Language: "en", SHA256: "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bookmarked before authentication was enabled.
+	anonymous, err := s.AddBookmark(ctx, 0, 1, 3, "fluids")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := s.CreateUser(ctx, "alice", "correct horse", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := s.CreateUser(ctx, "bob", "correct horse", RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := s.GetBookmark(ctx, alice.ID, anonymous.ID); err != nil || b.UserID != alice.ID {
+		t.Fatalf("expected the first user to inherit the bookmarks, got %+v, %v", b, err)
+	}
+
+	// Both users bookmark the same page.
+	if _, err := s.AddBookmark(ctx, bob.ID, 1, 3, "bob's fluids"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetBookmark(ctx, bob.ID, anonymous.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected bob not to see the bookmark of alice, got %v", err)
+	}
+
+	if err := s.DeleteBookmark(ctx, bob.ID, anonymous.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected bob not to delete the bookmark of alice, got %v", err)
+	}
+
+	results, err := s.SearchNotes(ctx, bob.ID, "fluids")
+	if err != nil || len(results) != 1 || !strings.Contains(results[0].Text, "bob") {
+		t.Fatalf("expected only the note of bob, got %+v, %v", results, err)
+	}
+
+	if err := s.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if bookmarks, _ := s.ListBookmarks(ctx, bob.ID); len(bookmarks) != 0 {
+		t.Errorf("expected the bookmarks of bob to be deleted with the user, got %+v", bookmarks)
+	}
+}
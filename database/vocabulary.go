@@ -0,0 +1,359 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Terms seen fewer times than these are not shown from the vocabulary.
+// Drops most typos from bad text extraction.
+const (
+	minWordFrequency   = 2
+	minPhraseFrequency = 3
+)
+
+// Condition on the rows of the vocabulary frequent enough to be shown.
+// The rarer terms are kept so their count is right as documents are added.
+var frequentTerm = fmt.Sprintf(`frequency >= CASE WHEN instr(term, ' ') > 0 THEN %d ELSE %d END`,
+	minPhraseFrequency, minWordFrequency)
+
+// Common words that make useless completions.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "has": true, "in": true,
+	"is": true, "it": true, "its": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true,
+	"were": true, "which": true, "with": true,
+}
+
+// A term or phrase from the vocabulary with the number of times it
+// occurs in the index.
+type Term struct {
+	Term      string
+	Frequency int
+}
+
+// A completion for a search prefix.
+type Completions struct {
+	Terms []string // Terms and phrases, most frequent first
+	Books []File   // Books whose name contains the prefix
+}
+
+// RebuildVocabulary replaces the vocabulary table with the words and
+// two-word phrases of every page in the index. Unlike pages_vocab, the
+// terms are not stemmed so they can be shown to users as they are.
+// The vocabulary is otherwise kept up to date as pages are inserted and
+// removed, so this is only needed to repair it.
+func (s *Store) RebuildVocabulary(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM vocabulary`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"pages", "pages_intl"} {
+		err := addTableTerms(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	var numWords, numPhrases int
+	query := fmt.Sprintf(`SELECT COALESCE(SUM(instr(term, ' ') = 0), 0), COALESCE(SUM(instr(term, ' ') > 0), 0)
+		FROM vocabulary WHERE %s`, frequentTerm)
+	err = tx.QueryRowContext(ctx, query).Scan(&numWords, &numPhrases)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Stored %d words and %d phrases in the vocabulary\n", numWords, numPhrases)
+	return nil
+}
+
+// Number of pages read at a time while rebuilding the vocabulary.
+const vocabularyBatchSize = 1000
+
+// Add the terms of every page of table to the vocabulary, a batch of pages
+// at a time so the counts of the whole library are never held in memory.
+func addTableTerms(ctx context.Context, tx *sql.Tx, table string) error {
+	query := fmt.Sprintf(`SELECT rowid, text FROM %s WHERE rowid > $1 ORDER BY rowid LIMIT $2`, table)
+
+	var lastRowID int64
+	for {
+		words := make(map[string]int)
+		phrases := make(map[string]int)
+		numPages := 0
+
+		rows, err := tx.QueryContext(ctx, query, lastRowID, vocabularyBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var text string
+			err := rows.Scan(&lastRowID, &text)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			countTerms(text, words, phrases)
+			numPages++
+		}
+
+		if err := rows.Close(); err != nil {
+			return err
+		}
+
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+
+		if numPages == 0 {
+			return nil
+		}
+
+		err = updateVocabulary(ctx, tx, words, phrases, 1)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Add the counts of words and phrases to the vocabulary, or subtract them
+// if sign is -1. Terms no longer found anywhere are deleted.
+func updateVocabulary(ctx context.Context, tx *sql.Tx, words, phrases map[string]int, sign int) error {
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO vocabulary (term, frequency) VALUES($1, $2)
+		ON CONFLICT(term) DO UPDATE SET frequency = frequency + excluded.frequency`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, terms := range []map[string]int{words, phrases} {
+		for term, frequency := range terms {
+			_, err := stmt.ExecContext(ctx, term, sign*frequency)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if sign < 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM vocabulary WHERE frequency <= 0`)
+	}
+	return err
+}
+
+// Add the terms of pages to the vocabulary.
+func addPageTerms(ctx context.Context, tx *sql.Tx, pages []Page) error {
+	words := make(map[string]int)
+	phrases := make(map[string]int)
+	for _, page := range pages {
+		countTerms(page.Text, words, phrases)
+	}
+	return updateVocabulary(ctx, tx, words, phrases, 1)
+}
+
+// EnsureVocabulary builds the vocabulary if it is empty but pages exist,
+// e.g. for an index created before the vocabulary table was added.
+func (s *Store) EnsureVocabulary(ctx context.Context) error {
+	query := `SELECT NOT EXISTS(SELECT 1 FROM vocabulary)
+		AND (EXISTS(SELECT 1 FROM pages) OR EXISTS(SELECT 1 FROM pages_intl))`
+
+	var empty bool
+	err := s.db.QueryRowContext(ctx, query).Scan(&empty)
+	if err != nil || !empty {
+		return err
+	}
+	return s.RebuildVocabulary(ctx)
+}
+
+// Complete returns the most frequent terms starting with prefix and the
+// books whose name contains it. If prefix has several words and there are
+// not enough phrase completions, the last word is completed on its own.
+func (s *Store) Complete(ctx context.Context, prefix string, limit int) (Completions, error) {
+	completions := Completions{Terms: []string{}, Books: []File{}}
+
+	prefix = strings.ToLower(strings.Join(strings.Fields(prefix), " "))
+	if prefix == "" {
+		return completions, nil
+	}
+
+	terms, err := s.termsWithPrefix(ctx, prefix, limit)
+	if err != nil {
+		return completions, err
+	}
+
+	for _, term := range terms {
+		completions.Terms = append(completions.Terms, term.Term)
+	}
+
+	if i := strings.LastIndex(prefix, " "); i >= 0 && len(terms) < limit {
+		head, last := prefix[:i], prefix[i+1:]
+		terms, err := s.termsWithPrefix(ctx, last, limit-len(terms))
+		if err != nil {
+			return completions, err
+		}
+
+		for _, term := range terms {
+			completion := head + " " + term.Term
+			if !strings.Contains(term.Term, " ") && !slices.Contains(completions.Terms, completion) {
+				completions.Terms = append(completions.Terms, completion)
+			}
+		}
+	}
+
+	access, args := s.accessible("sha256")
+	query := fmt.Sprintf(`SELECT id, name, path FROM files WHERE name LIKE ? ESCAPE '\' AND %s
+		ORDER BY name LIMIT ?`, access)
+	args = append([]any{"%" + escapeLike(prefix) + "%"}, args...)
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return completions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file File
+		err := rows.Scan(&file.ID, &file.Name, &file.Path)
+		if err != nil {
+			return completions, err
+		}
+		completions.Books = append(completions.Books, file)
+	}
+	return completions, rows.Err()
+}
+
+// Number of vocabulary terms read per completion of a restricted view,
+// since the terms found only in hidden documents are dropped.
+const restrictedScanFactor = 10
+
+// Terms of the vocabulary starting with prefix, most frequent first.
+// The terms found only in documents hidden from the viewer of s are left out.
+func (s *Store) termsWithPrefix(ctx context.Context, prefix string, limit int) ([]Term, error) {
+	query := fmt.Sprintf(`SELECT term, frequency FROM vocabulary
+		WHERE term >= $1 AND term < $2 AND %s ORDER BY frequency DESC LIMIT $3`, frequentTerm)
+
+	// Upper bound of the range: the prefix with its last rune incremented.
+	last, size := utf8.DecodeLastRuneInString(prefix)
+	upper := prefix[:len(prefix)-size] + string(last+1)
+
+	scan := limit
+	if s.viewer != 0 {
+		scan *= restrictedScanFactor
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, prefix, upper, scan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []Term{}
+	for rows.Next() {
+		var term Term
+		err := rows.Scan(&term.Term, &term.Frequency)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	rows.Close()
+
+	accessible := []Term{}
+	for _, term := range terms {
+		if len(accessible) == limit {
+			break
+		}
+
+		ok, err := s.termAccessible(ctx, term.Term)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			accessible = append(accessible, term)
+		}
+	}
+	return accessible, nil
+}
+
+// Reports whether term, a word or a phrase of the vocabulary, occurs in a
+// document the viewer of s may access. The vocabulary is built from every
+// document, so the terms of restricted documents are checked against the
+// index before they are shown.
+func (s *Store) termAccessible(ctx context.Context, term string) (bool, error) {
+	if s.viewer == 0 {
+		return true, nil
+	}
+
+	phrase := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	return s.matchesAccessible(ctx, phrase, phrase)
+}
+
+// Reports whether the full-text query pattern matches a page of pages, or
+// intlPattern a page of pages_intl, in a document the viewer of s may access.
+func (s *Store) matchesAccessible(ctx context.Context, pattern, intlPattern string) (bool, error) {
+	access, accessArgs := s.accessible("files.sha256")
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM pages JOIN files ON pages.file_id = files.id
+			WHERE pages MATCH ? AND %[1]s)
+		OR EXISTS(SELECT 1 FROM pages_intl JOIN files ON pages_intl.file_id = files.id
+			WHERE pages_intl MATCH ? AND %[1]s)`, access)
+
+	args := append([]any{pattern}, accessArgs...)
+	args = append(append(args, intlPattern), accessArgs...)
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&exists)
+	return exists, err
+}
+
+// Count the words and two-word phrases of text.
+// Numbers, stop words and words shorter than 3 letters are skipped
+// and break phrases.
+func countTerms(text string, words, phrases map[string]int) {
+	previous := ""
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if utf8.RuneCountInString(word) < 3 || stopWords[word] || !containsLetter(word) {
+			previous = ""
+			continue
+		}
+
+		words[word]++
+		if previous != "" {
+			phrases[previous+" "+word]++
+		}
+		previous = word
+	}
+}
+
+func containsLetter(word string) bool {
+	return strings.IndexFunc(word, unicode.IsLetter) >= 0
+}
+
+// Escape the LIKE wildcards in s. Used with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestCountTerms(t *testing.T) {
+	words := make(map[string]int)
+	phrases := make(map[string]int)
+	countTerms("Acute myocardial infarction, and the myocardial infarction of 2024", words, phrases)
+
+	if words["myocardial"] != 2 {
+		t.Fatalf("expected 2 occurrences of myocardial, got %d", words["myocardial"])
+	}
+
+	if words["the"] != 0 || words["2024"] != 0 {
+		t.Fatalf("stop words and numbers must not be counted")
+	}
+
+	if phrases["myocardial infarction"] != 2 {
+		t.Fatalf("expected 2 occurrences of the phrase, got %d", phrases["myocardial infarction"])
+	}
+
+	if phrases["infarction myocardial"] != 0 {
+		t.Fatalf("phrases must not span stop words")
+	}
+
+	// Lengths are in letters, not bytes.
+	countTerms("ça été", words, phrases)
+	if words["ça"] != 0 || words["été"] != 1 {
+		t.Fatalf("expected été but not ça to be counted, got %v", words)
+	}
+}
+
+func TestCompleteNonASCIIPrefix(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{{ID: 1, Name: "voyage.pdf", Path: "/voyage.pdf", Language: "fr", SHA256: "voyage"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.InsertPages(ctx, []Page{
+		{FileID: 1, PageNum: 0, Text: "Un café au réseau, un rêve.", Language: "fr"},
+		{FileID: 1, PageNum: 1, Text: "Deux cafés, un café, le réseau et le rêve.", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RebuildVocabulary(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for prefix, expected := range map[string][]string{"café": {"café"}, "ré": {"réseau"}, "rê": {"rêve"}} {
+		completions, err := s.Complete(ctx, prefix, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(completions.Terms, expected) {
+			t.Errorf("%s: expected %v, got %v", prefix, expected, completions.Terms)
+		}
+	}
+}
+
+func TestVocabularyFollowsFiles(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.InsertFiles(ctx, []File{
+		{ID: 1, Name: "cardiology.pdf", Path: "/cardiology.pdf", Language: "en", SHA256: "cardiology"},
+		{ID: 2, Name: "nephrology.pdf", Path: "/nephrology.pdf", Language: "en", SHA256: "nephrology"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	complete := func(prefix string) []string {
+		t.Helper()
+		completions, err := s.Complete(ctx, prefix, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return completions.Terms
+	}
+
+	// Seen once in each file: only frequent enough once both are inserted.
+	err = s.InsertPages(ctx, []Page{{FileID: 1, PageNum: 0, Text: "Hypertension and heart failure.", Language: "en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if terms := complete("hyper"); len(terms) != 0 {
+		t.Fatalf("expected no completions for a word seen once, got %v", terms)
+	}
+
+	err = s.InsertPagesOneByOne(ctx, []Page{{FileID: 2, PageNum: 0, Text: "Hypertension and kidney failure.", Language: "en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if terms := complete("hyper"); !slices.Equal(terms, []string{"hypertension"}) {
+		t.Fatalf("expected [hypertension], got %v", terms)
+	}
+
+	if err := s.RemoveFiles(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if terms := complete("hyper"); len(terms) != 0 {
+		t.Fatalf("expected no completions after removing a file, got %v", terms)
+	}
+
+	var frequency int
+	err = s.db.QueryRowContext(ctx, `SELECT frequency FROM vocabulary WHERE term = 'hypertension'`).Scan(&frequency)
+	if err != nil || frequency != 1 {
+		t.Fatalf("expected hypertension to be counted once, got %d: %v", frequency, err)
+	}
+
+	var kidney bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM vocabulary WHERE term = 'kidney')`).Scan(&kidney)
+	if err != nil || kidney {
+		t.Fatalf("expected the terms of the removed file to be deleted: %v", err)
+	}
+}
@@ -3,8 +3,21 @@ module github.com/abiiranathan/pdfsearch
 go 1.22
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/abiiranathan/goflag v0.1.6
+	github.com/gdamore/tcell/v2 v2.8.1
 	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/rivo/tview v0.42.0
+	golang.org/x/crypto v0.32.0
+	golang.org/x/term v0.28.0
 )
 
-require github.com/google/uuid v1.5.0 // indirect
+require (
+	github.com/gdamore/encoding v1.0.1 // indirect
+	github.com/google/uuid v1.5.0 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,152 @@
+// Package language detects the language of extracted text and rewrites
+// queries for the languages that SQLite's porter stemmer does not support.
+//
+// Detection counts the stop words of each supported language. Stemming is
+// a light suffix stripping: the stem is searched as a prefix so that
+// "infections" and "infectieux" both match "infect*".
+package language
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// English is the default language. Its pages are indexed with the
+// porter stemmer, all others without stemming.
+const English = "en"
+
+// Names of the supported languages by ISO 639-1 code.
+var Names = map[string]string{
+	"en": "English",
+	"fr": "French",
+	"de": "German",
+	"es": "Spanish",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+}
+
+// Frequent words that are (mostly) unique to each language.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "that", "with", "for", "are", "was", "this", "which", "be", "by", "from"},
+	"fr": {"le", "la", "les", "des", "et", "est", "une", "dans", "pour", "qui", "sur", "pas", "par", "avec", "du", "au", "sont"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "von", "den", "dem", "ein", "eine", "zu", "auf", "für", "sich", "werden"},
+	"es": {"el", "los", "las", "del", "y", "una", "por", "con", "para", "es", "su", "al", "como", "pero"},
+	"it": {"il", "della", "che", "di", "per", "sono", "non", "gli", "nel", "alla", "delle", "questo"},
+	"pt": {"os", "da", "do", "em", "um", "uma", "não", "dos", "das", "são", "mais", "ao"},
+	"nl": {"het", "een", "van", "dat", "op", "te", "zijn", "niet", "voor", "worden", "ook", "bij"},
+}
+
+// Suffixes stripped by Stem, longest first.
+var suffixes = map[string][]string{
+	"fr": {"issements", "issement", "ements", "ement", "ations", "ation", "euses", "euse", "ités", "ité", "ives", "ive", "ions", "eux", "ées", "ée", "és", "es", "if", "s", "e"},
+	"de": {"ungen", "heiten", "keiten", "lichen", "ung", "heit", "keit", "lich", "isch", "ern", "em", "en", "er", "es", "e", "s", "n"},
+	"es": {"aciones", "ación", "idades", "mente", "idad", "ismos", "ismo", "istas", "ista", "es", "os", "as", "o", "a", "s"},
+	"it": {"azioni", "azione", "mente", "ità", "ismi", "ismo", "isti", "ista", "i", "e", "o", "a"},
+	"pt": {"ações", "ação", "idades", "mente", "idade", "ismos", "ismo", "istas", "ista", "es", "os", "as", "o", "a", "s"},
+	"nl": {"heden", "ingen", "heid", "lijk", "ing", "en", "e", "s"},
+}
+
+// Stems shorter than this are not stripped further.
+const minStemLength = 3
+
+// Words whose stem is shorter than this are searched as whole words, so
+// that abbreviations like "MI" do not match "migraine" and "mild".
+const minPrefixLength = 4
+
+// Minimum number of stop words needed to trust the detection.
+const minStopWords = 5
+
+// FTS5 query operators.
+var operators = []string{"AND", "OR", "NOT", "NEAR"}
+
+// Detect returns the ISO 639-1 code of the language of text.
+// Defaults to English if the text has too few stop words to tell.
+func Detect(text string) string {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isSeparator) {
+		for lang, words := range stopWords {
+			if slices.Contains(words, word) {
+				counts[lang]++
+			}
+		}
+	}
+
+	best, bestCount := English, 0
+	for lang, count := range counts {
+		if count > bestCount || (count == bestCount && lang == English) {
+			best, bestCount = lang, count
+		}
+	}
+
+	if bestCount < minStopWords {
+		return English
+	}
+	return best
+}
+
+// Stem strips the longest known suffix of word for lang.
+// Words of unsupported languages are returned in lower case.
+func Stem(lang, word string) string {
+	word = strings.ToLower(word)
+	for _, suffix := range suffixes[lang] {
+		stem, found := strings.CutSuffix(word, suffix)
+		if found && utf8.RuneCountInString(stem) >= minStemLength {
+			return stem
+		}
+	}
+	return word
+}
+
+// PrefixQuery rewrites the bare words of an FTS5 query into prefix queries
+// of their stems, e.g. "infections graves" becomes "infect* grav*" in French.
+// Quoted phrases, operators, column filters, prefix queries and words with
+// stems shorter than 4 letters are kept.
+// If lang is empty, the words are not stemmed, only turned into prefixes.
+func PrefixQuery(lang, query string) string {
+	var sb strings.Builder
+	quoted := false
+	start := -1
+
+	flush := func(end int) {
+		word := query[start:end]
+		next := query[end:]
+		stem := Stem(lang, word)
+		if slices.Contains(operators, word) || strings.HasPrefix(next, "*") || strings.HasPrefix(next, ":") ||
+			utf8.RuneCountInString(stem) < minPrefixLength {
+			sb.WriteString(word)
+		} else {
+			sb.WriteString(stem)
+			sb.WriteString("*")
+		}
+		start = -1
+	}
+
+	for i, r := range query {
+		if r == '"' {
+			quoted = !quoted
+		}
+
+		isWordRune := !quoted && !isSeparator(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			flush(i)
+		}
+
+		if start < 0 {
+			sb.WriteRune(r)
+		}
+	}
+
+	if start >= 0 {
+		flush(len(query))
+	}
+	return sb.String()
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
@@ -0,0 +1,54 @@
+package language_test
+
+import (
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/language"
+)
+
+func TestDetect(t *testing.T) {
+	tc := []struct {
+		text string
+		lang string
+	}{
+		{text: "The treatment of hypertension is based on the risk of the patient and the presence of disease.", lang: "en"},
+		{text: "Le traitement de l'hypertension est fondé sur le risque et la présence des complications pour les patients.", lang: "fr"},
+		{text: "Die Behandlung der Hypertonie ist nicht für alle Patienten mit der gleichen Dosis und von den Ärzten zu beginnen.", lang: "de"},
+		{text: "El tratamiento de la hipertensión es para los pacientes con riesgo y el uso del fármaco por vía oral.", lang: "es"},
+		{text: "12 34 56", lang: "en"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.lang, func(t *testing.T) {
+			got := language.Detect(c.text)
+			if got != c.lang {
+				t.Fatalf("expected %s, got %s", c.lang, got)
+			}
+		})
+	}
+}
+
+func TestPrefixQuery(t *testing.T) {
+	tc := []struct {
+		lang     string
+		query    string
+		expected string
+	}{
+		{lang: "fr", query: "infections graves", expected: "infect* grav*"},
+		{lang: "de", query: "Behandlungen AND Nieren", expected: "behandl* AND nier*"},
+		{lang: "fr", query: `"insuffisance rénale" OR dialyse*`, expected: `"insuffisance rénale" OR dialyse*`},
+		{lang: "fr", query: `("HTA" OR "hypertension") traitements`, expected: `("HTA" OR "hypertension") trait*`},
+		{lang: "", query: "Nieren", expected: "nieren*"},
+		{lang: "", query: "MI treatment", expected: "MI treatment*"},
+		{lang: "fr", query: "HTA et reins", expected: "HTA et rein*"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.query, func(t *testing.T) {
+			got := language.PrefixQuery(c.lang, c.query)
+			if got != c.expected {
+				t.Fatalf("expected %s, got %s", c.expected, got)
+			}
+		})
+	}
+}
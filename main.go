@@ -11,14 +11,6 @@ import (
 	"github.com/abiiranathan/pdfsearch/server"
 )
 
-const (
-	// Temporary storage for generated images
-	pagesDir = "pages"
-
-	// Path to the database
-	dbPath = "pdfsearch.db"
-)
-
 //go:embed all:templates
 var viewsFs embed.FS
 
@@ -28,8 +20,8 @@ var staticFs embed.FS
 // Default configuration for the CLI
 var config = &cli.DefaultConfig
 
-func startServer() {
-	server.Run(config, pagesDir, viewsFs, staticFs)
+func startServer(store *database.Store) {
+	server.Run(config, store, viewsFs, staticFs)
 }
 
 func main() {
@@ -39,6 +31,11 @@ func main() {
 	// Set the locale to the system's default
 	pdf.SetLocale()
 
+	// Read the config file and the environment. Flags take precedence.
+	if err := cli.LoadConfig(config); err != nil {
+		log.Fatalln(err)
+	}
+
 	// Parse the command line arguments
 	ctx := cli.DefineFlags(config, startServer)
 	subcmd, err := ctx.Parse(os.Args)
@@ -52,12 +49,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Connect to the database or fail if we cannot connect.
-	database.Connect(dbPath)
-	if err := database.CreateTables(); err != nil {
-		log.Fatalf("unable to create tables: %v\n", err)
-	}
-
-	// Run the subcommand
+	// Run the subcommand. Subcommands using the database connect
+	// to it and apply pending migrations first.
 	subcmd.Handler()
 }
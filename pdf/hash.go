@@ -0,0 +1,25 @@
+package pdf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// GetContentHash returns the hex encoded SHA-256 hash of the content of the
+// file at path. Unlike GetPathHash, it identifies a document wherever it is
+// moved or copied.
+func GetContentHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
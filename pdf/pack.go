@@ -0,0 +1,46 @@
+package pdf
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// A page of a document to compile into a pdf.
+type PageRef struct {
+	Path    string // Path to the pdf
+	FileID  int    // ID of the document in the index, 0 if unknown
+	PageNum int    // 0-indexed page number
+	Stamp   string // Text printed in the bottom left corner, if not empty
+}
+
+// PackStamp returns the stamp of the nth page of a reading pack, numbered
+// from 1, which cites its source.
+func PackStamp(n int, page PageRef) string {
+	return fmt.Sprintf("[%d] %s, page %d", n, filepath.Base(page.Path), page.PageNum+1)
+}
+
+// PackIndex returns the lines of the index page of a reading pack of pages
+// found by query: the query and a citation of every page, in order.
+// Pages are cited by file name and document ID, never by their path on
+// the server.
+func PackIndex(query string, pages []PageRef) []string {
+	lines := []string{"Reading pack"}
+	if query != "" {
+		lines = append(lines, "Search: "+query)
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("%d pages, compiled by pdfsearch on %s", len(pages), time.Now().Format("2006-01-02")),
+		"",
+	)
+
+	for i, page := range pages {
+		citation := fmt.Sprintf("[%d] %s, page %d", i+1, filepath.Base(page.Path), page.PageNum+1)
+		if page.FileID != 0 {
+			citation += fmt.Sprintf(" (document %d)", page.FileID)
+		}
+		lines = append(lines, citation)
+	}
+	return lines
+}
@@ -0,0 +1,34 @@
+package pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackStamp(t *testing.T) {
+	stamp := PackStamp(3, PageRef{Path: "/books/cardiology.pdf", PageNum: 41})
+	if stamp != "[3] cardiology.pdf, page 42" {
+		t.Fatalf("unexpected stamp %q", stamp)
+	}
+}
+
+func TestPackIndex(t *testing.T) {
+	pages := []PageRef{
+		{Path: "/books/cardiology.pdf", FileID: 1234567, PageNum: 0},
+		{Path: "/books/infectiologie.pdf", PageNum: 4},
+	}
+
+	lines := PackIndex("infarction", pages)
+	if lines[0] != "Reading pack" || lines[1] != "Search: infarction" {
+		t.Fatalf("expected the title and the query, got %q", lines[:2])
+	}
+
+	citations := lines[len(lines)-2:]
+	if citations[0] != "[1] cardiology.pdf, page 1 (document 1234567)" || citations[1] != "[2] infectiologie.pdf, page 5" {
+		t.Errorf("unexpected citations %q", citations)
+	}
+
+	if lines := PackIndex("", pages); strings.HasPrefix(lines[1], "Search:") {
+		t.Errorf("expected no query line, got %q", lines[1])
+	}
+}
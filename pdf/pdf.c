@@ -230,6 +230,191 @@ bool render_page_to_pdf(const char* pdf_path, int page_num, const char* output_p
     return status;
 }
 
+// Draw line at x, y, wrapped to max_width at spaces.
+// Returns the y coordinate of the next line.
+static double draw_wrapped_line(cairo_t* cr, const char* line, double x, double y, double max_width,
+                                double line_height) {
+    GString* current = g_string_new(NULL);
+    char** words = g_strsplit(line, " ", -1);
+
+    for (int i = 0; words[i] != NULL; i++) {
+        if (*words[i] == '\0') {
+            continue;
+        }
+
+        GString* candidate = g_string_new(current->str);
+        if (current->len > 0) {
+            g_string_append_c(candidate, ' ');
+        }
+        g_string_append(candidate, words[i]);
+
+        cairo_text_extents_t extents;
+        cairo_text_extents(cr, candidate->str, &extents);
+        if (extents.x_advance > max_width && current->len > 0) {
+            cairo_move_to(cr, x, y);
+            cairo_show_text(cr, current->str);
+            y += line_height;
+            g_string_assign(current, words[i]);
+        } else {
+            g_string_assign(current, candidate->str);
+        }
+        g_string_free(candidate, TRUE);
+    }
+
+    if (current->len > 0) {
+        cairo_move_to(cr, x, y);
+        cairo_show_text(cr, current->str);
+        y += line_height;
+    }
+
+    g_strfreev(words);
+    g_string_free(current, TRUE);
+    return y;
+}
+
+// Size of the cover pages, A4 in points. Other pages keep their own size.
+#define COVER_WIDTH 595.0
+#define COVER_HEIGHT 842.0
+
+// Draw the lines of text from the top margin of cover pages, the first one
+// in bold as a title. Lines are wrapped to the width of the page and new
+// pages are started when the text reaches the bottom margin.
+static void draw_text_pages(cairo_t* cr, const char* text) {
+    const double margin = 72.0;
+    double y = margin * 2;
+
+    cairo_set_source_rgb(cr, 0, 0, 0);
+
+    char** lines = g_strsplit(text, "\n", -1);
+    for (int i = 0; lines[i] != NULL; i++) {
+        double size = i == 0 ? 20.0 : 12.0;
+        if (y > COVER_HEIGHT - margin - size) {
+            cairo_show_page(cr);
+            y = margin;
+        }
+
+        cairo_select_font_face(cr, "sans-serif", CAIRO_FONT_SLANT_NORMAL,
+                               i == 0 ? CAIRO_FONT_WEIGHT_BOLD : CAIRO_FONT_WEIGHT_NORMAL);
+        cairo_set_font_size(cr, size);
+
+        y = draw_wrapped_line(cr, lines[i], margin, y, COVER_WIDTH - 2 * margin, size * 1.4);
+        y += size * 0.6;
+    }
+    g_strfreev(lines);
+}
+
+// Draw stamp in the bottom left corner of a page of the given height,
+// on a white background so that it is readable over the content.
+static void draw_stamp(cairo_t* cr, double height, const char* stamp) {
+    const double margin = 6.0;
+
+    cairo_select_font_face(cr, "sans-serif", CAIRO_FONT_SLANT_NORMAL, CAIRO_FONT_WEIGHT_NORMAL);
+    cairo_set_font_size(cr, 8.0);
+
+    cairo_text_extents_t extents;
+    cairo_text_extents(cr, stamp, &extents);
+
+    cairo_set_source_rgba(cr, 1, 1, 1, 0.85);
+    cairo_rectangle(cr, 0, height - 8.0 - 2 * margin, extents.x_advance + 2 * margin, 8.0 + 2 * margin);
+    cairo_fill(cr);
+
+    cairo_set_source_rgb(cr, 0.3, 0.3, 0.3);
+    cairo_move_to(cr, margin, height - margin - 1.0);
+    cairo_show_text(cr, stamp);
+}
+
+// Write pages of documents to a multi-page pdf at output_pdf, after cover
+// pages with the lines of cover if it is not empty. Page i is page pages[i],
+// numbered from 0, of the document at paths[i], stamped with stamps[i] if
+// stamps is not NULL and stamps[i] is not empty. Consecutive pages of the
+// same document open it once. Pages keep their size and are rendered as vectors.
+// Returns false if a document cannot be opened, a page is out of range
+// or the output cannot be written.
+bool compile_pdf(const char** paths, const int* pages, const char** stamps, int num_pages,
+                 const char* cover, const char* output_pdf) {
+    lock_cairo_mutex();
+
+    cairo_surface_t* surface = cairo_pdf_surface_create(output_pdf, COVER_WIDTH, COVER_HEIGHT);
+    if (cairo_surface_status(surface) != CAIRO_STATUS_SUCCESS) {
+        puts("Error creating PDF surface");
+        cairo_surface_destroy(surface);
+        unlock_cairo_mutex();
+        return false;
+    }
+
+    cairo_t* cr = cairo_create(surface);
+    if (cover != NULL && *cover != '\0') {
+        draw_text_pages(cr, cover);
+        cairo_show_page(cr);
+    }
+
+    bool ok = true;
+    PopplerDocument* doc = NULL;
+    const char* doc_path = NULL;
+    int doc_pages = 0;
+
+    for (int i = 0; i < num_pages; i++) {
+        if (doc == NULL || strcmp(doc_path, paths[i]) != 0) {
+            if (doc != NULL) {
+                g_object_unref(doc);
+            }
+
+            doc_path = paths[i];
+            doc = open_document(doc_path, &doc_pages);
+            if (doc == NULL) {
+                printf("Error opening document %s\n", doc_path);
+                ok = false;
+                break;
+            }
+        }
+
+        if (pages[i] < 0 || pages[i] >= doc_pages) {
+            printf("Page %d is out of range of %s\n", pages[i], doc_path);
+            ok = false;
+            break;
+        }
+
+        PopplerPage* page = poppler_document_get_page(doc, pages[i]);
+        if (page == NULL) {
+            printf("PopplerPage for page %d is NULL\n", pages[i]);
+            ok = false;
+            break;
+        }
+
+        double width, height;
+        poppler_page_get_size(page, &width, &height);
+        cairo_pdf_surface_set_size(surface, width, height);
+
+        cairo_save(cr);
+        poppler_page_render_for_printing(page, cr);
+        cairo_restore(cr);
+
+        if (stamps != NULL && stamps[i] != NULL && *stamps[i] != '\0') {
+            cairo_save(cr);
+            draw_stamp(cr, height, stamps[i]);
+            cairo_restore(cr);
+        }
+        cairo_show_page(cr);
+
+        g_object_unref(page);
+    }
+
+    if (doc != NULL) {
+        g_object_unref(doc);
+    }
+
+    cairo_destroy(cr);
+    cairo_surface_finish(surface);
+    if (cairo_surface_status(surface) != CAIRO_STATUS_SUCCESS) {
+        puts("Error writing PDF surface");
+        ok = false;
+    }
+    cairo_surface_destroy(surface);
+
+    unlock_cairo_mutex();
+    return ok;
+}
+
 static void process_page(PopplerPage* page, gpointer user_data) {
     GPtrArray* text_array = (GPtrArray*)user_data;
     char* text = poppler_page_get_text(page);
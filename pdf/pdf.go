@@ -189,6 +189,49 @@ func RenderPageToPDF(pageNum int, pdfPath, outPdf string) bool {
 	return bool(cbool)
 }
 
+// Write pages of the pdf at pdfPath, numbered from 0, to a multi-page pdf at
+// outPdf in a single cgo call, after a cover page with the lines of cover if
+// there are any. Returns true if every page was written.
+func ExtractPages(pdfPath string, pages []int, cover []string, outPdf string) bool {
+	refs := make([]PageRef, len(pages))
+	for i, page := range pages {
+		refs[i] = PageRef{Path: pdfPath, PageNum: page}
+	}
+	return CompilePages(refs, cover, outPdf)
+}
+
+// Write pages of several pdfs to a multi-page pdf at outPdf in a single cgo
+// call, after cover pages with the lines of cover if there are any.
+// Pages are stamped with their Stamp. Returns true if every page was written.
+func CompilePages(pages []PageRef, cover []string, outPdf string) bool {
+	if len(pages) == 0 {
+		return false
+	}
+
+	c_output := C.CString(outPdf)
+	defer C.free(unsafe.Pointer(c_output))
+
+	c_cover := C.CString(strings.Join(cover, "\n"))
+	defer C.free(unsafe.Pointer(c_cover))
+
+	// The strings are allocated by C, so the arrays hold no Go pointers.
+	c_paths := make([]*C.char, len(pages))
+	c_stamps := make([]*C.char, len(pages))
+	c_pages := make([]C.int, len(pages))
+	for i, page := range pages {
+		c_paths[i] = C.CString(page.Path)
+		defer C.free(unsafe.Pointer(c_paths[i]))
+
+		c_stamps[i] = C.CString(page.Stamp)
+		defer C.free(unsafe.Pointer(c_stamps[i]))
+
+		c_pages[i] = C.int(page.PageNum)
+	}
+
+	cbool := C.compile_pdf(&c_paths[0], &c_pages[0], &c_stamps[0], C.int(len(pages)), c_cover, c_output)
+	return bool(cbool)
+}
+
 // Render a pdf page to a PNG image in a single cgo call.
 // Faster that opening the document, getting a page and calling page.Render().
 // Returns true if the image was rendered successfully.
@@ -203,8 +246,14 @@ func RenderPageToImage(pageNum int, pdfPath, outPng string) bool {
 	return bool(cbool)
 }
 
-// Get the text content of the page.
+// Get the text content of the page, without punctuation and lines of
+// only dots or numbers, as it is indexed.
 func (page *Page) Text() string {
+	return cleanText(page.RawText())
+}
+
+// Get the text of the page as laid out by poppler, with its punctuation.
+func (page *Page) RawText() string {
 	if page == nil || page.page == nil {
 		return ""
 	}
@@ -220,7 +269,21 @@ func (page *Page) Text() string {
 		return ""
 	}
 	defer C.g_free(C.gpointer(g_text))
-	return cleanText(C.GoString(g_text))
+	return C.GoString(g_text)
+}
+
+// Extract the raw text of a page of the pdf at path.
+// Returns false if the document or the page could not be opened.
+func ExtractPageText(path string, pageNum int) (string, bool) {
+	doc := Open(path)
+	defer doc.Close()
+
+	page := doc.GetPage(pageNum)
+	if page == nil {
+		return "", false
+	}
+	defer page.Close()
+	return page.RawText(), true
 }
 
 func cleanText(text string) string {
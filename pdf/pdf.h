@@ -8,6 +8,7 @@
 #include <stdbool.h>
 #include <stdio.h>
 #include <stdlib.h>
+#include <string.h>
 
 #ifdef _WIN32
 #include <windows.h>
@@ -51,6 +52,15 @@ bool render_page_from_document(const char* pdf_path, int page_num, const char* o
 // Returns true if the page was rendered successfully, false otherwise.
 bool render_page_to_pdf(const char* pdf_path, int page_num, const char* output_pdf);
 
+// Write pages of documents to a multi-page pdf at output_pdf, after cover pages
+// with the lines of cover if it is not empty. The first line of the cover is its title.
+// Page i is page pages[i], numbered from 0, of the document at paths[i], stamped
+// with stamps[i] in its bottom left corner if stamps is not NULL and stamps[i]
+// is not empty.
+// Returns true if every page was written, false otherwise.
+bool compile_pdf(const char** paths, const int* pages, const char** stamps, int num_pages,
+                 const char* cover, const char* output_pdf);
+
 // Read the whole PDF file in parallel extracting the text from each page.
 // The text is stored in the text parameter, which must be freed by the caller.
 // The number of pages in the document is stored in the num_pages parameter.
@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsePageRanges parses a list of pages and ranges numbered from 1,
+// e.g. "120-134,140", into page numbers from 0 in the order given,
+// without duplicates. Every page must be between 1 and numPages.
+func ParsePageRanges(ranges string, numPages int) ([]int, error) {
+	pages := []int{}
+	seen := make(map[int]bool)
+
+	for _, part := range strings.Split(ranges, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("invalid page %q", part)
+		}
+
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		}
+
+		if start < 1 || end > numPages {
+			return nil, fmt.Errorf("%q is out of the pages 1-%d of the document", part, numPages)
+		}
+
+		for page := start; page <= end; page++ {
+			if !seen[page] {
+				seen[page] = true
+				pages = append(pages, page-1)
+			}
+		}
+	}
+
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages given")
+	}
+	return pages, nil
+}
+
+// FormatPageRanges formats page numbers from 0 as ranges numbered from 1,
+// e.g. "120-134, 140". Consecutive pages are merged into ranges.
+func FormatPageRanges(pages []int) string {
+	parts := []string{}
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i]+1, pages[j]+1))
+		} else {
+			parts = append(parts, strconv.Itoa(pages[i]+1))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ExtractFileName returns the file name of an extract of pages, numbered
+// from 0, from the document named name, e.g. guideline-pages-120-134_140.pdf.
+func ExtractFileName(name string, pages []int) string {
+	ranges := strings.ReplaceAll(FormatPageRanges(pages), ", ", "_")
+	return fmt.Sprintf("%s-pages-%s.pdf", strings.TrimSuffix(name, filepath.Ext(name)), ranges)
+}
+
+// ExtractCover returns the lines of the cover page of pages, numbered from 0,
+// extracted from the document at path with numPages pages and fileID in the
+// index. The source is cited by file name, not by its path on the server.
+func ExtractCover(path string, fileID int, pages []int, numPages int) []string {
+	return []string{
+		filepath.Base(path),
+		fmt.Sprintf("Pages %s of %d", FormatPageRanges(pages), numPages),
+		fmt.Sprintf("Source: %s, document %d", filepath.Base(path), fileID),
+		"Extracted by pdfsearch on " + time.Now().Format("2006-01-02"),
+	}
+}
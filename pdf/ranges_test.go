@@ -0,0 +1,51 @@
+package pdf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		ranges   string
+		expected []int
+	}{
+		{"120-134,140", []int{119, 120, 121, 122, 123, 124, 125, 126, 127, 128, 129, 130, 131, 132, 133, 139}},
+		{" 3 , 1-2, 2", []int{2, 0, 1}},
+		{"200", []int{199}},
+	}
+
+	for _, test := range tests {
+		pages, err := ParsePageRanges(test.ranges, 200)
+		if err != nil {
+			t.Fatalf("%q: %v", test.ranges, err)
+		}
+
+		if !reflect.DeepEqual(pages, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.ranges, test.expected, pages)
+		}
+	}
+
+	for _, invalid := range []string{"", "0", "201", "5-3", "a-b", "1-", "190-210"} {
+		if _, err := ParsePageRanges(invalid, 200); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestFormatPageRanges(t *testing.T) {
+	pages := []int{119, 120, 121, 139, 2, 3}
+	if got := FormatPageRanges(pages); got != "120-122, 140, 3-4" {
+		t.Errorf("unexpected ranges %q", got)
+	}
+
+	if got := ExtractFileName("guideline.pdf", pages); got != "guideline-pages-120-122_140_3-4.pdf" {
+		t.Errorf("unexpected file name %q", got)
+	}
+
+	cover := strings.Join(ExtractCover("/srv/books/guideline.pdf", 1234567, pages, 300), "\n")
+	if strings.Contains(cover, "/srv/books") || !strings.Contains(cover, "Source: guideline.pdf, document 1234567") {
+		t.Errorf("expected the cover to cite the file name, not its path: %q", cover)
+	}
+}
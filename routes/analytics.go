@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+// Number of searches shown in the history of a user.
+const historyLength = 100
+
+// Number of queries in each table of the analytics page.
+const analyticsRows = 20
+
+// Default number of days covered by the analytics page.
+const defaultAnalyticsDays = 30
+
+// Record a search in the query log. Returns its ID, 0 if it could not be
+// recorded, which does not fail the search.
+func logQuery(ctx context.Context, store *database.Store, entry database.QueryLogEntry) int64 {
+	id, err := store.LogQuery(ctx, entry)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return id
+}
+
+// Record the result opened from a logged search, from the form values
+// log_id, book and page. Sent by the browser with navigator.sendBeacon.
+func LogClick(store *database.Store, queryLog database.QueryLogOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !queryLog.Enabled {
+			http.Error(w, "Query logging is disabled", http.StatusNotFound)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, err1 := strconv.ParseInt(r.PostForm.Get("log_id"), 10, 64)
+		book, err2 := strconv.Atoi(r.PostForm.Get("book"))
+		page, err3 := strconv.Atoi(r.PostForm.Get("page"))
+		if err := errors.Join(err1, err2, err3); err != nil {
+			http.Error(w, "Invalid click: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := store.LogClick(r.Context(), userID(r), id, book, page)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Search not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Show the most frequent, zero-result and slowest queries of the last days,
+// 30 by default.
+func Analytics(store *database.Store, tmpl *template.Template, queryLog database.QueryLogOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days := defaultAnalyticsDays
+		if value := r.URL.Query().Get("days"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid number of days", http.StatusBadRequest)
+				return
+			}
+			days = n
+		}
+
+		ctx := r.Context()
+		since := time.Now().AddDate(0, 0, -days)
+
+		top, err := store.TopQueries(ctx, since, analyticsRows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		zero, err := store.ZeroResultQueries(ctx, since, analyticsRows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		slow, err := store.SlowQueries(ctx, since, analyticsRows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = tmpl.ExecuteTemplate(w, "analytics.html", map[string]any{
+			"days":     days,
+			"queryLog": queryLog,
+			"top":      top,
+			"zero":     zero,
+			"slow":     slow,
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Show the latest searches of the user.
+func History(store *database.Store, tmpl *template.Template, queryLog database.QueryLogOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		searches, err := store.History(r.Context(), userID(r), historyLength)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type searchView struct {
+			database.QueryLogEntry
+			ClickedPageNumber int // Numbered from 1
+		}
+
+		views := make([]searchView, len(searches))
+		for i, search := range searches {
+			views[i] = searchView{QueryLogEntry: search, ClickedPageNumber: search.ClickedPageNum + 1}
+		}
+
+		err = tmpl.ExecuteTemplate(w, "history.html", map[string]any{
+			"queryLog": queryLog,
+			"searches": views,
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+func TestQueryLogging(t *testing.T) {
+	store := openStore(t)
+	dict := synonyms.New(nil)
+
+	response := search(t, Search(store, dict, database.QueryLogOptions{}), "/search?query=hypertension")
+	if response.LogID != 0 {
+		t.Fatalf("expected searches not to be logged by default, got log id %d", response.LogID)
+	}
+
+	queryLog := database.QueryLogOptions{Enabled: true, Retention: 30}
+	w := httptest.NewRecorder()
+	Search(store, dict, queryLog)(w, httptest.NewRequest(http.MethodGet, "/search?query=hypertension&book=1", nil))
+	if cache := w.Header().Get("Cache-Control"); cache != "no-store" {
+		t.Errorf("expected logged searches not to be cached, got Cache-Control %q", cache)
+	}
+
+	response = search(t, Search(store, dict, queryLog), "/search?query=hypertension&book=1")
+	if response.LogID == 0 {
+		t.Fatal("expected the search to be logged")
+	}
+
+	clicks := []struct {
+		form   string
+		status int
+	}{
+		{"log_id=" + strconv.FormatInt(response.LogID, 10) + "&book=1&page=1", http.StatusNoContent},
+		{"log_id=999&book=1&page=1", http.StatusNotFound},
+		{"log_id=x&book=1&page=1", http.StatusBadRequest},
+	}
+
+	for _, click := range clicks {
+		r := httptest.NewRequest(http.MethodPost, "/search/click", strings.NewReader(click.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		LogClick(store, queryLog)(w, r)
+
+		if w.Code != click.status {
+			t.Errorf("POST %s: expected status %d, got %d", click.form, click.status, w.Code)
+		}
+	}
+
+	entries, err := store.QueryLog(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := entries[len(entries)-1]
+	if len(entries) != 2 || last.Book != 1 || last.Hits != 1 || last.Clicks != 1 || last.ClickedPageNum != 1 {
+		t.Fatalf("expected 2 logged searches with a click on page 1, got %+v", entries)
+	}
+}
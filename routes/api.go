@@ -0,0 +1,597 @@
+package routes
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/language"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// Prefix of the routes of the REST API. Breaking changes get a new version.
+const apiPrefix = "/api/v1"
+
+// The OpenAPI description of the REST API, served at /api/v1/openapi.json.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Codes of the API errors.
+const (
+	ErrInvalidParameter = "invalid_parameter" // A parameter is missing or malformed
+	ErrInvalidQuery     = "invalid_query"     // The search query could not be parsed
+	ErrNotFound         = "not_found"         // The document, page, bookmark or route does not exist
+	ErrUnauthorized     = "unauthorized"      // Authentication is required and the credentials are missing or invalid
+	ErrInternal         = "internal_error"    // The server failed to handle the request
+)
+
+// Default and maximum number of items of a paginated response.
+const (
+	defaultLimit = 20
+	maxLimit     = 200
+)
+
+// Formats of the search snippets.
+const (
+	SnippetsOffsets = "offsets" // Plain text with the offsets of the matches
+	SnippetsRaw     = "raw"     // Text with the matches between <b> and </b>
+)
+
+// Every error of the API responds with this envelope.
+type APIError struct {
+	Error APIErrorBody `json:"error"`
+}
+
+type APIErrorBody struct {
+	Status  int    `json:"status"`  // HTTP status code
+	Code    string `json:"code"`    // One of the Err* codes
+	Message string `json:"message"` // Description for humans
+}
+
+// A match in a text, from Start to End (excluded), counted in Unicode
+// code points.
+type APIHighlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Text from a page with its matches.
+type APISnippet struct {
+	Text       string         `json:"text"`
+	Highlights []APIHighlight `json:"highlights"` // Empty for raw snippets
+}
+
+type APISearchHit struct {
+	DocumentID int        `json:"document_id"`
+	Document   string     `json:"document"` // File name
+	Page       int        `json:"page"`     // Numbered from 1
+	Title      APISnippet `json:"title"`    // Short snippet
+	Snippet    APISnippet `json:"snippet"`
+	Note       bool       `json:"note"` // The snippet is the note of a bookmark
+}
+
+type APISearchResponse struct {
+	Query       string         `json:"query"`    // The query as given
+	Searched    string         `json:"searched"` // The query as searched, after synonym expansion
+	Mode        string         `json:"mode"`     // Search mode used, substring after a fallback
+	Total       int            `json:"total"`    // Number of hits before pagination
+	Offset      int            `json:"offset"`
+	Limit       int            `json:"limit"`
+	Results     []APISearchHit `json:"results"`
+	Suggestions []string       `json:"suggestions"` // Corrected queries when there are few hits
+}
+
+type APIDocument struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Language   string `json:"language"`   // ISO 639-1 code
+	IndexedAt  string `json:"indexed_at"` // UTC, empty if unknown
+	Pages      int    `json:"pages"`
+	EmptyPages int    `json:"empty_pages"` // Pages without text, e.g. scanned images
+	Characters int    `json:"characters"`
+}
+
+type APIDocumentList struct {
+	Total     int           `json:"total"`
+	Offset    int           `json:"offset"`
+	Limit     int           `json:"limit"`
+	Documents []APIDocument `json:"documents"`
+}
+
+type APIPageInfo struct {
+	Page       int `json:"page"` // Numbered from 1
+	Characters int `json:"characters"`
+}
+
+type APIPageList struct {
+	DocumentID int           `json:"document_id"`
+	Pages      []APIPageInfo `json:"pages"`
+}
+
+type APIPage struct {
+	DocumentID int            `json:"document_id"`
+	Page       int            `json:"page"` // Numbered from 1
+	Language   string         `json:"language"`
+	Text       string         `json:"text"`
+	Highlights []APIHighlight `json:"highlights"` // Matches of the q parameter
+}
+
+type APILanguage struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type APIMetadata struct {
+	APIVersion    string        `json:"api_version"`
+	SchemaVersion int           `json:"schema_version"` // Version of the database schema
+	Documents     int           `json:"documents"`
+	Languages     []APILanguage `json:"languages"`
+	TrigramIndex  bool          `json:"trigram_index"` // Whether substring searches are available
+}
+
+// A route of the API, relative to apiPrefix.
+type apiRoute struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+}
+
+// The routes of the API, which must match the paths of openapi.json.
+func apiRoutes(store *database.Store, dict *synonyms.Dictionary) []apiRoute {
+	return []apiRoute{
+		{http.MethodGet, "/openapi.json", APISpec},
+		{http.MethodGet, "/metadata", APIGetMetadata(store)},
+		{http.MethodGet, "/search", APISearch(store, dict)},
+		{http.MethodGet, "/documents", APIListDocuments(store)},
+		{http.MethodGet, "/documents/{id}", APIGetDocument(store)},
+		{http.MethodGet, "/documents/{id}/pages", APIListPages(store)},
+		{http.MethodGet, "/documents/{id}/pages/{page}", APIGetPage(store)},
+		{http.MethodGet, "/documents/{id}/pages/{page}/text", APIGetPageText(store)},
+		{http.MethodGet, "/bookmarks", APIListBookmarks(store)},
+		{http.MethodPost, "/bookmarks", APICreateBookmark(store)},
+		{http.MethodGet, "/bookmarks/{id}", APIGetBookmark(store)},
+		{http.MethodPatch, "/bookmarks/{id}", APIUpdateBookmark(store)},
+		{http.MethodDelete, "/bookmarks/{id}", APIDeleteBookmark(store)},
+	}
+}
+
+// Register the routes of the API on mux. Unknown routes under the prefix
+// get a not_found error.
+func setupAPIRoutes(mux *http.ServeMux, store *database.Store, dict *synonyms.Dictionary) {
+	for _, route := range apiRoutes(store, dict) {
+		mux.HandleFunc(route.Method+" "+apiPrefix+route.Path, route.Handler)
+	}
+
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, ErrNotFound, "No route "+r.URL.Path)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIError{APIErrorBody{Status: status, Code: code, Message: message}})
+}
+
+// Respond with a not_found error for sql.ErrNoRows, an internal error
+// otherwise.
+func writeStoreError(w http.ResponseWriter, err error, what string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, ErrNotFound, what+" not found")
+		return
+	}
+
+	log.Printf("api: %s: %v\n", what, err)
+	writeAPIError(w, http.StatusInternalServerError, ErrInternal, "Unable to get "+strings.ToLower(what))
+}
+
+// The integer parameter name of r, def if it is absent. Writes an
+// invalid_parameter error and returns false if it is not in [min, max].
+func intParam(w http.ResponseWriter, r *http.Request, name string, def, min, max int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter,
+			fmt.Sprintf("%s must be an integer between %d and %d", name, min, max))
+		return 0, false
+	}
+	return n, true
+}
+
+// The document ID of the path of r.
+func documentParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid document id")
+		return 0, false
+	}
+	return id, true
+}
+
+// The document ID and the 0-indexed page number of the path of r,
+// which numbers pages from 1.
+func pageParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	id, ok := documentParam(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	page, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil || page < 1 {
+		writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid page number, pages are numbered from 1")
+		return 0, 0, false
+	}
+	return id, page - 1, true
+}
+
+// The items of a list from offset, at most limit.
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+// Remove the open and close markers from text and return the offsets of
+// the text between them, in code points.
+func splitHighlights(text, open, close string) (string, []APIHighlight) {
+	var b strings.Builder
+	highlights := []APIHighlight{}
+	position, start := 0, -1
+
+	for len(text) > 0 {
+		switch {
+		case strings.HasPrefix(text, open) && start < 0:
+			start = position
+			text = text[len(open):]
+		case strings.HasPrefix(text, close) && start >= 0:
+			highlights = append(highlights, APIHighlight{Start: start, End: position})
+			start = -1
+			text = text[len(close):]
+		default:
+			r, size := utf8.DecodeRuneInString(text)
+			b.WriteRune(r)
+			position++
+			text = text[size:]
+		}
+	}
+	return b.String(), highlights
+}
+
+// A snippet of the search results in format.
+func apiSnippet(snippet, format string) APISnippet {
+	if format == SnippetsRaw {
+		return APISnippet{Text: snippet, Highlights: []APIHighlight{}}
+	}
+
+	text, highlights := splitHighlights(snippet, "<b>", "</b>")
+	return APISnippet{Text: text, Highlights: highlights}
+}
+
+func apiDocument(file database.FileStats) APIDocument {
+	return APIDocument{
+		ID:         file.ID,
+		Name:       file.Name,
+		Language:   file.Language,
+		IndexedAt:  file.IndexedAt,
+		Pages:      file.Pages,
+		EmptyPages: file.EmptyPages,
+		Characters: file.Characters,
+	}
+}
+
+// Serve the OpenAPI description of the API.
+func APISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// Describe the index: its documents, languages and capabilities.
+func APIGetMetadata(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		files, err := store.GetFiles(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "Documents")
+			return
+		}
+
+		codes, err := store.GetLanguages(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "Languages")
+			return
+		}
+
+		version, err := store.SchemaVersion(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "Schema version")
+			return
+		}
+
+		trigram, err := store.HasTrigramIndex(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "Trigram index")
+			return
+		}
+
+		languages := make([]APILanguage, len(codes))
+		for i, code := range codes {
+			languages[i] = APILanguage{Code: code, Name: language.Names[code]}
+		}
+
+		writeJSON(w, http.StatusOK, APIMetadata{
+			APIVersion:    "v1",
+			SchemaVersion: version,
+			Documents:     len(files),
+			Languages:     languages,
+			TrigramIndex:  trigram,
+		})
+	}
+}
+
+// Search the pages. The parameters are those of /search, except that the
+// query is q and books are given by repeated document parameters.
+func APISearch(store *database.Store, dict *synonyms.Dictionary) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		params := r.URL.Query()
+		query := strings.TrimSpace(params.Get("q"))
+		if query == "" {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "q is required")
+			return
+		}
+
+		lang := params.Get("lang")
+		if _, ok := language.Names[lang]; lang != "" && !ok {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Unsupported language "+lang)
+			return
+		}
+
+		mode := params.Get("mode")
+		if mode == "" {
+			mode = ModeFullText
+		}
+
+		if mode != ModeFullText && mode != ModeSubstring {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "mode must be fulltext or substring")
+			return
+		}
+
+		format := params.Get("snippets")
+		if format == "" {
+			format = SnippetsOffsets
+		}
+
+		if format != SnippetsOffsets && format != SnippetsRaw {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "snippets must be offsets or raw")
+			return
+		}
+
+		expand := true
+		if value := params.Get("expand"); value != "" {
+			var err error
+			expand, err = strconv.ParseBool(value)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "expand must be true or false")
+				return
+			}
+		}
+
+		notes := false
+		if value := params.Get("notes"); value != "" {
+			var err error
+			notes, err = strconv.ParseBool(value)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "notes must be true or false")
+				return
+			}
+		}
+
+		books := []int{}
+		for _, document := range params["document"] {
+			id, err := strconv.Atoi(document)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid document id "+document)
+				return
+			}
+			books = append(books, id)
+		}
+
+		limit, ok := intParam(w, r, "limit", defaultLimit, 1, maxLimit)
+		if !ok {
+			return
+		}
+
+		offset, ok := intParam(w, r, "offset", 0, 0, maxLimit)
+		if !ok {
+			return
+		}
+
+		response, err := runSearch(r.Context(), store, dict, query, lang, mode, expand, notes, userID(r), books)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidQuery, err.Error())
+			return
+		}
+
+		hits := []APISearchHit{}
+		for _, result := range paginate(response.Results, offset, limit) {
+			hits = append(hits, APISearchHit{
+				DocumentID: result.FileID,
+				Document:   result.BaseName,
+				Page:       result.PageNum + 1,
+				Title:      apiSnippet(result.Title, format),
+				Snippet:    apiSnippet(result.Text, format),
+				Note:       result.Note,
+			})
+		}
+
+		writeJSON(w, http.StatusOK, APISearchResponse{
+			Query:       query,
+			Searched:    response.Query,
+			Mode:        response.Mode,
+			Total:       len(response.Results),
+			Offset:      offset,
+			Limit:       limit,
+			Results:     hits,
+			Suggestions: response.Suggestions,
+		})
+	}
+}
+
+// List the indexed documents by name, optionally in one language.
+func APIListDocuments(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		limit, ok := intParam(w, r, "limit", defaultLimit, 1, maxLimit)
+		if !ok {
+			return
+		}
+
+		offset, ok := intParam(w, r, "offset", 0, 0, math.MaxInt)
+		if !ok {
+			return
+		}
+
+		files, err := store.GetFileStats(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "Documents")
+			return
+		}
+
+		lang := r.URL.Query().Get("lang")
+		documents := []APIDocument{}
+		for _, file := range files {
+			if lang == "" || file.Language == lang {
+				documents = append(documents, apiDocument(file))
+			}
+		}
+
+		writeJSON(w, http.StatusOK, APIDocumentList{
+			Total:     len(documents),
+			Offset:    offset,
+			Limit:     limit,
+			Documents: paginate(documents, offset, limit),
+		})
+	}
+}
+
+func APIGetDocument(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		id, ok := documentParam(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := store.GetFile(r.Context(), id); err != nil {
+			writeStoreError(w, err, "Document")
+			return
+		}
+
+		file, err := store.GetFileStatsByID(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, err, "Document")
+			return
+		}
+		writeJSON(w, http.StatusOK, apiDocument(file))
+	}
+}
+
+// List the pages of a document with their size.
+func APIListPages(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		id, ok := documentParam(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := store.GetFile(r.Context(), id); err != nil {
+			writeStoreError(w, err, "Document")
+			return
+		}
+
+		pages, err := store.ListPages(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, err, "Pages")
+			return
+		}
+
+		infos := make([]APIPageInfo, len(pages))
+		for i, page := range pages {
+			infos[i] = APIPageInfo{Page: page.PageNum + 1, Characters: page.Characters}
+		}
+		writeJSON(w, http.StatusOK, APIPageList{DocumentID: id, Pages: infos})
+	}
+}
+
+// Get the full text of a page with the offsets of the matches of q.
+func APIGetPage(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		id, pageNum, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+
+		page, err := store.GetPage(r.Context(), id, pageNum)
+		if err != nil {
+			writeStoreError(w, err, "Page")
+			return
+		}
+
+		text, err := store.HighlightPage(r.Context(), id, pageNum, r.URL.Query().Get("q"),
+			matchStart, matchEnd)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidQuery, err.Error())
+			return
+		}
+
+		text, highlights := splitHighlights(text, matchStart, matchEnd)
+		writeJSON(w, http.StatusOK, APIPage{
+			DocumentID: id,
+			Page:       pageNum + 1,
+			Language:   page.Language,
+			Text:       text,
+			Highlights: highlights,
+		})
+	}
+}
+
+// Get the full text of a page as plain text.
+func APIGetPageText(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		id, pageNum, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+
+		page, err := store.GetPage(r.Context(), id, pageNum)
+		if err != nil {
+			writeStoreError(w, err, "Page")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(page.Text))
+	}
+}
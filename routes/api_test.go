@@ -0,0 +1,362 @@
+package routes
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// The OpenAPI document as generic JSON.
+type openAPI map[string]any
+
+func loadOpenAPI(t *testing.T) openAPI {
+	t.Helper()
+	var spec openAPI
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+	return spec
+}
+
+// Follow a local reference like #/components/schemas/Page.
+func (spec openAPI) resolve(t *testing.T, value map[string]any) map[string]any {
+	t.Helper()
+	ref, ok := value["$ref"].(string)
+	if !ok {
+		return value
+	}
+
+	var node any = map[string]any(spec)
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok || m[key] == nil {
+			t.Fatalf("unresolved reference %s", ref)
+		}
+		node = m[key]
+	}
+	return spec.resolve(t, node.(map[string]any))
+}
+
+// Check that value, decoded from JSON, conforms to schema.
+func (spec openAPI) check(t *testing.T, schema map[string]any, value any, at string) {
+	t.Helper()
+	schema = spec.resolve(t, schema)
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			t.Errorf("%s: expected an object, got %v", at, value)
+			return
+		}
+
+		for _, key := range asSlice(schema["required"]) {
+			if _, ok := object[key.(string)]; !ok {
+				t.Errorf("%s: missing required property %q", at, key)
+			}
+		}
+
+		properties, ok := schema["properties"].(map[string]any)
+		if !ok {
+			return
+		}
+
+		for key, property := range object {
+			propertySchema, ok := properties[key].(map[string]any)
+			if !ok {
+				t.Errorf("%s: undocumented property %q", at, key)
+				continue
+			}
+			spec.check(t, propertySchema, property, at+"."+key)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			t.Errorf("%s: expected an array, got %v", at, value)
+			return
+		}
+
+		for i, item := range items {
+			spec.check(t, schema["items"].(map[string]any), item, at+"["+strconv.Itoa(i)+"]")
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			t.Errorf("%s: expected a string, got %v", at, value)
+			return
+		}
+
+		if enum := asSlice(schema["enum"]); len(enum) > 0 && !contains(enum, s) {
+			t.Errorf("%s: %q is not one of %v", at, s, enum)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			t.Errorf("%s: expected an integer, got %v", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			t.Errorf("%s: expected a boolean, got %v", at, value)
+		}
+	}
+}
+
+func asSlice(value any) []any {
+	s, _ := value.([]any)
+	return s
+}
+
+func contains(values []any, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+func newAPIMux(t *testing.T) *http.ServeMux {
+	mux := http.NewServeMux()
+	setupAPIRoutes(mux, openStore(t), synonyms.New([][]string{{"myocardial infarction", "heart attack"}}))
+	return mux
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	spec := loadOpenAPI(t)
+
+	documented := []string{}
+	for path, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	routes := []string{}
+	for _, route := range apiRoutes(nil, nil) {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+
+	sort.Strings(documented)
+	sort.Strings(routes)
+	if strings.Join(documented, "\n") != strings.Join(routes, "\n") {
+		t.Fatalf("openapi.json documents\n%s\nbut the routes are\n%s", strings.Join(documented, "\n"), strings.Join(routes, "\n"))
+	}
+}
+
+func TestAPIResponsesMatchOpenAPI(t *testing.T) {
+	spec := loadOpenAPI(t)
+	mux := newAPIMux(t)
+
+	tests := []struct {
+		path   string // Path of the operation in openapi.json
+		url    string
+		status int
+	}{
+		{"/openapi.json", "/openapi.json", http.StatusOK},
+		{"/metadata", "/metadata", http.StatusOK},
+		{"/search", "/search?q=heart+attack", http.StatusOK},
+		{"/search", "/search?q=infection&lang=fr&snippets=raw", http.StatusOK},
+		{"/search", "/search?q=hypertension&document=1&limit=1&offset=0", http.StatusOK},
+		{"/search", "/search", http.StatusBadRequest},
+		{"/search", "/search?q=x&lang=xx", http.StatusBadRequest},
+		{"/search", "/search?q=x&mode=fuzzy", http.StatusBadRequest},
+		{"/search", "/search?q=x&limit=1000", http.StatusBadRequest},
+		{"/search", "/search?q=x&document=abc", http.StatusBadRequest},
+		{"/search", "/search?q=%22unbalanced", http.StatusBadRequest},
+		{"/documents", "/documents", http.StatusOK},
+		{"/documents", "/documents?lang=fr&limit=1", http.StatusOK},
+		{"/documents", "/documents?offset=-1", http.StatusBadRequest},
+		{"/documents/{id}", "/documents/1", http.StatusOK},
+		{"/documents/{id}", "/documents/99", http.StatusNotFound},
+		{"/documents/{id}", "/documents/abc", http.StatusBadRequest},
+		{"/documents/{id}/pages", "/documents/1/pages", http.StatusOK},
+		{"/documents/{id}/pages", "/documents/99/pages", http.StatusNotFound},
+		{"/documents/{id}/pages/{page}", "/documents/1/pages/1?q=infarction", http.StatusOK},
+		{"/documents/{id}/pages/{page}", "/documents/1/pages/9", http.StatusNotFound},
+		{"/documents/{id}/pages/{page}", "/documents/1/pages/0", http.StatusBadRequest},
+		{"/documents/{id}/pages/{page}/text", "/documents/2/pages/5/text", http.StatusOK},
+		{"/documents/{id}/pages/{page}/text", "/documents/2/pages/1/text", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+test.url, nil))
+
+		if w.Code != test.status {
+			t.Errorf("GET %s: expected status %d, got %d: %s", test.url, test.status, w.Code, w.Body)
+			continue
+		}
+
+		// Paths on the server are not exposed.
+		if strings.Contains(w.Body.String(), "/books/cardiology.pdf") || strings.Contains(w.Body.String(), "/books/infectiologie.pdf") {
+			t.Errorf("GET %s: the response contains the path of a document: %s", test.url, w.Body)
+		}
+		spec.checkResponse(t, http.MethodGet, test.path, test.url, w)
+	}
+}
+
+// Check that the response w to the operation method path, requested at url,
+// is documented in the spec.
+func (spec openAPI) checkResponse(t *testing.T, method, path, url string, w *httptest.ResponseRecorder) {
+	t.Helper()
+	at := method + " " + url
+
+	operation := spec["paths"].(map[string]any)[path].(map[string]any)[strings.ToLower(method)].(map[string]any)
+	response, ok := operation["responses"].(map[string]any)[strconv.Itoa(w.Code)].(map[string]any)
+	if !ok {
+		t.Errorf("%s: status %d is not documented", at, w.Code)
+		return
+	}
+
+	response = spec.resolve(t, response)
+	if w.Code == http.StatusNoContent {
+		return
+	}
+
+	contentType := strings.Split(w.Header().Get("Content-Type"), ";")[0]
+	media, ok := response["content"].(map[string]any)[contentType].(map[string]any)
+	if !ok {
+		t.Errorf("%s: content type %q is not documented", at, contentType)
+		return
+	}
+
+	if contentType != "application/json" {
+		return
+	}
+
+	var body any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Errorf("%s: invalid JSON: %v", at, err)
+		return
+	}
+	spec.check(t, media["schema"].(map[string]any), body, at)
+}
+
+func TestAPIUnknownRoute(t *testing.T) {
+	w := httptest.NewRecorder()
+	newAPIMux(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+"/books", nil))
+
+	var response APIError
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusNotFound || response.Error.Code != ErrNotFound || response.Error.Status != http.StatusNotFound {
+		t.Fatalf("expected a not_found error, got %d %+v", w.Code, response)
+	}
+}
+
+func TestAPISearchHighlights(t *testing.T) {
+	mux := newAPIMux(t)
+
+	get := func(url string) APISearchResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+url, nil))
+
+		var response APISearchResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(response.Results) != 1 {
+			t.Fatalf("GET %s: expected 1 result, got %+v", url, response)
+		}
+		return response
+	}
+
+	response := get("/search?q=infarction")
+	snippet := response.Results[0].Snippet
+	if len(snippet.Highlights) != 1 || strings.Contains(snippet.Text, "<b>") {
+		t.Fatalf("unexpected snippet %+v", snippet)
+	}
+
+	highlight := snippet.Highlights[0]
+	if got := string([]rune(snippet.Text)[highlight.Start:highlight.End]); got != "infarction" {
+		t.Errorf("expected the highlight to cover infarction, got %q", got)
+	}
+
+	if response.Results[0].Page != 1 || response.Results[0].DocumentID != 1 {
+		t.Errorf("expected page 1 of document 1, got %+v", response.Results[0])
+	}
+
+	raw := get("/search?q=infarction&snippets=raw").Results[0].Snippet
+	if !strings.Contains(raw.Text, "<b>infarction</b>") || len(raw.Highlights) != 0 {
+		t.Errorf("expected a raw snippet, got %+v", raw)
+	}
+
+	// Offsets count code points, not bytes.
+	page := get("/search?q=traitées").Results[0].Snippet
+	highlight = page.Highlights[0]
+	if got := string([]rune(page.Text)[highlight.Start:highlight.End]); got != "traitées" {
+		t.Errorf("expected the highlight to cover traitées, got %q", got)
+	}
+}
+
+func TestSplitHighlights(t *testing.T) {
+	text, highlights := splitHighlights("<b>Été</b> and <b>hiver</b>", "<b>", "</b>")
+	if text != "Été and hiver" {
+		t.Fatalf("unexpected text %q", text)
+	}
+
+	expected := []APIHighlight{{0, 3}, {8, 13}}
+	if len(highlights) != 2 || highlights[0] != expected[0] || highlights[1] != expected[1] {
+		t.Fatalf("expected %v, got %v", expected, highlights)
+	}
+}
+
+func TestAPIBookmarks(t *testing.T) {
+	spec := loadOpenAPI(t)
+	mux := newAPIMux(t)
+
+	request := func(method, path, url, body string, status int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, apiPrefix+url, strings.NewReader(body)))
+
+		if w.Code != status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, url, status, w.Code, w.Body)
+		}
+		spec.checkResponse(t, method, path, url, w)
+		return w
+	}
+
+	w := request(http.MethodPost, "/bookmarks", "/bookmarks", `{"document_id": 1, "page": 1, "note": "use this table for peds dosing"}`, http.StatusCreated)
+
+	var bookmark APIBookmark
+	json.NewDecoder(w.Body).Decode(&bookmark)
+	if bookmark.DocumentID != 1 || bookmark.Page != 1 || bookmark.Note != "use this table for peds dosing" {
+		t.Fatalf("unexpected bookmark %+v", bookmark)
+	}
+
+	request(http.MethodPost, "/bookmarks", "/bookmarks", `{"document_id": 1, "page": 9}`, http.StatusNotFound)
+	request(http.MethodPost, "/bookmarks", "/bookmarks", `{"document_id": 99, "page": 1}`, http.StatusNotFound)
+	request(http.MethodPost, "/bookmarks", "/bookmarks", `{"document_id": 1, "page": 0}`, http.StatusBadRequest)
+	request(http.MethodPost, "/bookmarks", "/bookmarks", `{"document_id": 1, "page": 1, "note": "`+strings.Repeat("a", maxNoteLength+1)+`"}`, http.StatusBadRequest)
+	request(http.MethodPost, "/bookmarks", "/bookmarks", `not json`, http.StatusBadRequest)
+
+	url := "/bookmarks/" + strconv.Itoa(bookmark.ID)
+	request(http.MethodPatch, "/bookmarks/{id}", url, `{"note": "pediatric dosing"}`, http.StatusOK)
+	request(http.MethodGet, "/bookmarks/{id}", url, "", http.StatusOK)
+	request(http.MethodGet, "/bookmarks", "/bookmarks?document=1", "", http.StatusOK)
+
+	var found APISearchResponse
+	json.NewDecoder(request(http.MethodGet, "/search", "/search?q=pediatric&notes=true", "", http.StatusOK).Body).Decode(&found)
+	if len(found.Results) != 1 || !found.Results[0].Note || found.Results[0].Page != 1 {
+		t.Fatalf("expected the note to be found, got %+v", found)
+	}
+
+	request(http.MethodDelete, "/bookmarks/{id}", url, "", http.StatusNoContent)
+	request(http.MethodDelete, "/bookmarks/{id}", url, "", http.StatusNotFound)
+	request(http.MethodGet, "/bookmarks/{id}", "/bookmarks/abc", "", http.StatusBadRequest)
+
+	var list APIBookmarkList
+	json.NewDecoder(request(http.MethodGet, "/bookmarks", "/bookmarks", "", http.StatusOK).Body).Decode(&list)
+	if len(list.Bookmarks) != 0 {
+		t.Errorf("expected no bookmarks, got %+v", list)
+	}
+}
@@ -0,0 +1,257 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+// Name of the cookie of the sessions.
+const sessionCookie = "pdfsearch_session"
+
+// Paths served without authentication: the login page and its assets.
+var publicPaths = []string{"/login", "/static/"}
+
+// ErrNoCredentials is returned by an Authenticator for requests without
+// its credentials, so that the next one is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// An Authenticator identifies the user of a request from its credentials.
+type Authenticator interface {
+	// Authenticate returns the user of r, ErrNoCredentials if r has no
+	// credentials for this authenticator.
+	Authenticate(r *http.Request) (database.User, error)
+}
+
+// SessionAuth authenticates the users logged in with the session cookie.
+type SessionAuth struct {
+	Store *database.Store
+}
+
+func (a SessionAuth) Authenticate(r *http.Request) (database.User, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return database.User{}, ErrNoCredentials
+	}
+	return a.Store.SessionUser(r.Context(), cookie.Value)
+}
+
+// TokenAuth authenticates the scripts sending an API token in an
+// Authorization: Bearer header.
+type TokenAuth struct {
+	Store *database.Store
+}
+
+func (a TokenAuth) Authenticate(r *http.Request) (database.User, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return database.User{}, ErrNoCredentials
+	}
+	return a.Store.TokenUser(r.Context(), strings.TrimSpace(token))
+}
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user database.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// CurrentUser returns the authenticated user of ctx. It returns false if
+// authentication is disabled.
+func CurrentUser(ctx context.Context) (database.User, bool) {
+	user, ok := ctx.Value(userKey{}).(database.User)
+	return user, ok
+}
+
+// The ID of the user of r, 0 if authentication is disabled.
+func userID(r *http.Request) int {
+	user, _ := CurrentUser(r.Context())
+	return user.ID
+}
+
+// The view of store restricted to the documents the user of r may access.
+// Without authentication, every document is accessible.
+func storeFor(r *http.Request, store *database.Store) *database.Store {
+	if user, ok := CurrentUser(r.Context()); ok {
+		return store.As(user)
+	}
+	return store
+}
+
+// Set the Cache-Control header of a response that may be cached for maxAge
+// seconds. With authentication, responses depend on the user and the
+// documents they may access, so they are never stored by browsers or proxies.
+func setCacheControl(w http.ResponseWriter, r *http.Request, maxAge int) {
+	if _, ok := CurrentUser(r.Context()); ok {
+		w.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
+}
+
+// RequireAuth returns a middleware that identifies the user of every request
+// with the first authenticator that finds credentials, and refuses the
+// requests without valid ones, except those of the login page.
+// The user is available to the handlers with CurrentUser.
+func RequireAuth(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, path := range publicPaths {
+				if r.URL.Path == path || strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			for _, authenticator := range authenticators {
+				user, err := authenticator.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+
+				if err == nil {
+					next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+					return
+				}
+
+				if !errors.Is(err, sql.ErrNoRows) {
+					log.Printf("unable to authenticate %s: %v\n", r.URL.Path, err)
+				}
+				break
+			}
+			unauthorized(w, r)
+		})
+	}
+}
+
+// Refuse a request without valid credentials. Pages are redirected to the
+// login page, which returns to them once logged in.
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pdfsearch"`)
+		writeAPIError(w, http.StatusUnauthorized, ErrUnauthorized, "Authentication required")
+		return
+	}
+
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/login?"+url.Values{"next": {r.URL.RequestURI()}}.Encode(), http.StatusSeeOther)
+		return
+	}
+	http.Error(w, "Authentication required", http.StatusUnauthorized)
+}
+
+// AdminOnly restricts next to admins. Without authentication, it is
+// restricted to requests from localhost instead.
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := CurrentUser(r.Context())
+		if !ok {
+			LocalOnly(next).ServeHTTP(w, r)
+			return
+		}
+
+		if !user.IsAdmin() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The local path to return to after logging in. Other sites are refused
+// so that the login page does not redirect to them.
+func nextPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// Show the login form.
+func LoginPage(tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := tmpl.ExecuteTemplate(w, "login.html", map[string]any{
+			"next": nextPath(r.URL.Query().Get("next")),
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Log in with the form values name and password, then return to next.
+// Sessions last for lifetime.
+func Login(store *database.Store, tmpl *template.Template, lifetime time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		next := nextPath(r.PostForm.Get("next"))
+		user, err := store.Authenticate(r.Context(), r.PostForm.Get("name"), r.PostForm.Get("password"))
+		if errors.Is(err, database.ErrInvalidCredentials) {
+			w.WriteHeader(http.StatusUnauthorized)
+			tmpl.ExecuteTemplate(w, "login.html", map[string]any{
+				"next":  next,
+				"name":  r.PostForm.Get("name"),
+				"error": "Invalid user name or password",
+			})
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token, err := store.CreateSession(r.Context(), user.ID, lifetime)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(lifetime.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	}
+}
+
+// End the session of the cookie and return to the login page.
+func Logout(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			if err := store.DeleteSession(r.Context(), cookie.Value); err != nil {
+				log.Printf("unable to delete session: %v\n", err)
+			}
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// A server requiring authentication, with the admin alice and the user bob,
+// and their API tokens.
+func newAuthServer(t *testing.T) (handler http.Handler, aliceToken, bobToken string) {
+	t.Helper()
+	ctx := context.Background()
+	store := openStore(t)
+
+	tokens := []string{}
+	for _, user := range []struct{ name, role string }{{"alice", database.RoleAdmin}, {"bob", database.RoleUser}} {
+		created, err := store.CreateUser(ctx, user.name, "correct horse", user.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, token, err := store.CreateToken(ctx, created.ID, "tests")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	tmpl := template.Must(template.New("login.html").Parse("{{ .error }}"))
+	mux := http.NewServeMux()
+	setupAPIRoutes(mux, store, synonyms.New(nil))
+	SetupAuthRoutes(mux, store, tmpl, time.Hour)
+	mux.Handle("GET /admin/ping", AdminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mux.Handle("GET /static/style.css", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	return RequireAuth(SessionAuth{Store: store}, TokenAuth{Store: store})(mux), tokens[0], tokens[1]
+}
+
+func serve(handler http.Handler, method, url, token string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRequireAuth(t *testing.T) {
+	handler, aliceToken, bobToken := newAuthServer(t)
+
+	w := serve(handler, http.MethodGet, apiPrefix+"/documents", "", "")
+	var apiErr APIError
+	json.NewDecoder(w.Body).Decode(&apiErr)
+	if w.Code != http.StatusUnauthorized || apiErr.Error.Code != ErrUnauthorized {
+		t.Fatalf("expected a 401 unauthorized API error, got %d %+v", w.Code, apiErr)
+	}
+
+	if w := serve(handler, http.MethodGet, apiPrefix+"/documents", "pds_forged", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a forged token to be refused, got %d", w.Code)
+	}
+
+	if w := serve(handler, http.MethodGet, apiPrefix+"/documents", bobToken, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected the token of bob to be accepted, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := serve(handler, http.MethodGet, "/static/style.css", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected the assets of the login page to be public, got %d", w.Code)
+	}
+
+	// Pages redirect to the login page.
+	r := httptest.NewRequest(http.MethodGet, "/books?x=1", nil)
+	r.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?next=%2Fbooks%3Fx%3D1" {
+		t.Fatalf("expected a redirect to the login page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// Management endpoints are for admins.
+	if w := serve(handler, http.MethodGet, "/admin/ping", bobToken, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected bob to be forbidden, got %d", w.Code)
+	}
+
+	if w := serve(handler, http.MethodGet, "/admin/ping", aliceToken, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected alice to be allowed, got %d", w.Code)
+	}
+}
+
+func TestLoginSession(t *testing.T) {
+	handler, _, _ := newAuthServer(t)
+
+	login := func(form string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := login("name=bob&password=wrong"); w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected a wrong password to be refused, got %d", w.Code)
+	}
+
+	// Logging in does not redirect to other sites.
+	w := login("name=bob&password=correct+horse&next=//evil.example")
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" || len(cookies) != 1 {
+		t.Fatalf("expected a session cookie and a redirect to /, got %d %q %v", w.Code, w.Header().Get("Location"), cookies)
+	}
+
+	if !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected an HttpOnly, SameSite cookie, got %+v", cookies[0])
+	}
+
+	request := func(method, url string) int {
+		r := httptest.NewRequest(method, url, nil)
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request(http.MethodGet, apiPrefix+"/documents"); code != http.StatusOK {
+		t.Fatalf("expected the session to be accepted, got %d", code)
+	}
+
+	if code := request(http.MethodPost, "/logout"); code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after logging out, got %d", code)
+	}
+
+	if code := request(http.MethodGet, apiPrefix+"/documents"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the session to end, got %d", code)
+	}
+}
+
+func TestBookmarksArePrivate(t *testing.T) {
+	handler, aliceToken, bobToken := newAuthServer(t)
+
+	w := serve(handler, http.MethodPost, apiPrefix+"/bookmarks", aliceToken, `{"document_id": 1, "page": 1, "note": "secret plan"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected alice to bookmark the page, got %d: %s", w.Code, w.Body)
+	}
+
+	var bookmark APIBookmark
+	json.NewDecoder(w.Body).Decode(&bookmark)
+	url := apiPrefix + "/bookmarks/" + strconv.Itoa(bookmark.ID)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if w := serve(handler, method, url, bobToken, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected the bookmark of alice to be hidden from bob, got %d", method, w.Code)
+		}
+	}
+
+	var found APISearchResponse
+	json.NewDecoder(serve(handler, http.MethodGet, apiPrefix+"/search?q=secret&notes=true", bobToken, "").Body).Decode(&found)
+	if len(found.Results) != 0 {
+		t.Fatalf("expected bob not to find the notes of alice, got %+v", found.Results)
+	}
+
+	json.NewDecoder(serve(handler, http.MethodGet, apiPrefix+"/search?q=secret&notes=true", aliceToken, "").Body).Decode(&found)
+	if len(found.Results) != 1 || !found.Results[0].Note {
+		t.Fatalf("expected alice to find the note, got %+v", found.Results)
+	}
+}
+
+func TestAdminOnlyWithoutAuth(t *testing.T) {
+	handler := AdminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if w := serve(handler, http.MethodGet, "/admin/ping", "", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected remote clients to be forbidden without authentication, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/ping", nil)
+	r.RemoteAddr = "[::1]:4321"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected localhost to be allowed without authentication, got %d", w.Code)
+	}
+
+	// A proxy on localhost forwards the requests of remote clients.
+	r = httptest.NewRequest(http.MethodGet, "/admin/ping", nil)
+	r.RemoteAddr = "127.0.0.1:4321"
+	r.Header.Set("X-Forwarded-For", "192.0.2.7")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected proxied requests to be forbidden without authentication, got %d", w.Code)
+	}
+
+	// So does a proxy on a Unix socket.
+	socket := &net.UnixAddr{Name: "/run/pdfsearch.sock", Net: "unix"}
+	r = httptest.NewRequest(http.MethodGet, "/admin/ping", nil)
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, socket))
+	r.RemoteAddr = "@"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected requests on a Unix socket to be forbidden without authentication, got %d", w.Code)
+	}
+}
@@ -0,0 +1,227 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+// Maximum length of a note, in characters.
+const maxNoteLength = 10000
+
+// A bookmarked page. Bookmarks refer to the content of documents, so they
+// survive reindexing and moving the library.
+type APIBookmark struct {
+	ID         int    `json:"id"`
+	Document   string `json:"document"`    // SHA-256 hash of the content of the document
+	DocumentID int    `json:"document_id"` // 0 if the document is no longer indexed
+	Name       string `json:"name"`        // File name of the document
+	Page       int    `json:"page"`        // Numbered from 1
+	Note       string `json:"note"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+type APIBookmarkList struct {
+	Bookmarks []APIBookmark `json:"bookmarks"`
+}
+
+// Body of the requests creating a bookmark.
+type APINewBookmark struct {
+	DocumentID int    `json:"document_id"`
+	Page       int    `json:"page"` // Numbered from 1
+	Note       string `json:"note"`
+}
+
+// Body of the requests changing the note of a bookmark.
+type APIBookmarkNote struct {
+	Note string `json:"note"`
+}
+
+func apiBookmark(b database.Bookmark) APIBookmark {
+	return APIBookmark{
+		ID:         b.ID,
+		Document:   b.Document,
+		DocumentID: b.FileID,
+		Name:       b.Name,
+		Page:       b.PageNum + 1,
+		Note:       b.Note,
+		CreatedAt:  b.CreatedAt,
+		UpdatedAt:  b.UpdatedAt,
+	}
+}
+
+// The bookmark ID of the path of r.
+func bookmarkParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid bookmark id")
+		return 0, false
+	}
+	return id, true
+}
+
+// Decode the JSON body of r into v. Writes an invalid_parameter error and
+// returns false if it is malformed or its note is too long.
+func decodeBookmarkBody(w http.ResponseWriter, r *http.Request, v any, note *string) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxNoteLength+1024)).Decode(v)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid JSON body: "+err.Error())
+		return false
+	}
+
+	if utf8.RuneCountInString(*note) > maxNoteLength {
+		writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter,
+			fmt.Sprintf("Notes are limited to %d characters", maxNoteLength))
+		return false
+	}
+	return true
+}
+
+// List the bookmarks of the user by document name and page, optionally of
+// one document.
+func APIListBookmarks(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		documents := []int{}
+		if value := r.URL.Query().Get("document"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid document id "+value)
+				return
+			}
+			documents = append(documents, id)
+		}
+
+		bookmarks, err := store.ListBookmarks(r.Context(), userID(r), documents...)
+		if err != nil {
+			writeStoreError(w, err, "Bookmarks")
+			return
+		}
+
+		list := APIBookmarkList{Bookmarks: []APIBookmark{}}
+		for _, b := range bookmarks {
+			list.Bookmarks = append(list.Bookmarks, apiBookmark(b))
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+// Bookmark a page of a document. Bookmarking a page again replaces its note.
+func APICreateBookmark(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		var body APINewBookmark
+		if !decodeBookmarkBody(w, r, &body, &body.Note) {
+			return
+		}
+
+		if body.Page < 1 {
+			writeAPIError(w, http.StatusBadRequest, ErrInvalidParameter, "Invalid page number, pages are numbered from 1")
+			return
+		}
+
+		_, err := store.GetPage(r.Context(), body.DocumentID, body.Page-1)
+		if err != nil {
+			writeStoreError(w, err, "Page")
+			return
+		}
+
+		bookmark, err := store.AddBookmark(r.Context(), userID(r), body.DocumentID, body.Page-1, body.Note)
+		if err != nil {
+			writeStoreError(w, err, "Bookmark")
+			return
+		}
+		writeJSON(w, http.StatusCreated, apiBookmark(bookmark))
+	}
+}
+
+func APIGetBookmark(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := bookmarkParam(w, r)
+		if !ok {
+			return
+		}
+
+		bookmark, err := store.GetBookmark(r.Context(), userID(r), id)
+		if err != nil {
+			writeStoreError(w, err, "Bookmark")
+			return
+		}
+		writeJSON(w, http.StatusOK, apiBookmark(bookmark))
+	}
+}
+
+// Replace the note of a bookmark.
+func APIUpdateBookmark(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := bookmarkParam(w, r)
+		if !ok {
+			return
+		}
+
+		var body APIBookmarkNote
+		if !decodeBookmarkBody(w, r, &body, &body.Note) {
+			return
+		}
+
+		bookmark, err := store.UpdateBookmark(r.Context(), userID(r), id, body.Note)
+		if err != nil {
+			writeStoreError(w, err, "Bookmark")
+			return
+		}
+		writeJSON(w, http.StatusOK, apiBookmark(bookmark))
+	}
+}
+
+func APIDeleteBookmark(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := bookmarkParam(w, r)
+		if !ok {
+			return
+		}
+
+		err := store.DeleteBookmark(r.Context(), userID(r), id)
+		if err != nil {
+			writeStoreError(w, err, "Bookmark")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Show the bookmarks of the user with their notes, which can be edited and
+// deleted.
+func Bookmarks(store *database.Store, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		bookmarks, err := store.ListBookmarks(r.Context(), userID(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type bookmarkView struct {
+			database.Bookmark
+			PageNumber int // Numbered from 1
+		}
+
+		views := make([]bookmarkView, len(bookmarks))
+		for i, b := range bookmarks {
+			views[i] = bookmarkView{Bookmark: b, PageNumber: b.PageNum + 1}
+		}
+
+		err = tmpl.ExecuteTemplate(w, "bookmarks.html", map[string]any{
+			"bookmarks": views,
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
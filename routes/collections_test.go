@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+	"github.com/abiiranathan/pdfsearch/viewer"
+)
+
+func TestRestrictedDocumentsDoNotLeak(t *testing.T) {
+	ctx := context.Background()
+	store := openStore(t)
+
+	// The French book is in a restricted collection that only alice, an
+	// admin, and carol, through her group, may access.
+	tokens := map[string]string{}
+	users := map[string]database.User{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		role := database.RoleUser
+		if name == "alice" {
+			role = database.RoleAdmin
+		}
+
+		user, err := store.CreateUser(ctx, name, "correct horse", role)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, tokens[name], err = store.CreateToken(ctx, user.ID, "tests"); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+
+	licensed, err := store.CreateCollection(ctx, "licensed", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := store.CreateGroup(ctx, "infectiology")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Repeat the words of the French book so that they enter the vocabulary.
+	page := database.Page{FileID: 2, PageNum: 5, Text: "Les infections traitées", Language: "fr"}
+	if err := store.InsertPages(ctx, []database.Page{page}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range []error{
+		store.UpdateTrigramIndex(ctx),
+		store.RebuildVocabulary(ctx),
+		store.AddToCollection(ctx, licensed.ID, 2),
+		store.AddGroupMember(ctx, group.ID, users["carol"].ID),
+		store.GrantGroup(ctx, licensed.ID, group.ID),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpl := template.Must(template.New("books.html").Parse("{{ range .books }}{{ .Name }} {{ end }}"))
+	template.Must(tmpl.New("index.html").Parse("{{ range .books }}{{ .Name }} {{ end }}"))
+
+	mux := http.NewServeMux()
+	setupAPIRoutes(mux, store, synonyms.New(nil))
+	mux.HandleFunc("GET /{$}", Home(store, tmpl))
+	mux.HandleFunc("GET /books", ListBooks(store, tmpl))
+	mux.HandleFunc("GET /search", Search(store, synonyms.New(nil), database.QueryLogOptions{}))
+	mux.HandleFunc("GET /suggest", Suggest(store))
+	mux.HandleFunc("GET /books/{book_id}/{page_num}", ServerPage(store, tmpl))
+	mux.HandleFunc("GET /books/{book_id}/{page_num}/pdf", PagePDF(store, t.TempDir()))
+	mux.HandleFunc("GET /books/{book_id}/{page_num}/text", PageText(store, tmpl))
+	mux.HandleFunc("GET /books/{book_id}/extract", ExtractPages(store, t.TempDir()))
+	mux.HandleFunc("POST /pack", BuildPack(store, t.TempDir()))
+	mux.HandleFunc("GET /open-document/{book_id}", OpenDocument(store, viewer.Viewer{}))
+	handler := RequireAuth(SessionAuth{Store: store}, TokenAuth{Store: store})(mux)
+
+	// Every response about the French book mentions one of these.
+	// It is the only document in French.
+	leaks := []string{"infectiologie", "traitées", "French"}
+
+	listings := []string{
+		"/",
+		"/books",
+		"/search?query=infections&expand=false",
+		"/suggest?prefix=infect",
+		"/suggest?prefix=trait",
+		apiPrefix + "/documents",
+		apiPrefix + "/metadata",
+		apiPrefix + "/search?q=infections&expand=false",
+		apiPrefix + "/search?q=infections&mode=substring",
+		apiPrefix + "/search?q=traitees&expand=false", // Did you mean traitées?
+	}
+
+	for _, url := range listings {
+		for name, allowed := range map[string]bool{"alice": true, "bob": false, "carol": true} {
+			w := serve(handler, http.MethodGet, url, tokens[name], "")
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: GET %s: expected 200, got %d: %s", name, url, w.Code, w.Body)
+				continue
+			}
+
+			found := false
+			for _, leak := range leaks {
+				found = found || strings.Contains(w.Body.String(), leak)
+			}
+
+			if found != allowed {
+				t.Errorf("%s: GET %s: expected the French book to be listed: %v, got %s", name, url, allowed, w.Body)
+			}
+
+			// Shared caches must not serve the response to another user.
+			if cache := w.Header().Get("Cache-Control"); strings.Contains(cache, "max-age") {
+				t.Errorf("%s: GET %s: expected a private response, got Cache-Control %q", name, url, cache)
+			}
+		}
+	}
+
+	documents := []string{
+		"/books/2/4",
+		"/books/2/4/pdf",
+		"/books/2/4/text?format=plain",
+		"/books/2/extract?pages=5",
+		"/open-document/2?page=4",
+		apiPrefix + "/documents/2",
+		apiPrefix + "/documents/2/pages",
+		apiPrefix + "/documents/2/pages/5",
+		apiPrefix + "/documents/2/pages/5/text",
+	}
+
+	for _, url := range documents {
+		w := serve(handler, http.MethodGet, url, tokens["bob"], "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("bob: GET %s: expected 404, got %d: %s", url, w.Code, w.Body)
+		}
+
+		for _, leak := range leaks {
+			if strings.Contains(w.Body.String(), leak) {
+				t.Errorf("bob: GET %s: the response leaks %q: %s", url, leak, w.Body)
+			}
+		}
+	}
+
+	for _, name := range []string{"alice", "carol"} {
+		w := serve(handler, http.MethodGet, "/books/2/4/text?format=plain", tokens[name], "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "traitées") {
+			t.Errorf("%s: expected the text of the French book, got %d: %s", name, w.Code, w.Body)
+		}
+	}
+
+	// Packing a page of the French book is refused like a missing book.
+	r := httptest.NewRequest(http.MethodPost, "/pack", strings.NewReader("hit=2:4"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer "+tokens["bob"])
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bob: expected packing the French book to fail with 404, got %d: %s", w.Code, w.Body)
+	}
+
+	// Bookmarking a page of the French book is refused like a missing page.
+	w = serve(handler, http.MethodPost, apiPrefix+"/bookmarks", tokens["bob"], `{"document_id": 2, "page": 5}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bob: expected bookmarking the French book to fail with 404, got %d: %s", w.Code, w.Body)
+	}
+
+	// Without authentication, every document is accessible.
+	if _, err := store.GetFile(ctx, 2); err != nil {
+		t.Errorf("expected the store without a user to access every document, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/pdf"
+)
+
+// Maximum number of pages of an extract, which is rendered while the
+// client waits.
+const maxExtractPages = 500
+
+// Extract the pages of a book given by the pages parameter, e.g.
+// pages=120-134,140 with pages numbered from 1, into a pdf with a cover page.
+func ExtractPages(store *database.Store, pagesDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		bookID, err := strconv.Atoi(r.PathValue("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book id", http.StatusBadRequest)
+			return
+		}
+
+		file, err := store.GetFile(r.Context(), bookID)
+		if err != nil {
+			http.Error(w, "Unable to get file", http.StatusNotFound)
+			return
+		}
+
+		doc := pdf.Open(file.Path)
+		numPages := doc.NumPages
+		doc.Close()
+
+		pages, err := pdf.ParsePageRanges(r.URL.Query().Get("pages"), numPages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(pages) > maxExtractPages {
+			http.Error(w, fmt.Sprintf("Extracts are limited to %d pages", maxExtractPages), http.StatusBadRequest)
+			return
+		}
+
+		tempfile, err := os.CreateTemp(pagesDir, "extract-*.pdf")
+		if err != nil {
+			http.Error(w, "Unable to create temp file", http.StatusInternalServerError)
+			return
+		}
+		tempfile.Close()
+		defer os.Remove(tempfile.Name())
+
+		// Long extracts take longer than the server's write timeout.
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		cover := pdf.ExtractCover(file.Path, file.ID, pages, numPages)
+		if !pdf.ExtractPages(file.Path, pages, cover, tempfile.Name()) {
+			http.Error(w, "Unable to extract the pages", http.StatusInternalServerError)
+			return
+		}
+
+		name := pdf.ExtractFileName(file.Name, pages)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		http.ServeFile(w, r, tempfile.Name())
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 )
@@ -25,3 +26,31 @@ func Logger(out io.Writer) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// LocalOnly restricts next to requests from the loopback interface.
+func LocalOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLocal(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reports whether r comes from the loopback interface. Unlike the Host
+// header, the remote address is not chosen by the client.
+// Requests received on a Unix socket or forwarded by a proxy are never
+// local: the connection comes from the proxy, whatever the client.
+func isLocal(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return false
+	}
+
+	if r.Header.Get("Forwarded") != "" || r.Header.Get("X-Forwarded-For") != "" {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && net.ParseIP(host).IsLoopback()
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/pdf"
+)
+
+// Maximum number of pages of a reading pack.
+const maxPackPages = 100
+
+// Compile the pages given by the hit form values, as book_id:page_num with
+// pages numbered from 0 like the search results, into a reading pack: an
+// index page citing the query q and every page, then the pages in order,
+// each stamped with its source.
+func BuildPack(store *database.Store, pagesDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		hits := r.PostForm["hit"]
+		if len(hits) == 0 {
+			http.Error(w, "Select the pages of the pack", http.StatusBadRequest)
+			return
+		}
+
+		if len(hits) > maxPackPages {
+			http.Error(w, fmt.Sprintf("Packs are limited to %d pages", maxPackPages), http.StatusBadRequest)
+			return
+		}
+
+		files := make(map[int]database.File)
+		numPages := make(map[int]int)
+		pages := []pdf.PageRef{}
+
+		for _, hit := range hits {
+			bookID, pageNum, err := parseHit(hit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			file, ok := files[bookID]
+			if !ok {
+				file, err = store.GetFile(r.Context(), bookID)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("No book with id %d", bookID), http.StatusNotFound)
+					return
+				}
+
+				doc := pdf.Open(file.Path)
+				files[bookID], numPages[bookID] = file, doc.NumPages
+				doc.Close()
+			}
+
+			if pageNum >= numPages[bookID] {
+				http.Error(w, fmt.Sprintf("%s has no page %d", file.Name, pageNum+1), http.StatusBadRequest)
+				return
+			}
+
+			page := pdf.PageRef{Path: file.Path, FileID: file.ID, PageNum: pageNum}
+			page.Stamp = pdf.PackStamp(len(pages)+1, page)
+			pages = append(pages, page)
+		}
+
+		tempfile, err := os.CreateTemp(pagesDir, "pack-*.pdf")
+		if err != nil {
+			http.Error(w, "Unable to create temp file", http.StatusInternalServerError)
+			return
+		}
+		tempfile.Close()
+		defer os.Remove(tempfile.Name())
+
+		// Large packs take longer than the server's write timeout.
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		index := pdf.PackIndex(strings.TrimSpace(r.PostForm.Get("q")), pages)
+		if !pdf.CompilePages(pages, index, tempfile.Name()) {
+			http.Error(w, "Unable to compile the pack", http.StatusInternalServerError)
+			return
+		}
+
+		name := fmt.Sprintf("reading-pack-%s.pdf", time.Now().Format("2006-01-02"))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		http.ServeFile(w, r, tempfile.Name())
+	}
+}
+
+// Parse a hit of a pack, book_id:page_num.
+func parseHit(hit string) (int, int, error) {
+	book, page, ok := strings.Cut(hit, ":")
+	bookID, err := strconv.Atoi(book)
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid hit %q", hit)
+	}
+
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum < 0 {
+		return 0, 0, fmt.Errorf("invalid page in hit %q", hit)
+	}
+	return bookID, pageNum, nil
+}
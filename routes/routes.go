@@ -1,19 +1,23 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
-	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/language"
 	"github.com/abiiranathan/pdfsearch/pdf"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+	"github.com/abiiranathan/pdfsearch/viewer"
 )
 
 type Book struct {
@@ -22,9 +26,34 @@ type Book struct {
 	URL  string
 }
 
-func Home(tmpl *template.Template) http.HandlerFunc {
+// A language of the indexed documents.
+type Language struct {
+	Code string // ISO 639-1 code
+	Name string
+}
+
+// Search modes of the /search endpoint.
+const (
+	ModeFullText  = "fulltext"  // Match stemmed words in the pages table
+	ModeSubstring = "substring" // Match parts of words in the trigram table
+)
+
+// Response of the /search endpoint.
+type SearchResponse struct {
+	Mode        string                  // Search mode used, substring after a fallback
+	Query       string                  // The query as searched, after synonym expansion
+	Results     []database.SearchResult // Pages matching the query
+	Suggestions []string                // Corrected queries when there are few results
+	LogID       int64                   `json:",omitempty"` // ID of the search in the query log, 0 if not logged
+}
+
+// Queries with fewer results than this get spelling suggestions.
+const lowHitsThreshold = 5
+
+func Home(store *database.Store, tmpl *template.Template) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		files, err := database.GetFiles(r.Context())
+		store := storeFor(r, store)
+		files, err := store.GetFiles(r.Context())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -39,16 +68,38 @@ func Home(tmpl *template.Template) http.HandlerFunc {
 			}
 		}
 
+		codes, err := store.GetLanguages(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		languages := make([]Language, len(codes))
+		for i, code := range codes {
+			languages[i] = Language{Code: code, Name: language.Names[code]}
+		}
+
+		newMatches, err := store.CountNewMatches(r.Context(), userID(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		user, _ := CurrentUser(r.Context())
 		tmpl.ExecuteTemplate(w, "index.html", map[string]any{
-			"books": books,
+			"books":      books,
+			"languages":  languages,
+			"newMatches": newMatches,
+			"user":       user,
 		})
 
 	}
 }
 
-func ListBooks(tmpl *template.Template) http.HandlerFunc {
+func ListBooks(store *database.Store, tmpl *template.Template) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		files, err := database.GetFiles(r.Context())
+		store := storeFor(r, store)
+		files, err := store.GetFiles(r.Context())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -73,26 +124,69 @@ func ListBooks(tmpl *template.Template) http.HandlerFunc {
 	}
 }
 
-func Search() http.HandlerFunc {
+// Search the pages. Query terms are expanded with their synonyms
+// unless the expand parameter is false.
+// With mode=substring, the trigram index is searched instead. A full-text
+// search without hits falls back to the trigram index if it is populated.
+// The lang parameter restricts the search to documents in that language.
+// With notes=true, the notes of the bookmarks are searched too and their
+// matches come first.
+// Searches are recorded in the query log if it is enabled, and are then
+// not cached so that every search is recorded.
+func Search(store *database.Store, dict *synonyms.Dictionary, queryLog database.QueryLogOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
 		query := r.URL.Query().Get("query")
 		book := r.URL.Query().Get("book")
 
+		lang := r.URL.Query().Get("lang")
+		if _, ok := language.Names[lang]; lang != "" && !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Unsupported language",
+			})
+			return
+		}
+
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = ModeFullText
+		}
+
+		if mode != ModeFullText && mode != ModeSubstring {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invalid search mode",
+			})
+			return
+		}
+
+		expand := true
+		if value := r.URL.Query().Get("expand"); value != "" {
+			expand, _ = strconv.ParseBool(value)
+		}
+
+		notes, _ := strconv.ParseBool(r.URL.Query().Get("notes"))
+
 		var books []int
+		bookId := 0
 
 		if book != "" {
 			bookIdInt, err := strconv.Atoi(book)
 			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
 				json.NewEncoder(w).Encode(map[string]string{
 					"message": "Invalid book",
 				})
 				return
 			}
 			books = append(books, bookIdInt)
+			bookId = bookIdInt
 		}
 
 		if query != "" {
-			matches, err := database.Search(r.Context(), query, books...)
+			start := time.Now()
+			response, err := runSearch(r.Context(), store, dict, query, lang, mode, expand, notes, userID(r), books)
 			if err != nil {
 				w.WriteHeader(http.StatusBadRequest)
 				json.NewEncoder(w).Encode(map[string]string{
@@ -103,17 +197,163 @@ func Search() http.HandlerFunc {
 			}
 
 			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("Cache-Control", "max-age=31536000")
-			json.NewEncoder(w).Encode(matches)
+			if queryLog.Enabled {
+				response.LogID = logQuery(r.Context(), store, database.QueryLogEntry{
+					UserID:   userID(r),
+					Query:    query,
+					Language: lang,
+					Mode:     mode,
+					Expand:   expand,
+					Notes:    notes,
+					Book:     bookId,
+					Hits:     len(response.Results),
+					Latency:  time.Since(start),
+				})
+				w.Header().Set("Cache-Control", "no-store")
+			} else {
+				setCacheControl(w, r, 31536000)
+			}
+			json.NewEncoder(w).Encode(response)
 		} else {
-			json.NewEncoder(w).Encode([]string{})
+			json.NewEncoder(w).Encode(SearchResponse{
+				Mode:        mode,
+				Results:     []database.SearchResult{},
+				Suggestions: []string{},
+			})
+		}
+	}
+}
+
+// Search the pages in mode, expanding the synonyms of query if expand is
+// true, and suggest corrections if there are few results. A full-text search
+// without hits falls back to the trigram index. If notes is true, the matches
+// in the notes of the bookmarks of the user come first.
+func runSearch(ctx context.Context, store *database.Store, dict *synonyms.Dictionary,
+	query, lang, mode string, expand, notes bool, userId int, books []int) (SearchResponse, error) {
+	searched := query
+	if expand && mode == ModeFullText {
+		searched = dict.Expand(query)
+	}
+
+	var matches []database.SearchResult
+	var err error
+	if mode == ModeSubstring {
+		matches, err = store.SearchSubstring(ctx, searched, lang, books...)
+	} else {
+		matches, err = store.SearchInLanguage(ctx, searched, lang, books...)
+	}
+
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	if len(matches) == 0 && mode == ModeFullText {
+		substringMatches, ok := substringFallback(ctx, store, query, lang, books)
+		if ok {
+			mode, searched, matches = ModeSubstring, query, substringMatches
+		}
+	}
+
+	if notes {
+		// Substring queries are not valid FTS5 queries, search their words.
+		notesQuery := searched
+		if mode == ModeSubstring {
+			words := strings.Fields(strings.ReplaceAll(query, `"`, ""))
+			notesQuery = `"` + strings.Join(words, `" "`) + `"`
+		}
+
+		noteMatches, err := store.SearchNotes(ctx, userId, notesQuery, books...)
+		if err != nil {
+			return SearchResponse{}, err
+		}
+		matches = append(noteMatches, matches...)
+	}
+
+	response := SearchResponse{Mode: mode, Query: searched, Results: matches, Suggestions: []string{}}
+	if len(matches) < lowHitsThreshold {
+		response.Suggestions, err = store.Suggest(ctx, query)
+		if err != nil {
+			log.Printf("unable to suggest corrections for %q: %v\n", query, err)
+			response.Suggestions = []string{}
+		}
+	}
+	return response, nil
+}
+
+// Search the trigram index for a query without full-text hits.
+// Returns false if the index is empty or has no hits either.
+func substringFallback(ctx context.Context, store *database.Store, query, lang string, books []int) ([]database.SearchResult, bool) {
+	populated, err := store.HasTrigramIndex(ctx)
+	if err != nil || !populated {
+		return nil, false
+	}
+
+	matches, err := store.SearchSubstring(ctx, query, lang, books...)
+	if err != nil || len(matches) == 0 {
+		return nil, false
+	}
+	return matches, true
+}
+
+// Show the synonyms dictionary in an editable form.
+func Synonyms(tmpl *template.Template, dict *synonyms.Dictionary) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := tmpl.ExecuteTemplate(w, "synonyms.html", map[string]any{
+			"synonyms": dict.String(),
+			"groups":   len(dict.Groups()),
+			"saved":    r.URL.Query().Has("saved"),
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
 
+// Replace the synonyms dictionary with the submitted one and save it to path.
+func SaveSynonyms(dict *synonyms.Dictionary, path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := dict.Update(strings.NewReader(r.FormValue("synonyms")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := dict.Save(path); err != nil {
+			http.Error(w, "Unable to save synonyms", http.StatusInternalServerError)
+			return
 		}
+		http.Redirect(w, r, "/synonyms?saved", http.StatusSeeOther)
 	}
 }
 
-func ServerPage(tmpl *template.Template, pagesDir string) http.HandlerFunc {
+// Maximum number of completions returned by /suggest.
+const maxCompletions = 8
+
+// Complete the search prefix with frequent terms, phrases and book names.
+func Suggest(store *database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		prefix := r.URL.Query().Get("prefix")
+
+		completions, err := store.Complete(r.Context(), prefix, maxCompletions)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		setCacheControl(w, r, 300)
+		json.NewEncoder(w).Encode(completions)
+	}
+}
+
+func ServerPage(store *database.Store, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
 		bookID := r.PathValue("book_id")
 		pageNum := r.PathValue("page_num")
 
@@ -129,7 +369,7 @@ func ServerPage(tmpl *template.Template, pagesDir string) http.HandlerFunc {
 			return
 		}
 
-		file, err := database.GetFile(r.Context(), bookIDInt)
+		file, err := store.GetFile(r.Context(), bookIDInt)
 		if err != nil {
 			http.Error(w, "Unable to get file", http.StatusNotFound)
 			return
@@ -142,50 +382,78 @@ func ServerPage(tmpl *template.Template, pagesDir string) http.HandlerFunc {
 		}
 		defer doc.Close()
 
-		// Uses a temporary file(os.TempDir) to serve the pdf.
-		tempfile, err := os.CreateTemp(pagesDir, "*.pdf")
-		if err != nil {
-			http.Error(w, "Unable to create temp file", http.StatusInternalServerError)
-			return
-		}
-
-		// Open document, render image in one single cgo call.
-		if !pdf.RenderPageToPDF(pageNumInt, file.Path, tempfile.Name()) {
-			http.Error(w, "Unable to generate pdf for the page", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Cache-Control", "max-age=31536000")
+		setCacheControl(w, r, 31536000)
 		w.Header().Set("Content-Type", "text/html")
 
 		data := map[string]any{
 			"Title": file.Name,
-			"URL":   fmt.Sprintf("/%s", tempfile.Name()),
+			"URL":   fmt.Sprintf("/books/%s/%d/pdf", bookID, pageNumInt),
 			"ID":    bookID,
+
+			// Opens the document at this page, searching for the query.
+			"PageNum":    pageNumInt,
+			"PageNumber": pageNumInt + 1,
+			"Query":      r.URL.Query().Get("q"),
+			"TextURL":    fmt.Sprintf("/books/%s/%d/text?q=%s", bookID, pageNumInt, url.QueryEscape(r.URL.Query().Get("q"))),
+		}
+
+		addNavigation(data, pageNumInt, doc.NumPages, func(page int) string {
+			return fmt.Sprintf("/books/%s/%d", bookID, page)
+		})
+
+		tmpl.ExecuteTemplate(w, "page.html", data)
+	}
+}
+
+// Serve a page of a book as a pdf of its own, rendered in a temporary
+// file of pagesDir that is removed once sent.
+func PagePDF(store *database.Store, pagesDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		bookID, err := strconv.Atoi(r.PathValue("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book id", http.StatusBadRequest)
+			return
 		}
 
-		if pageNumInt != 0 {
-			data["FirstURL"] = fmt.Sprintf("/books/%s/0", bookID)
+		pageNum, err := strconv.Atoi(r.PathValue("page_num"))
+		if err != nil {
+			http.Error(w, "Invalid page number", http.StatusBadRequest)
+			return
 		}
 
-		if pageNumInt != doc.NumPages-1 {
-			data["LastURL"] = fmt.Sprintf("/books/%s/%d", bookID, doc.NumPages-1)
+		file, err := store.GetFile(r.Context(), bookID)
+		if err != nil {
+			http.Error(w, "Unable to get file", http.StatusNotFound)
+			return
 		}
 
-		if pageNumInt > 0 {
-			data["PrevURL"] = fmt.Sprintf("/books/%s/%d", bookID, pageNumInt-1)
+		tempfile, err := os.CreateTemp(pagesDir, "page-*.pdf")
+		if err != nil {
+			http.Error(w, "Unable to create temp file", http.StatusInternalServerError)
+			return
 		}
+		tempfile.Close()
+		defer os.Remove(tempfile.Name())
 
-		if pageNumInt < doc.NumPages-1 {
-			data["NextURL"] = fmt.Sprintf("/books/%s/%d", bookID, pageNumInt+1)
+		// Open document, render image in one single cgo call.
+		if !pdf.RenderPageToPDF(pageNum, file.Path, tempfile.Name()) {
+			http.Error(w, "Unable to generate pdf for the page", http.StatusInternalServerError)
+			return
 		}
 
-		tmpl.ExecuteTemplate(w, "page.html", data)
+		setCacheControl(w, r, 31536000)
+		w.Header().Set("Content-Type", "application/pdf")
+		http.ServeFile(w, r, tempfile.Name())
 	}
 }
 
-func OpenDocument(pagesDir string) http.HandlerFunc {
+// Open a document in the desktop viewer at the page given by the page
+// parameter, numbered from 0 like /books/{book_id}/{page_num}, searching for
+// the q parameter. Remote clients are served the file instead.
+func OpenDocument(store *database.Store, docViewer viewer.Viewer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
 		bookID := r.PathValue("book_id")
 
 		bookIDInt, err := strconv.Atoi(bookID)
@@ -194,7 +462,16 @@ func OpenDocument(pagesDir string) http.HandlerFunc {
 			return
 		}
 
-		file, err := database.GetFile(r.Context(), bookIDInt)
+		pageNum := -1
+		if page := r.URL.Query().Get("page"); page != "" {
+			pageNum, err = strconv.Atoi(page)
+			if err != nil || pageNum < 0 {
+				http.Error(w, "Invalid page number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		file, err := store.GetFile(r.Context(), bookIDInt)
 		if err != nil {
 			http.Error(w, "Unable to get file", http.StatusNotFound)
 			return
@@ -203,22 +480,12 @@ func OpenDocument(pagesDir string) http.HandlerFunc {
 		// Serve the file if it exists
 		path := file.Path
 
-		// Open the document with xdg-open if on localhost
-		host := strings.Split(r.Host, ":")[0]
-		if host == "localhost" || host == "127.0.0.1" || host == "::1" {
-			var cmd *exec.Cmd
-			if runtime.GOOS == "windows" {
-				cmd = exec.Command("cmd", "/c", "start", path)
-			} else if runtime.GOOS == "darwin" {
-				cmd = exec.Command("open", path)
-			} else {
-				cmd = exec.Command("xdg-open", path)
-			}
-
-			err := cmd.Run()
+		// Open the document in the desktop viewer if on localhost
+		if isLocal(r) {
+			err := docViewer.Open(path, pageNum+1, r.URL.Query().Get("q"))
 			if err != nil {
 				log.Printf("unable to open %s with default application. Serving it instead\n", path)
-				w.Header().Set("Cache-Control", "max-age=31536000")
+				setCacheControl(w, r, 31536000)
 				http.ServeFile(w, r, path)
 				return
 			}
@@ -228,3 +495,23 @@ func OpenDocument(pagesDir string) http.HandlerFunc {
 		}
 	}
 }
+
+// Back up the database to the backup directory with the online backup API.
+// Responds with the path and size of the backup.
+func BackupDatabase(store *database.Store, opts database.BackupOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Large databases take longer than the server's write timeout.
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "application/json")
+		backup, err := store.BackupTo(r.Context(), opts)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error(),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(backup)
+	}
+}
@@ -0,0 +1,221 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+	"github.com/abiiranathan/pdfsearch/viewer"
+)
+
+// Open an in-memory store with one English and one French book.
+func openStore(t *testing.T) *database.Store {
+	t.Helper()
+	ctx := context.Background()
+
+	store, err := database.OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	err = store.InsertFiles(ctx, []database.File{
+		{ID: 1, Name: "cardiology.pdf", Path: "/books/cardiology.pdf", Language: "en", SHA256: "c4rd10"},
+		{ID: 2, Name: "infectiologie.pdf", Path: "/books/infectiologie.pdf", Language: "fr", SHA256: "1nf3c7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.InsertPages(ctx, []database.Page{
+		{FileID: 1, PageNum: 0, Text: "Acute myocardial infarction is a medical emergency", Language: "en"},
+		{FileID: 1, PageNum: 1, Text: "Hypertension is a risk factor", Language: "en"},
+		{FileID: 2, PageNum: 4, Text: "Les infections graves sont traitées", Language: "fr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func search(t *testing.T, handler http.HandlerFunc, url string) SearchResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: expected status 200, got %d: %s", url, w.Code, w.Body)
+	}
+
+	var response SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestSearch(t *testing.T) {
+	store := openStore(t)
+	handler := Search(store, synonyms.New([][]string{{"MI", "myocardial infarction"}}), database.QueryLogOptions{})
+
+	response := search(t, handler, "/search?query=hypertension")
+	if len(response.Results) != 1 || response.Results[0].PageNum != 1 {
+		t.Fatalf("expected page 1, got %v", response.Results)
+	}
+
+	response = search(t, handler, "/search?query=MI")
+	if len(response.Results) != 1 || response.Results[0].PageNum != 0 {
+		t.Fatalf("expected MI to be expanded to page 0, got %v", response.Results)
+	}
+
+	response = search(t, handler, "/search?query=MI&expand=false")
+	if len(response.Results) != 0 {
+		t.Fatalf("expected no results without expansion, got %v", response.Results)
+	}
+
+	response = search(t, handler, "/search?query=infections&lang=fr")
+	if len(response.Results) != 1 || response.Results[0].FileID != 2 {
+		t.Fatalf("expected the French book, got %v", response.Results)
+	}
+
+	response = search(t, handler, "/search?query=infections&book=1")
+	if len(response.Results) != 0 {
+		t.Fatalf("expected no results in book 1, got %v", response.Results)
+	}
+}
+
+func TestSearchInvalidLanguage(t *testing.T) {
+	handler := Search(openStore(t), synonyms.New(nil), database.QueryLogOptions{})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/search?query=x&lang=xx", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestStoresAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	empty, err := database.OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+
+	openStore(t)
+	response := search(t, Search(empty, synonyms.New(nil), database.QueryLogOptions{}), "/search?query=hypertension")
+	if len(response.Results) != 0 {
+		t.Fatalf("expected no results in an empty store, got %v", response.Results)
+	}
+}
+
+func TestBackupDatabaseLocalOnly(t *testing.T) {
+	opts := database.BackupOptions{Dir: t.TempDir(), Keep: 1}
+	handler := LocalOnly(BackupDatabase(openStore(t), opts))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/backup", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for a remote client, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/backup", nil)
+	r.RemoteAddr = "127.0.0.1:4321"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var backup database.Backup
+	if err := json.NewDecoder(w.Body).Decode(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	if backup.Size == 0 || filepath.Dir(backup.Path) != opts.Dir {
+		t.Fatalf("unexpected backup %+v", backup)
+	}
+}
+
+func TestOpenDocumentAtPage(t *testing.T) {
+	// A viewer that records its arguments.
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "viewer")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := OpenDocument(openStore(t), viewer.Viewer{Command: script + " {page} {search} {path}"})
+
+	r := httptest.NewRequest(http.MethodGet, "/open-document/1?page=x", nil)
+	r.SetPathValue("book_id", "1")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an invalid page, got %d", w.Code)
+	}
+
+	// A remote client naming localhost in the Host header gets the file.
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8080/open-document/1?page=742&q=infarction", nil)
+	r.SetPathValue("book_id", "1")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code == http.StatusSeeOther {
+		t.Fatal("expected a spoofed Host not to run the viewer")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8080/open-document/1?page=742&q=infarction", nil)
+	r.RemoteAddr = "127.0.0.1:4321"
+	r.SetPathValue("book_id", "1")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", w.Code, w.Body)
+	}
+
+	want := "743 infarction /books/cardiology.pdf\n"
+	for i := 0; i < 50; i++ {
+		got, err := os.ReadFile(argsFile)
+		if err == nil && string(got) == want {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("the viewer was not run with %q", want)
+}
+
+func TestBuildPackValidation(t *testing.T) {
+	handler := BuildPack(openStore(t), t.TempDir())
+
+	tests := []struct {
+		form   string
+		status int
+	}{
+		{"q=infarction", http.StatusBadRequest},
+		{"hit=abc", http.StatusBadRequest},
+		{"hit=1:-1", http.StatusBadRequest},
+		{"hit=99:0", http.StatusNotFound},
+		{"hit=1:0&" + strings.Repeat("hit=1:1&", maxPackPages), http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/pack", strings.NewReader(test.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("POST %s: expected status %d, got %d", test.form, test.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/saved"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// Maximum number of matches shown on the page and in the feed of a saved search.
+const maxSavedMatches = 100
+
+// Layout of the times stored by sqlite's CURRENT_TIMESTAMP, in UTC.
+const sqliteTime = "2006-01-02 15:04:05"
+
+// An Atom feed, see RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary atomText `xml:"summary"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// The saved search of the path of r. Writes an error and returns false
+// if there is none.
+func savedSearchParam(w http.ResponseWriter, r *http.Request, store *database.Store) (database.SavedSearch, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid saved search id", http.StatusBadRequest)
+		return database.SavedSearch{}, false
+	}
+
+	search, err := store.GetSavedSearch(r.Context(), userID(r), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return search, false
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return search, false
+	}
+	return search, true
+}
+
+// The URL of a page matched by a saved search, highlighting its query.
+func savedMatchURL(search database.SavedSearch, match database.SavedMatch) string {
+	return fmt.Sprintf("/books/%d/%d?%s", match.FileID, match.PageNum, url.Values{"q": {search.Query}}.Encode())
+}
+
+// Escape the text of a snippet, keeping the <b> tags of its matches.
+func snippetHTML(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	return template.HTML(strings.NewReplacer("&lt;b&gt;", "<b>", "&lt;/b&gt;", "</b>").Replace(escaped))
+}
+
+// Convert a time stored by sqlite to RFC 3339, as required by Atom.
+func atomTime(t string) string {
+	parsed, err := time.Parse(sqliteTime, t)
+	if err != nil {
+		return t
+	}
+	return parsed.UTC().Format(time.RFC3339)
+}
+
+// List the saved searches with their number of new matches.
+func SavedSearches(store *database.Store, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		searches, err := store.ListSavedSearches(r.Context(), userID(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = tmpl.ExecuteTemplate(w, "saved_searches.html", map[string]any{
+			"searches": searches,
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Save the search of the form values name, query, lang, mode, expand and
+// book for the current user, then redirect to its matches.
+func CreateSavedSearch(store *database.Store, dict *synonyms.Dictionary) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		search := database.SavedSearch{
+			UserID:   userID(r),
+			Name:     r.PostForm.Get("name"),
+			Query:    r.PostForm.Get("query"),
+			Language: r.PostForm.Get("lang"),
+			Mode:     r.PostForm.Get("mode"),
+			Expand:   true,
+		}
+
+		if value := r.PostForm.Get("expand"); value != "" && value != "on" {
+			search.Expand, _ = strconv.ParseBool(value)
+		}
+
+		if book := r.PostForm.Get("book"); book != "" {
+			id, err := strconv.Atoi(book)
+			if err != nil {
+				http.Error(w, "Invalid book", http.StatusBadRequest)
+				return
+			}
+			search.Book = id
+		}
+
+		search, err := saved.Save(r.Context(), store, dict, search)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/saved-searches/%d", search.ID), http.StatusSeeOther)
+	}
+}
+
+// Show the latest matches of a saved search, new matches first, and mark
+// them as seen.
+func SavedSearchMatches(store *database.Store, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		search, ok := savedSearchParam(w, r, store)
+		if !ok {
+			return
+		}
+
+		matches, err := store.SavedMatches(r.Context(), search.ID, maxSavedMatches, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type matchView struct {
+			database.SavedMatch
+			URL        string
+			PageNumber int
+			Snippet    template.HTML // Snippet of the index, with <b> tags
+		}
+
+		views := make([]matchView, len(matches))
+		for i, match := range matches {
+			views[i] = matchView{
+				SavedMatch: match,
+				URL:        savedMatchURL(search, match),
+				PageNumber: match.PageNum + 1,
+				Snippet:    snippetHTML(match.Snippet),
+			}
+		}
+
+		err = tmpl.ExecuteTemplate(w, "saved_search.html", map[string]any{
+			"search":  search,
+			"matches": views,
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := store.MarkMatchesSeen(r.Context(), search.ID); err != nil {
+			log.Printf("unable to mark the matches of %q as seen: %v\n", search.Name, err)
+		}
+	}
+}
+
+// Delete a saved search and its matches.
+func DeleteSavedSearch(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		search, ok := savedSearchParam(w, r, store)
+		if !ok {
+			return
+		}
+
+		if err := store.DeleteSavedSearch(r.Context(), search.UserID, search.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/saved-searches", http.StatusSeeOther)
+	}
+}
+
+// Serve the latest matches of a saved search as an Atom feed, so that feed
+// readers are notified of the new pages. Reading the feed does not mark the
+// matches as seen.
+func SavedSearchFeed(store *database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		search, ok := savedSearchParam(w, r, store)
+		if !ok {
+			return
+		}
+
+		matches, err := store.SavedMatches(r.Context(), search.ID, maxSavedMatches, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base := scheme + "://" + r.Host
+
+		updated := search.CreatedAt
+		if search.CheckedAt != "" {
+			updated = search.CheckedAt
+		}
+
+		feed := atomFeed{
+			Title:   "pdfsearch: " + search.Name,
+			ID:      fmt.Sprintf("tag:pdfsearch,2024:saved-search:%d", search.ID),
+			Updated: atomTime(updated),
+			Links: []atomLink{
+				{Href: fmt.Sprintf("%s/saved-searches/%d/feed.atom", base, search.ID), Rel: "self"},
+				{Href: fmt.Sprintf("%s/saved-searches/%d", base, search.ID), Rel: "alternate"},
+			},
+			Entries: []atomEntry{},
+		}
+
+		for _, match := range matches {
+			feed.Entries = append(feed.Entries, atomEntry{
+				Title:   fmt.Sprintf("%s, page %d", match.Name, match.PageNum+1),
+				ID:      fmt.Sprintf("tag:pdfsearch,2024:saved-search:%d:%d:%d", search.ID, match.FileID, match.PageNum),
+				Updated: atomTime(match.FoundAt),
+				Link:    atomLink{Href: base + savedMatchURL(search, match)},
+				Summary: atomText{Type: "html", Body: match.Snippet},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(feed); err != nil {
+			log.Printf("unable to write the feed of %q: %v\n", search.Name, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/saved"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+func TestSavedSearchFeed(t *testing.T) {
+	ctx := context.Background()
+	store := openStore(t)
+	dict := synonyms.New(nil)
+
+	form := "name=risk&query=risk&mode=fulltext&expand=true&book=1"
+	r := httptest.NewRequest(http.MethodPost, "/saved-searches", strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	CreateSavedSearch(store, dict)(w, r)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/saved-searches/1" {
+		t.Fatalf("expected a redirect to /saved-searches/1, got %d %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+
+	err := store.InsertPages(ctx, []database.Page{
+		{FileID: 1, PageNum: 7, Text: "Smoking is a <risk> factor", Language: "en"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := saved.Check(ctx, store, dict); err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/saved-searches/1/feed.atom", nil)
+	r.SetPathValue("id", "1")
+	w = httptest.NewRecorder()
+	SavedSearchFeed(store)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var feed atomFeed
+	if err := xml.NewDecoder(w.Body).Decode(&feed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "cardiology.pdf, page 8" {
+		t.Fatalf("expected the new page 8 first, got %+v", feed.Entries)
+	}
+
+	if link := feed.Entries[0].Link.Href; link != "http://example.com/books/1/7?q=risk" {
+		t.Errorf("unexpected link %q", link)
+	}
+}
+
+func TestSnippetHTML(t *testing.T) {
+	got := snippetHTML("a <b>risk</b> <script>")
+	want := "a <b>risk</b> &lt;script&gt;"
+	if string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSavedSearchesArePrivate(t *testing.T) {
+	ctx := context.Background()
+	store := openStore(t)
+	dict := synonyms.New(nil)
+
+	tokens := map[string]string{}
+	for _, name := range []string{"alice", "bob"} {
+		user, err := store.CreateUser(ctx, name, "correct horse", database.RoleUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, tokens[name], err = store.CreateToken(ctx, user.ID, "tests"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /saved-searches", CreateSavedSearch(store, dict))
+	mux.HandleFunc("POST /saved-searches/{id}/delete", DeleteSavedSearch(store))
+	mux.HandleFunc("GET /saved-searches/{id}/feed.atom", SavedSearchFeed(store))
+	handler := RequireAuth(SessionAuth{Store: store}, TokenAuth{Store: store})(mux)
+
+	create := func(name string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/saved-searches", strings.NewReader("name=risk&query=risk"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+tokens[name])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Both users may use the same name.
+	for _, name := range []string{"alice", "bob"} {
+		if w := create(name); w.Code != http.StatusSeeOther {
+			t.Fatalf("%s: expected the search to be saved, got %d: %s", name, w.Code, w.Body)
+		}
+	}
+
+	if w := serve(handler, http.MethodGet, "/saved-searches/1/feed.atom", tokens["bob"], ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the search of alice to be hidden from bob, got %d", w.Code)
+	}
+
+	if w := serve(handler, http.MethodPost, "/saved-searches/1/delete", tokens["bob"], ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected bob not to delete the search of alice, got %d", w.Code)
+	}
+
+	if w := serve(handler, http.MethodGet, "/saved-searches/1/feed.atom", tokens["alice"], ""); w.Code != http.StatusOK {
+		t.Errorf("expected the search of alice to be kept, got %d", w.Code)
+	}
+}
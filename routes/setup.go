@@ -4,27 +4,91 @@ import (
 	"embed"
 	"html/template"
 	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+	"github.com/abiiranathan/pdfsearch/viewer"
 )
 
-func SetupRoutes(mux *http.ServeMux, staticFs embed.FS, pagesDir string, tmpl *template.Template) {
+func SetupRoutes(mux *http.ServeMux, store *database.Store, staticFs embed.FS, pagesDir string, tmpl *template.Template,
+	dict *synonyms.Dictionary, synonymsFile string, backupOpts database.BackupOptions, docViewer viewer.Viewer,
+	queryLog database.QueryLogOptions) {
 	// Home path
-	mux.HandleFunc("GET /{$}", Home(tmpl))
+	mux.HandleFunc("GET /{$}", Home(store, tmpl))
 
 	// Search endpoint
-	mux.HandleFunc("GET /search", Search())
+	mux.HandleFunc("GET /search", Search(store, dict, queryLog))
+
+	// Record the results opened from logged searches
+	mux.HandleFunc("POST /search/click", LogClick(store, queryLog))
+
+	// The searches of the user
+	mux.HandleFunc("GET /history", History(store, tmpl, queryLog))
+
+	// Autocomplete endpoint
+	mux.HandleFunc("GET /suggest", Suggest(store))
+
+	// Versioned JSON API
+	setupAPIRoutes(mux, store, dict)
 
 	// Open specific page.
-	mux.HandleFunc("GET /books/{book_id}/{page_num}", ServerPage(tmpl, pagesDir))
+	mux.HandleFunc("GET /books/{book_id}/{page_num}", ServerPage(store, tmpl))
+
+	// The pdf of a page, shown by the page view
+	mux.HandleFunc("GET /books/{book_id}/{page_num}/pdf", PagePDF(store, pagesDir))
+
+	// Download pages of a book as a pdf
+	mux.HandleFunc("GET /books/{book_id}/extract", ExtractPages(store, pagesDir))
+
+	// Compile selected search hits into a pdf
+	mux.HandleFunc("POST /pack", BuildPack(store, pagesDir))
+
+	// Read the text of a page, reflowed or plain
+	mux.HandleFunc("GET /books/{book_id}/{page_num}/text", PageText(store, tmpl))
 
 	// Open books page
-	mux.HandleFunc("GET /books", ListBooks(tmpl))
+	mux.HandleFunc("GET /books", ListBooks(store, tmpl))
+
+	// Bookmarked pages and their notes
+	mux.HandleFunc("GET /bookmarks", Bookmarks(store, tmpl))
+
+	// Saved searches, their new matches and their feeds
+	mux.HandleFunc("GET /saved-searches", SavedSearches(store, tmpl))
+	mux.HandleFunc("POST /saved-searches", CreateSavedSearch(store, dict))
+	mux.HandleFunc("GET /saved-searches/{id}", SavedSearchMatches(store, tmpl))
+	mux.HandleFunc("POST /saved-searches/{id}/delete", DeleteSavedSearch(store))
+	mux.HandleFunc("GET /saved-searches/{id}/feed.atom", SavedSearchFeed(store))
+
+	// View and edit the synonyms dictionary
+	mux.HandleFunc("GET /synonyms", Synonyms(tmpl, dict))
+	mux.Handle("POST /synonyms", AdminOnly(SaveSynonyms(dict, synonymsFile)))
 
-	// Open document with xdg-open if on localhost or serve it
-	mux.HandleFunc("GET /open-document/{book_id}", OpenDocument(pagesDir))
+	// Open document in the desktop viewer if on localhost or serve it
+	mux.HandleFunc("GET /open-document/{book_id}", OpenDocument(store, docViewer))
 
-	// Serve generated images
-	mux.Handle("/pages/", http.StripPrefix("/pages/", http.FileServer(http.Dir(pagesDir))))
+	// Back up the database. Only for admins, or from localhost without authentication.
+	mux.Handle("POST /admin/backup", AdminOnly(BackupDatabase(store, backupOpts)))
+
+	// Statistics of the query log. Only for admins, or from localhost without authentication.
+	mux.Handle("GET /admin/analytics", AdminOnly(Analytics(store, tmpl, queryLog)))
+
+	// Profiling. Only for admins, or from localhost without authentication.
+	mux.Handle("/debug/pprof/", AdminOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", AdminOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", AdminOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", AdminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", AdminOnly(http.HandlerFunc(pprof.Trace)))
 
 	// Server css and JS
 	mux.Handle("/static/", http.FileServerFS(staticFs))
 }
+
+// SetupAuthRoutes adds the login and logout routes. Sessions last for
+// lifetime. Wrap the mux in RequireAuth to require authentication.
+func SetupAuthRoutes(mux *http.ServeMux, store *database.Store, tmpl *template.Template, lifetime time.Duration) {
+	mux.HandleFunc("GET /login", LoginPage(tmpl))
+	mux.HandleFunc("POST /login", Login(store, tmpl, lifetime))
+	mux.HandleFunc("POST /logout", Logout(store))
+}
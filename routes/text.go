@@ -0,0 +1,324 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/pdf"
+)
+
+// Sources of the text of a page.
+const (
+	SourceIndex = "index" // The text stored in the index, without punctuation
+	SourcePDF   = "pdf"   // The text extracted from the pdf, as laid out by poppler
+)
+
+// Formats of the text of a page.
+const (
+	FormatHTML  = "html"  // Paragraphs reflowed to the width of the screen
+	FormatPlain = "plain" // The text as it is, for copying
+)
+
+// Markers of the matches in the text of a page. Private use characters do
+// not occur in extracted text, unlike <b>.
+const (
+	matchStart = "\uE000"
+	matchEnd   = "\uE001"
+)
+
+// A run of text of a paragraph, highlighted if it matches the query.
+type textSegment struct {
+	Text  string
+	Match bool
+}
+
+// Show the text of a page, as plain text or reflowed HTML with the terms of
+// the q parameter highlighted. With source=pdf, the text is extracted from
+// the pdf with its punctuation and layout instead of read from the index.
+func PageText(store *database.Store, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := storeFor(r, store)
+		bookID, err := strconv.Atoi(r.PathValue("book_id"))
+		if err != nil {
+			http.Error(w, "Invalid book id", http.StatusBadRequest)
+			return
+		}
+
+		pageNum, err := strconv.Atoi(r.PathValue("page_num"))
+		if err != nil || pageNum < 0 {
+			http.Error(w, "Invalid page number", http.StatusBadRequest)
+			return
+		}
+
+		params := r.URL.Query()
+		query, source, format := params.Get("q"), params.Get("source"), params.Get("format")
+		if source == "" {
+			source = SourceIndex
+		}
+
+		if format == "" {
+			format = FormatHTML
+		}
+
+		if (source != SourceIndex && source != SourcePDF) || (format != FormatHTML && format != FormatPlain) {
+			http.Error(w, "Invalid source or format", http.StatusBadRequest)
+			return
+		}
+
+		file, err := store.GetFile(r.Context(), bookID)
+		if err != nil {
+			http.Error(w, "Unable to get file", http.StatusNotFound)
+			return
+		}
+
+		pages, err := store.ListPages(r.Context(), bookID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var text string
+		if source == SourcePDF {
+			raw, ok := pdf.ExtractPageText(file.Path, pageNum)
+			if !ok {
+				http.Error(w, "Unable to extract the text of the page", http.StatusNotFound)
+				return
+			}
+			text = markTerms(raw, queryTerms(query))
+		} else {
+			text, err = store.HighlightPage(r.Context(), bookID, pageNum, query, matchStart, matchEnd)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				// An invalid query still shows the page.
+				log.Printf("unable to highlight %q: %v\n", query, err)
+				text, err = store.HighlightPage(r.Context(), bookID, pageNum, "", matchStart, matchEnd)
+			}
+
+			if err != nil {
+				http.Error(w, "Page not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		if format == FormatPlain {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(strings.NewReplacer(matchStart, "", matchEnd, "").Replace(text)))
+			return
+		}
+
+		// Keep the query and the options when navigating.
+		options := url.Values{}
+		for _, key := range []string{"q", "source"} {
+			if value := params.Get(key); value != "" {
+				options.Set(key, value)
+			}
+		}
+
+		pageURL := func(suffix string) func(int) string {
+			return func(page int) string {
+				u := fmt.Sprintf("/books/%d/%d%s", bookID, page, suffix)
+				if len(options) > 0 {
+					u += "?" + options.Encode()
+				}
+				return u
+			}
+		}
+
+		plain := url.Values{"format": {FormatPlain}}
+		if source != SourceIndex {
+			plain.Set("source", source)
+		}
+
+		data := map[string]any{
+			"Title":      file.Name,
+			"ID":         bookID,
+			"PageNum":    pageNum,
+			"PageNumber": pageNum + 1,
+			"Query":      query,
+			"Source":     source,
+			"Paragraphs": reflow(text),
+			"PDFURL":     pageURL("")(pageNum),
+			"PlainURL":   fmt.Sprintf("/books/%d/%d/text?%s", bookID, pageNum, plain.Encode()),
+		}
+
+		if len(pages) > 0 {
+			addNavigation(data, pageNum, pages[len(pages)-1].PageNum+1, pageURL("/text"))
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = tmpl.ExecuteTemplate(w, "text.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Add the URLs of the first, previous, next and last pages around page to
+// the data of a template. pageURL returns the URL of a page.
+func addNavigation(data map[string]any, page, numPages int, pageURL func(page int) string) {
+	if page != 0 {
+		data["FirstURL"] = pageURL(0)
+	}
+
+	if page != numPages-1 {
+		data["LastURL"] = pageURL(numPages - 1)
+	}
+
+	if page > 0 {
+		data["PrevURL"] = pageURL(page - 1)
+	}
+
+	if page < numPages-1 {
+		data["NextURL"] = pageURL(page + 1)
+	}
+}
+
+// Join the lines of text into paragraphs separated by blank lines, and split
+// the paragraphs at the match markers. Words hyphenated at the end of a line
+// are joined.
+func reflow(text string) [][]textSegment {
+	paragraphs := []string{}
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			paragraphs = append(paragraphs, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			flush()
+			continue
+		}
+
+		previous := current.String()
+		switch {
+		case previous == "":
+		case strings.HasSuffix(previous, "-") && startsWithLower(line):
+			current.Reset()
+			current.WriteString(strings.TrimSuffix(previous, "-"))
+		default:
+			current.WriteString(" ")
+		}
+		current.WriteString(line)
+	}
+	flush()
+
+	segmented := make([][]textSegment, len(paragraphs))
+	for i, paragraph := range paragraphs {
+		segmented[i] = splitMatches(paragraph)
+	}
+	return segmented
+}
+
+// Whether s starts with a lower case letter, possibly after a match marker.
+func startsWithLower(s string) bool {
+	for _, r := range strings.TrimPrefix(s, matchStart) {
+		return unicode.IsLower(r)
+	}
+	return false
+}
+
+// Split text at the match markers.
+func splitMatches(text string) []textSegment {
+	segments := []textSegment{}
+	for text != "" {
+		start := strings.Index(text, matchStart)
+		if start < 0 {
+			segments = append(segments, textSegment{Text: text})
+			break
+		}
+
+		if start > 0 {
+			segments = append(segments, textSegment{Text: text[:start]})
+		}
+
+		text = text[start+len(matchStart):]
+		end := strings.Index(text, matchEnd)
+		if end < 0 {
+			end = len(text)
+		}
+		segments = append(segments, textSegment{Text: text[:end], Match: true})
+		text = strings.TrimPrefix(text[end:], matchEnd)
+	}
+	return segments
+}
+
+// Operators of FTS5 queries, which are not terms.
+var queryOperators = map[string]bool{"and": true, "or": true, "not": true, "near": true}
+
+// The lower case words of a query, without its operators.
+func queryTerms(query string) []string {
+	terms := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if !queryOperators[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// Put match markers around the words of text that start with one of terms,
+// or that terms start with, so that "infarctions" highlights "infarction".
+func markTerms(text string, terms []string) string {
+	if len(terms) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	word := []rune{}
+
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+
+		w := string(word)
+		if matchesTerm(strings.ToLower(w), terms) {
+			b.WriteString(matchStart + w + matchEnd)
+		} else {
+			b.WriteString(w)
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
+
+// Minimum length of a word to match a longer term it is a prefix of.
+const minStemLength = 4
+
+func matchesTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+
+		if len(word) >= minStemLength && strings.HasPrefix(term, word) {
+			return true
+		}
+	}
+	return false
+}
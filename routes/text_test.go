@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReflow(t *testing.T) {
+	text := "Acute myocardial " + matchStart + "infarc-\ntion" + matchEnd + " is a\n  medical   emergency.\n\n\nGive aspirin 300 mg.\n"
+
+	expected := [][]textSegment{
+		{{Text: "Acute myocardial "}, {Text: "infarction", Match: true}, {Text: " is a medical emergency."}},
+		{{Text: "Give aspirin 300 mg."}},
+	}
+
+	if got := reflow(text); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestMarkTerms(t *testing.T) {
+	text := "Infarction: give 5 mg/kg of heparin; heparins are anticoagulants."
+	expected := matchStart + "Infarction" + matchEnd + ": give 5 mg/kg of " + matchStart + "heparin" + matchEnd +
+		"; " + matchStart + "heparins" + matchEnd + " are anticoagulants."
+
+	if got := markTerms(text, queryTerms("infarctions AND heparin")); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestPageText(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles("../templates/text.html"))
+	handler := PageText(openStore(t), tmpl)
+
+	get := func(url, bookID, pageNum string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.SetPathValue("book_id", bookID)
+		r.SetPathValue("page_num", pageNum)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := get("/books/1/0/text?q=infarction", "1", "0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{"<mark>infarction</mark>", `href="/books/1/1/text?q=infarction"`, `href="/books/1/0?q=infarction"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the page to contain %s, got %s", want, body)
+		}
+	}
+
+	if strings.Contains(body, "Prev Page") {
+		t.Errorf("expected no previous page on the first page")
+	}
+
+	w = get("/books/1/0/text?q=infarction&format=plain", "1", "0")
+	if w.Body.String() != "Acute myocardial infarction is a medical emergency" {
+		t.Errorf("unexpected plain text %q", w.Body)
+	}
+
+	if w := get("/books/1/7/text", "1", "7"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing page, got %d", w.Code)
+	}
+
+	if w := get("/books/1/0/text?format=pdf", "1", "0"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid format, got %d", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+// Package saved runs the saved searches against the index and records the
+// pages they match, so that the pages matched after an update of the index
+// are reported as new.
+package saved
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/language"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+// Search modes, the same as those of /search.
+const (
+	ModeFullText  = "fulltext"
+	ModeSubstring = "substring"
+)
+
+// The result of re-running a saved search.
+type Result struct {
+	Search database.SavedSearch
+	New    int // Number of pages matched for the first time
+}
+
+// Search runs a saved search. Its query is expanded with the synonyms of
+// dict if it was saved with Expand.
+func Search(ctx context.Context, store *database.Store, dict *synonyms.Dictionary, search database.SavedSearch) ([]database.SearchResult, error) {
+	books := []int{}
+	if search.Book != 0 {
+		books = append(books, search.Book)
+	}
+
+	if search.Mode == ModeSubstring {
+		return store.SearchSubstring(ctx, search.Query, search.Language, books...)
+	}
+
+	query := search.Query
+	if search.Expand {
+		query = dict.Expand(query)
+	}
+	return store.SearchInLanguage(ctx, query, search.Language, books...)
+}
+
+// Save validates and saves search, and records the pages it matches now,
+// which are not new.
+func Save(ctx context.Context, store *database.Store, dict *synonyms.Dictionary, search database.SavedSearch) (database.SavedSearch, error) {
+	search.Name, search.Query = strings.TrimSpace(search.Name), strings.TrimSpace(search.Query)
+	if search.Name == "" || search.Query == "" {
+		return search, fmt.Errorf("a saved search needs a name and a query")
+	}
+
+	if search.Mode == "" {
+		search.Mode = ModeFullText
+	}
+
+	if search.Mode != ModeFullText && search.Mode != ModeSubstring {
+		return search, fmt.Errorf("invalid search mode %q: expected fulltext or substring", search.Mode)
+	}
+
+	if _, ok := language.Names[search.Language]; search.Language != "" && !ok {
+		return search, fmt.Errorf("unsupported language %q", search.Language)
+	}
+
+	view, err := ownerStore(ctx, store, search)
+	if err != nil {
+		return search, err
+	}
+
+	results, err := Search(ctx, view, dict, search)
+	if err != nil {
+		return search, fmt.Errorf("invalid query %q: %w", search.Query, err)
+	}
+
+	search, err = store.CreateSavedSearch(ctx, search)
+	if err != nil {
+		return search, err
+	}
+
+	if _, err := store.RecordMatches(ctx, search.ID, results, false); err != nil {
+		return search, err
+	}
+	return search, nil
+}
+
+// Check re-runs the saved searches of every user, as that user, and records
+// the pages matched for the first time as new. A search that fails is
+// logged and skipped.
+func Check(ctx context.Context, store *database.Store, dict *synonyms.Dictionary) ([]Result, error) {
+	searches, err := store.AllSavedSearches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, search := range searches {
+		view, err := ownerStore(ctx, store, search)
+		if err != nil {
+			log.Printf("unable to find the owner of saved search %q: %v\n", search.Name, err)
+			continue
+		}
+
+		matches, err := Search(ctx, view, dict, search)
+		if err != nil {
+			log.Printf("unable to run saved search %q: %v\n", search.Name, err)
+			continue
+		}
+
+		n, err := store.RecordMatches(ctx, search.ID, matches, true)
+		if err != nil {
+			return results, fmt.Errorf("unable to record the matches of %q: %w", search.Name, err)
+		}
+
+		search.NewMatches += n
+		results = append(results, Result{Search: search, New: n})
+	}
+	return results, nil
+}
+
+// The view of store of the owner of search, so that the documents hidden
+// from them are not matched. Searches saved without authentication have
+// no owner and see the whole index.
+func ownerStore(ctx context.Context, store *database.Store, search database.SavedSearch) (*database.Store, error) {
+	if search.UserID == 0 {
+		return store, nil
+	}
+
+	user, err := store.GetUser(ctx, search.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return store.As(user), nil
+}
@@ -0,0 +1,169 @@
+package saved
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+func TestCheckFindsNewPages(t *testing.T) {
+	ctx := context.Background()
+	store, err := database.OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	addBook := func(id int, text string) {
+		t.Helper()
+		path := "/books/" + string(rune('a'+id)) + ".pdf"
+		if err := store.InsertFiles(ctx, []database.File{{ID: id, Name: path[7:], Path: path, Language: "en"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.InsertPages(ctx, []database.Page{{FileID: id, PageNum: 0, Text: text, Language: "en"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addBook(1, "Acute myocardial infarction")
+	dict := synonyms.New([][]string{{"heart attack", "myocardial infarction"}})
+
+	search, err := Save(ctx, store, dict, database.SavedSearch{Name: "MI", Query: "heart attack", Expand: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if search.NewMatches != 0 {
+		t.Fatalf("expected the pages matched when saving not to be new, got %+v", search)
+	}
+
+	if matches, _ := store.SavedMatches(ctx, search.ID, 10, false); len(matches) != 1 {
+		t.Fatalf("expected the current match to be recorded, got %+v", matches)
+	}
+
+	addBook(2, "Guidelines for myocardial infarction")
+	addBook(3, "Hypertension")
+
+	results, err := Check(ctx, store, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].New != 1 || results[0].Search.NewMatches != 1 {
+		t.Fatalf("expected 1 new page, got %+v", results)
+	}
+
+	matches, err := store.SavedMatches(ctx, search.ID, 10, true)
+	if err != nil || len(matches) != 1 || matches[0].FileID != 2 || !matches[0].New {
+		t.Fatalf("expected page 1 of book 2 to be new, got %+v, %v", matches, err)
+	}
+
+	// Checking again finds nothing new.
+	if results, _ := Check(ctx, store, dict); results[0].New != 0 {
+		t.Errorf("expected no new pages, got %+v", results)
+	}
+
+	if err := store.MarkMatchesSeen(ctx, search.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := store.CountNewMatches(ctx, 0); n != 0 {
+		t.Errorf("expected no new matches once seen, got %d", n)
+	}
+}
+
+func TestSaveValidates(t *testing.T) {
+	ctx := context.Background()
+	store, err := database.OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	dict := synonyms.New(nil)
+	invalid := []database.SavedSearch{
+		{Name: "", Query: "sepsis"},
+		{Name: "sepsis", Query: " "},
+		{Name: "sepsis", Query: "sepsis", Mode: "fuzzy"},
+		{Name: "sepsis", Query: "sepsis", Language: "xx"},
+		{Name: "sepsis", Query: `"unbalanced`},
+	}
+
+	for _, search := range invalid {
+		if _, err := Save(ctx, store, dict, search); err == nil {
+			t.Errorf("expected %+v to be invalid", search)
+		}
+	}
+
+	if _, err := Save(ctx, store, dict, database.SavedSearch{Name: "sepsis", Query: "sepsis"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Save(ctx, store, dict, database.SavedSearch{Name: "sepsis", Query: "septic shock"}); err == nil {
+		t.Error("expected names to be unique")
+	}
+}
+
+func TestCheckRunsAsOwner(t *testing.T) {
+	ctx := context.Background()
+	store, err := database.OpenMemory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	bob, err := store.CreateUser(ctx, "bob", "correct horse", database.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dict := synonyms.New(nil)
+	search, err := Save(ctx, store, dict, database.SavedSearch{UserID: bob.ID, Name: "MI", Query: "infarction"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hidden exam outranks the readable book.
+	err = store.InsertFiles(ctx, []database.File{
+		{ID: 1, Name: "cardiology.pdf", Path: "/books/cardiology.pdf", Language: "en", SHA256: "cardiology"},
+		{ID: 2, Name: "exam.pdf", Path: "/books/exam.pdf", Language: "en", SHA256: "exam"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.InsertPages(ctx, []database.Page{
+		{FileID: 1, PageNum: 0, Text: "Acute myocardial infarction is an emergency.", Language: "en"},
+		{FileID: 2, PageNum: 0, Text: "Infarction: which infarction is shown? Anterior infarction.", Language: "en"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exams, err := store.CreateCollection(ctx, "Exams", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.AddToCollection(ctx, exams.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Check(ctx, store, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].New != 1 {
+		t.Fatalf("expected 1 new page, got %+v", results)
+	}
+
+	// Read without restrictions: the hidden page must not have been recorded.
+	matches, err := store.SavedMatches(ctx, search.ID, 10, true)
+	if err != nil || len(matches) != 1 || matches[0].FileID != 1 {
+		t.Fatalf("expected only the page of book 1 to be recorded, got %+v, %v", matches, err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/language"
 	"github.com/abiiranathan/pdfsearch/pdf"
 )
 
@@ -18,8 +20,9 @@ type fileJob struct {
 }
 
 // Serialize reads all pdfs at directory, processes them in parallel and stores
-// the generated index in a binary outfile.
-func Serialize(directory string, once bool, workers int) error {
+// the extracted pages in store.
+// If trigram is true, the new pages are also added to the trigram index.
+func Serialize(store *database.Store, directory string, once bool, workers int, trigram bool) error {
 	files, err := WalkDir(directory, []string{".pdf"})
 	if err != nil {
 		return fmt.Errorf("unable to load files at %s: %v", directory, err)
@@ -59,26 +62,40 @@ func Serialize(directory string, once bool, workers int) error {
 
 	wg.Wait()
 
+	// Detect the language of each file from the text of its pages.
+	languages := detectLanguages(results)
+	for i := range results {
+		results[i].Language = languages[results[i].FileID]
+	}
+
 	// Create a slice of database.File to store the file information.
 	dbFiles := make([]database.File, numFiles)
 	for i, file := range files {
+		id := int(pdf.GetPathHash(file))
 		dbFiles[i] = database.File{
-			ID:   int(pdf.GetPathHash(file)),
-			Name: filepath.Base(file),
-			Path: file,
+			ID:       id,
+			Name:     filepath.Base(file),
+			Path:     file,
+			Language: languages[id],
+		}
+
+		// The content hash identifies the document of bookmarks across reindexing.
+		dbFiles[i].SHA256, err = pdf.GetContentHash(file)
+		if err != nil {
+			log.Printf("unable to hash %s: %v\n", file, err)
 		}
 	}
 
 	log.Println("Storing file information into the database")
 	if once {
 		// Store the file information into the database.
-		err := database.InsertFiles(context.Background(), dbFiles)
+		err := store.InsertFiles(context.Background(), dbFiles)
 		if err != nil {
 			return fmt.Errorf("unable to store files: %v", err)
 		}
 	} else {
 		// Store the file information into the database one by one.
-		err := database.InsertOneByOne(context.Background(), dbFiles)
+		err := store.InsertOneByOne(context.Background(), dbFiles)
 		if err != nil {
 			return fmt.Errorf("unable to store files: %v", err)
 		}
@@ -86,8 +103,48 @@ func Serialize(directory string, once bool, workers int) error {
 
 	// Store the generated index of results into the database.
 	if once {
-		return database.InsertPages(context.Background(), results)
+		err = store.InsertPages(context.Background(), results)
 	} else {
-		return database.InsertPagesOneByOne(context.Background(), results)
+		err = store.InsertPagesOneByOne(context.Background(), results)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if trigram {
+		log.Println("Building the trigram index for substring searches")
+		err = store.UpdateTrigramIndex(context.Background())
+		if err != nil {
+			return fmt.Errorf("unable to build trigram index: %v", err)
+		}
+	}
+	return nil
+}
+
+// Number of bytes of text per file used to detect its language.
+const languageSampleSize = 20000
+
+// Detect the language of each file from a sample of its pages.
+// Returns a map of file IDs to ISO 639-1 language codes.
+func detectLanguages(pages []database.Page) map[int]string {
+	samples := make(map[int]*strings.Builder)
+	for _, page := range pages {
+		sample, ok := samples[page.FileID]
+		if !ok {
+			sample = &strings.Builder{}
+			samples[page.FileID] = sample
+		}
+
+		if sample.Len() < languageSampleSize {
+			sample.WriteString(page.Text)
+			sample.WriteString("\n")
+		}
+	}
+
+	languages := make(map[int]string, len(samples))
+	for fileID, sample := range samples {
+		languages[fileID] = language.Detect(sample.String())
 	}
+	return languages
 }
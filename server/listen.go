@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/cli"
+)
+
+// Validity of the generated self-signed certificates. They are generated
+// again when they expire within renewBefore.
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	renewBefore        = 30 * 24 * time.Hour
+)
+
+// Listen on the Unix socket of config, or on its host and port. Returns
+// the listener and the URL it serves, for the logs.
+func listen(config *cli.Config, https bool) (net.Listener, string, error) {
+	if config.Socket != "" {
+		// Remove the socket left by a server that did not shut down.
+		if info, err := os.Stat(config.Socket); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, "", fmt.Errorf("%s exists and is not a socket", config.Socket)
+			}
+			os.Remove(config.Socket)
+		}
+
+		listener, err := net.Listen("unix", config.Socket)
+		return listener, "unix:" + config.Socket, err
+	}
+
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	listener, err := net.Listen("tcp", addr)
+	if config.Host == "" {
+		addr = net.JoinHostPort("0.0.0.0", strconv.Itoa(config.Port))
+	}
+	return listener, scheme + "://" + addr, err
+}
+
+// Redirect the requests to the same URL over HTTPS on port.
+func redirectToHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		target := strings.TrimSuffix(net.JoinHostPort(host, strconv.Itoa(port)), ":443")
+		http.Redirect(w, r, "https://"+target+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// Generate a self-signed certificate for hosts in certFile and keyFile,
+// unless they already hold a certificate valid for some time.
+func ensureSelfSigned(certFile, keyFile string, hosts []string) error {
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err == nil && time.Until(cert.NotAfter) > renewBefore {
+			return nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"pdfsearch"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("unable to create certificate: %w", err)
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+			return err
+		}
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
+
+// The names and addresses of this machine to put in a self-signed
+// certificate: localhost, its host name, the addresses of its interfaces
+// and host if it is not empty.
+func selfSignedHosts(host string) []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil && name != "localhost" {
+		hosts = append(hosts, name)
+	}
+
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				hosts = append(hosts, ipnet.IP.String())
+			}
+		}
+	}
+
+	if host != "" && !slices.Contains(hosts, host) {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls", "cert.pem"), filepath.Join(dir, "tls", "key.pem")
+
+	if err := ensureSelfSigned(certFile, keyFile, []string{"localhost", "192.168.1.20"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"localhost", "192.168.1.20"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("expected the certificate to be valid for %s: %v", host, err)
+		}
+	}
+
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the key to be private, got %v, %v", info.Mode(), err)
+	}
+
+	// A valid certificate is kept.
+	before, _ := os.ReadFile(certFile)
+	if err := ensureSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if after, _ := os.ReadFile(certFile); string(after) != string(before) {
+		t.Error("expected the valid certificate to be reused")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		host     string
+		port     int
+		expected string
+	}{
+		{"example.lan", 8443, "https://example.lan:8443/search?q=mi"},
+		{"example.lan:80", 443, "https://example.lan/search?q=mi"},
+		{"192.168.1.20:8080", 8443, "https://192.168.1.20:8443/search?q=mi"},
+		{"[::1]:8080", 8443, "https://[::1]:8443/search?q=mi"},
+		{"[::1]", 443, "https://[::1]/search?q=mi"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/search?q=mi", nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		redirectToHTTPS(test.port).ServeHTTP(w, r)
+
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.expected {
+			t.Errorf("%s: expected a redirect to %s, got %d %s", test.host, test.expected, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
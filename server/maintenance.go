@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+)
+
+// The server is idle when it has not served a request for this long.
+const idleDelay = 5 * time.Minute
+
+// Records the time of the last request to tell when the server is idle.
+type idleTracker struct {
+	last atomic.Int64 // Unix time in nanoseconds
+}
+
+func newIdleTracker() *idleTracker {
+	t := &idleTracker{}
+	t.last.Store(time.Now().UnixNano())
+	return t
+}
+
+func (t *idleTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.last.Store(time.Now().UnixNano())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Time since the last request.
+func (t *idleTracker) idleFor() time.Duration {
+	return time.Since(time.Unix(0, t.last.Load()))
+}
+
+// Optimize the index once every interval, as soon as the server is idle.
+// Optimizing merges the FTS5 segments added by incremental indexing.
+func optimizeWhenIdle(store *database.Store, tracker *idleTracker, interval time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	lastRun := time.Now()
+	for range ticker.C {
+		if time.Since(lastRun) < interval || tracker.idleFor() < idleDelay {
+			continue
+		}
+
+		log.Println("Optimizing the index")
+		start := time.Now()
+		if err := store.Optimize(context.Background()); err != nil {
+			log.Printf("unable to optimize the index: %v\n", err)
+		} else {
+			log.Printf("Optimized the index in %s\n", time.Since(start))
+		}
+		lastRun = time.Now()
+	}
+}
+
+// Delete the searches of the query log older than days, now and then daily.
+func pruneQueryLog(store *database.Store, days int) {
+	for {
+		pruned, err := store.PruneQueryLog(context.Background(), days)
+		if err != nil {
+			log.Println(err)
+		} else if pruned > 0 {
+			log.Printf("Deleted %d searches older than %d days from the query log\n", pruned, days)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// Delete the expired sessions daily.
+func deleteExpiredSessions(store *database.Store) {
+	for {
+		if _, err := store.DeleteExpiredSessions(context.Background()); err != nil {
+			log.Printf("unable to delete expired sessions: %v\n", err)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
@@ -6,23 +6,32 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	_ "net/http/pprof"
-
 	"github.com/abiiranathan/pdfsearch/cli"
+	"github.com/abiiranathan/pdfsearch/database"
 	"github.com/abiiranathan/pdfsearch/routes"
+	"github.com/abiiranathan/pdfsearch/synonyms"
 )
 
-func Run(config *cli.Config, pagesDir string, viewsFs embed.FS, staticFS embed.FS) {
+func Run(config *cli.Config, store *database.Store, viewsFs embed.FS, staticFS embed.FS) {
+	// Requests through a socket never count as local, so without accounts
+	// nobody can reach the admin pages.
+	if config.Socket != "" && !config.Auth {
+		log.Println("warning: the admin pages are refused through a Unix socket without authentication. Pass --auth and create users with `pdfsearch user add`")
+	}
+
 	// Create the pages directory if it does not exist
 	// We use this to store the generated images from pdfs.
+	pagesDir := filepath.Join(config.CacheDir, "pages")
 	err := os.MkdirAll(pagesDir, os.ModePerm)
 	if err != nil {
 		log.Fatalf("unable to create directory: %s: %v\n", pagesDir, err)
@@ -35,34 +44,125 @@ func Run(config *cli.Config, pagesDir string, viewsFs embed.FS, staticFS embed.F
 		panic(fmt.Errorf("unable to parse templates: %v", err))
 	}
 
+	// Load the synonyms used to expand queries.
+	dict, err := synonyms.Load(config.SynonymsFile)
+	if err != nil {
+		log.Fatalf("unable to load synonyms: %v\n", err)
+	}
+
 	// Create a new serveMux
 	mux := http.NewServeMux()
+	tracker := newIdleTracker()
+
+	// Require the users to log in, with a session cookie or an API token.
+	handler := http.Handler(mux)
+	if config.Auth {
+		users, err := store.CountUsers(context.Background())
+		if err != nil {
+			log.Fatalf("unable to count users: %v\n", err)
+		}
+
+		if users == 0 {
+			log.Fatalln("authentication is enabled but there are no users. Create an admin with `pdfsearch user add <name> --admin`")
+		}
+
+		routes.SetupAuthRoutes(mux, store, tmpl, time.Duration(config.SessionHours)*time.Hour)
+		handler = routes.RequireAuth(routes.SessionAuth{Store: store}, routes.TokenAuth{Store: store})(mux)
+		go deleteExpiredSessions(store)
+	}
+
+	// Serve over HTTPS with the configured certificate or a self-signed one.
+	certFile, keyFile := config.TLSFiles()
+	if (certFile == "") != (keyFile == "") {
+		log.Fatalln("serving over HTTPS needs both --tls-cert and --tls-key")
+	}
+
+	if config.TLSCert == "" && config.TLSSelfSigned {
+		if err := ensureSelfSigned(certFile, keyFile, selfSignedHosts(config.Host)); err != nil {
+			log.Fatalf("unable to generate a self-signed certificate: %v\n", err)
+		}
+		log.Printf("Using the self-signed certificate %s\n", certFile)
+	}
 
 	// Create a new http server to customize the timeouts.
 	server := &http.Server{
-		Addr:              fmt.Sprintf(":%d", config.Port),
-		Handler:           routes.Logger(os.Stdout)(mux),
+		Handler:           routes.Logger(os.Stdout)(tracker.Middleware(handler)),
 		ReadTimeout:       time.Second * 10,
 		WriteTimeout:      time.Second * 10,
 		ReadHeaderTimeout: time.Second * 5,
 	}
 
 	// Connect the routes.
-	routes.SetupRoutes(mux, staticFS, pagesDir, tmpl)
+	routes.SetupRoutes(mux, store, staticFS, pagesDir, tmpl, dict, config.SynonymsFile, config.BackupOptions(), config.DocumentViewer(),
+		config.QueryLogOptions())
+
+	// Build the autocompletion vocabulary for indexes created without one,
+	// or whose vocabulary was emptied by a migration.
+	go func() {
+		if err := store.EnsureVocabulary(context.Background()); err != nil {
+			log.Printf("unable to build vocabulary: %v\n", err)
+		}
+	}()
+
+	// Merge the index segments when nobody is searching.
+	if config.OptimizeInterval > 0 {
+		go optimizeWhenIdle(store, tracker, time.Duration(config.OptimizeInterval)*time.Hour)
+	}
+
+	// Delete the logged searches older than the retention period.
+	if config.LogQueries && config.QueryLogRetention > 0 {
+		go pruneQueryLog(store, config.QueryLogRetention)
+	}
 
-	// Clean up temporary files every 2 minutes.
-	go cleanUpTemporaryFiles(pagesDir)
+	// Remove the pdfs left behind by a server that did not shut down cleanly.
+	// The handlers remove their own once sent, so this only runs at start up:
+	// sweeping while serving would delete the files of requests in progress.
+	removeTemporaryFiles(pagesDir)
 
 	go func() {
 		defer GracefulShutdown(server)
 	}()
 
-	log.Printf("Listening on http://0.0.0.0:%d\n", config.Port)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	listener, url, err := listen(config, certFile != "")
+	if err != nil {
+		log.Fatalf("unable to listen: %v\n", err)
+	}
+
+	// Redirect the plain HTTP requests to HTTPS.
+	if certFile != "" && config.RedirectPort > 0 && config.Socket == "" {
+		go redirectHTTP(config)
+	}
+
+	log.Printf("Using database %s\n", config.Database)
+	log.Printf("Listening on %s\n", url)
+	if certFile != "" {
+		err = server.ServeTLS(listener, certFile, keyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("unable to start server: %v\n", err)
 	}
 }
 
+// Listen for plain HTTP on the redirect port and redirect the requests to
+// the HTTPS port.
+func redirectHTTP(config *cli.Config) {
+	server := &http.Server{
+		Addr:              net.JoinHostPort(config.Host, strconv.Itoa(config.RedirectPort)),
+		Handler:           redirectToHTTPS(config.Port),
+		ReadTimeout:       time.Second * 10,
+		WriteTimeout:      time.Second * 10,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+
+	log.Printf("Redirecting http://%s to HTTPS\n", server.Addr)
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("unable to redirect HTTP to HTTPS: %v\n", err)
+	}
+}
+
 // Gracefully shuts down the server. The default timeout is 10 seconds
 // To wait for pending connections.
 func GracefulShutdown(server *http.Server, timeout ...time.Duration) {
@@ -88,31 +188,20 @@ func GracefulShutdown(server *http.Server, timeout ...time.Duration) {
 	log.Println("Server shutdown")
 }
 
-func cleanUpTemporaryFiles(dir string) {
-	ticker := time.NewTicker(time.Minute)
-	quit := make(chan struct{})
-
-	proc := func() {
-		files, err := os.ReadDir(dir)
-		if err != nil {
-			return
-		}
-
-		for _, file := range files {
-			if strings.HasSuffix(file.Name(), ".pdf") {
-				os.Remove(filepath.Join(dir, file.Name()))
-			}
-		}
-		log.Println("Cleaning up generated images")
+func removeTemporaryFiles(dir string) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
 	}
 
-	for {
-		select {
-		case <-ticker.C:
-			proc()
-		case <-quit:
-			ticker.Stop()
+	removed := 0
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".pdf") && os.Remove(filepath.Join(dir, file.Name())) == nil {
+			removed++
 		}
 	}
 
+	if removed > 0 {
+		log.Printf("Removed %d temporary files from %s\n", removed, dir)
+	}
 }
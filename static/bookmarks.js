@@ -0,0 +1,29 @@
+// Save or delete the notes of the bookmarks with the API.
+for (const form of document.querySelectorAll(".bookmark")) {
+  const url = `/api/v1/bookmarks/${form.dataset.id}`;
+
+  form.onsubmit = async (event) => {
+    event.preventDefault();
+    const res = await fetch(url, {
+      method: "PATCH",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ note: form.note.value }),
+    });
+
+    if (!res.ok) {
+      const data = await res.json();
+      alert(data.error.message);
+    }
+  };
+
+  form.querySelector(".delete").onclick = async () => {
+    if (!confirm("Delete this bookmark and its note?")) {
+      return;
+    }
+
+    const res = await fetch(url, { method: "DELETE" });
+    if (res.ok) {
+      form.remove();
+    }
+  };
+}
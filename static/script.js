@@ -1,9 +1,24 @@
-const form = document.querySelector("form");
+const form = document.querySelector("main form");
 const queryInput = document.getElementById("query");
 const book_select = document.getElementById("book_select");
 const resultsDiv = document.getElementById("results");
 const statusDiv = document.getElementById("status");
 const search_books = document.getElementById("search_books");
+const completionsList = document.getElementById("completions");
+const expandCheckbox = document.getElementById("expand");
+const notesCheckbox = document.getElementById("notes");
+const mode_select = document.getElementById("mode_select");
+const lang_select = document.getElementById("lang_select");
+const packForm = document.getElementById("pack");
+const packCount = document.getElementById("pack_count");
+const saveButton = document.getElementById("save_search");
+
+// Pages selected for the reading pack, in the order they were ticked,
+// kept across searches. Maps book_id:page_num to the query that found it.
+const packHits = new Map();
+
+// ID of the last search in the query log, 0 if queries are not logged.
+let logID = 0;
 
 form.onsubmit = (event) => {
   event.preventDefault();
@@ -16,19 +31,39 @@ form.onsubmit = (event) => {
     return;
   }
   const book = book_select.value;
+  const expand = expandCheckbox.checked;
+  const notes = notesCheckbox.checked;
+  const mode = mode_select.value;
+  const lang = lang_select.value;
 
-  const url = `/search?query=${query}&book=${book}`;
+  const url = searchURL(query, book, expand, mode, lang, notes);
 
   try {
     handleSearch(url);
     localStorage.setItem("query", query);
     localStorage.setItem("book", book);
+    localStorage.setItem("expand", expand);
+    localStorage.setItem("notes", notes);
+    localStorage.setItem("mode", mode);
+    localStorage.setItem("lang", lang);
   } catch (error) {
     console.error(error);
     alert("An error occurred. Please try again.");
   }
 };
 
+function searchURL(query, book, expand, mode, lang, notes) {
+  const params = new URLSearchParams({
+    query,
+    book: book || "",
+    expand,
+    mode: mode || "fulltext",
+    lang: lang || "",
+    notes: notes || false,
+  });
+  return `/search?${params}`;
+}
+
 async function handleSearch(url) {
   const controller = new AbortController();
   const signal = controller.signal;
@@ -59,7 +94,37 @@ async function handleSearch(url) {
 
   const data = await res.json();
   const end = performance.now();
-  displayResults(data, start, end);
+  logID = data.LogID || 0;
+  displayResults(data.Results, start, end);
+  displayFallback(data.Mode, new URL(url, location.href));
+  displayExpandedQuery(data.Query);
+  displaySuggestions(data.Suggestions);
+  saveButton.hidden = false;
+}
+
+// Tell the user when a word search without hits fell back to substrings.
+function displayFallback(mode, url) {
+  const requested = url.searchParams.get("mode") || "fulltext";
+  if (!mode || mode == requested) {
+    return;
+  }
+
+  const fallback = document.createElement("p");
+  fallback.className = "expanded";
+  fallback.innerText = "No whole word matches, showing substring matches.";
+  statusDiv.appendChild(fallback);
+}
+
+// Show the query that was actually searched if synonyms were expanded.
+function displayExpandedQuery(searched) {
+  if (!searched || searched == queryInput.value.trim()) {
+    return;
+  }
+
+  const expanded = document.createElement("p");
+  expanded.className = "expanded";
+  expanded.innerText = `Searched for: ${searched}`;
+  statusDiv.appendChild(expanded);
 }
 
 function displayResults(data, start, end) {
@@ -70,14 +135,31 @@ function displayResults(data, start, end) {
   data.forEach((match) => {
     // Create a wrapper div
     const result = document.createElement("div");
-    result.className = "result";
+    result.className = match.Note ? "result note" : "result";
     resultsDiv.appendChild(result);
 
+    const hit = `${match.FileID}:${match.PageNum}`;
+    const select = document.createElement("input");
+    select.type = "checkbox";
+    select.className = "select";
+    select.title = "Add to the reading pack";
+    select.checked = packHits.has(hit);
+    select.onchange = () => {
+      if (select.checked) {
+        packHits.set(hit, queryInput.value.trim());
+      } else {
+        packHits.delete(hit);
+      }
+      updatePack();
+    };
+    result.appendChild(select);
+
     const anchor = document.createElement("a");
-    anchor.href = `/books/${match.FileID}/${match.PageNum}`;
+    anchor.href = `/books/${match.FileID}/${match.PageNum}?q=${encodeURIComponent(queryInput.value.trim())}`;
     anchor.innerHTML = match.Title;
     anchor.target = "_blank";
     anchor.rel = "noopener noreferer";
+    anchor.onclick = () => logClick(match);
     result.appendChild(anchor);
 
     // Add match text
@@ -104,12 +186,227 @@ function displayResults(data, start, end) {
   ).toFixed(1)}s`;
 }
 
+// Record the result opened in the query log.
+function logClick(match) {
+  if (logID == 0) {
+    return;
+  }
+
+  navigator.sendBeacon(
+    "/search/click",
+    new URLSearchParams({ log_id: logID, book: match.FileID, page: match.PageNum }),
+  );
+}
+
+// Show "Did you mean" links for the corrected queries.
+// Clicking a suggestion searches for it.
+function displaySuggestions(suggestions) {
+  if (!suggestions || suggestions.length == 0) {
+    return;
+  }
+
+  const didYouMean = document.createElement("p");
+  didYouMean.className = "suggestions";
+  didYouMean.innerText = "Did you mean: ";
+
+  suggestions.forEach((suggestion, index) => {
+    const anchor = document.createElement("a");
+    anchor.href = "#";
+    anchor.innerText = suggestion;
+    anchor.onclick = (event) => {
+      event.preventDefault();
+      queryInput.value = suggestion;
+      form.requestSubmit();
+    };
+
+    if (index > 0) {
+      didYouMean.append(", ");
+    }
+    didYouMean.appendChild(anchor);
+  });
+
+  statusDiv.appendChild(didYouMean);
+}
+
+// Autocomplete the last two words of the query as the user types.
+let completionTimeout = null;
+let completionController = null;
+let activeCompletion = -1;
+
+queryInput.addEventListener("input", () => {
+  clearTimeout(completionTimeout);
+  completionTimeout = setTimeout(fetchCompletions, 150);
+});
+
+queryInput.addEventListener("keydown", (event) => {
+  const items = completionsList.querySelectorAll("li");
+  if (completionsList.hidden || items.length == 0) {
+    return;
+  }
+
+  if (event.key == "ArrowDown" || event.key == "ArrowUp") {
+    event.preventDefault();
+    const step = event.key == "ArrowDown" ? 1 : -1;
+    activeCompletion = (activeCompletion + step + items.length) % items.length;
+    items.forEach((item, index) => {
+      item.classList.toggle("active", index == activeCompletion);
+    });
+  } else if (event.key == "Enter" && activeCompletion >= 0) {
+    event.preventDefault();
+    items[activeCompletion].click();
+  } else if (event.key == "Escape") {
+    hideCompletions();
+  }
+});
+
+queryInput.addEventListener("blur", () => {
+  // Delay so that a click on a completion is handled first.
+  setTimeout(hideCompletions, 200);
+});
+
+function hideCompletions() {
+  completionsList.hidden = true;
+  completionsList.innerHTML = "";
+  activeCompletion = -1;
+}
+
+// Split the query into the words to complete and the words before them.
+function splitQuery(query) {
+  const words = query.trimStart().split(/\s+/);
+  const tail = words.slice(-2).join(" ");
+  const head = words.slice(0, -2).join(" ");
+  return { head, tail };
+}
+
+async function fetchCompletions() {
+  const { head, tail } = splitQuery(queryInput.value);
+  if (tail.trim().length < 2) {
+    hideCompletions();
+    return;
+  }
+
+  // Cancel the previous request, its completions are stale.
+  if (completionController) {
+    completionController.abort();
+  }
+  completionController = new AbortController();
+
+  let data;
+  try {
+    const res = await fetch(`/suggest?prefix=${encodeURIComponent(tail)}`, {
+      signal: completionController.signal,
+    });
+    if (!res.ok) {
+      return;
+    }
+    data = await res.json();
+  } catch (error) {
+    return;
+  }
+
+  hideCompletions();
+  data.Terms.forEach((term) => {
+    const item = document.createElement("li");
+    item.innerText = term;
+    item.onclick = () => {
+      queryInput.value = head ? `${head} ${term}` : term;
+      hideCompletions();
+      queryInput.focus();
+    };
+    completionsList.appendChild(item);
+  });
+
+  data.Books.forEach((book) => {
+    const item = document.createElement("li");
+    item.className = "book";
+    item.innerText = book.Name;
+    item.onclick = () => {
+      book_select.value = book.ID;
+      queryInput.value = head;
+      hideCompletions();
+      queryInput.focus();
+    };
+    completionsList.appendChild(item);
+  });
+
+  completionsList.hidden = completionsList.children.length == 0;
+}
+
 // Load the last query
 const lastQuery = localStorage.getItem("query");
 const lastBook = localStorage.getItem("book");
+const lastExpand = localStorage.getItem("expand") != "false";
+const lastMode = localStorage.getItem("mode") || "fulltext";
+const lastLang = localStorage.getItem("lang") || "";
+const lastNotes = localStorage.getItem("notes") == "true";
 if (lastQuery) {
   queryInput.value = lastQuery;
   book_select.value = lastBook;
+  expandCheckbox.checked = lastExpand;
+  mode_select.value = lastMode;
+  lang_select.value = lastLang;
+  notesCheckbox.checked = lastNotes;
+
+  handleSearch(searchURL(lastQuery, lastBook, lastExpand, lastMode, lastLang, lastNotes));
+}
 
-  handleSearch(`/search?query=${lastQuery}&book=${lastBook}`);
+// Show the reading pack form when pages are selected.
+function updatePack() {
+  packForm.hidden = packHits.size == 0;
+  packCount.innerText = `${packHits.size} page${packHits.size == 1 ? "" : "s"} selected`;
 }
+
+// Send the selected pages and the queries that found them.
+packForm.onsubmit = () => {
+  packForm.querySelectorAll("input[type=hidden]").forEach((input) => input.remove());
+
+  const addInput = (name, value) => {
+    const input = document.createElement("input");
+    input.type = "hidden";
+    input.name = name;
+    input.value = value;
+    packForm.appendChild(input);
+  };
+
+  packHits.forEach((_, hit) => addInput("hit", hit));
+  addInput("q", [...new Set(packHits.values())].join("; "));
+};
+
+document.getElementById("pack_clear").onclick = () => {
+  packHits.clear();
+  resultsDiv.querySelectorAll("input.select").forEach((input) => (input.checked = false));
+  updatePack();
+};
+
+// Save the search with its filters, to be told of the pages it matches
+// after the next update of the index.
+saveButton.onclick = async () => {
+  const query = queryInput.value.trim();
+  if (query == "") {
+    statusDiv.innerText = "Please enter a search query";
+    return;
+  }
+
+  const name = prompt("Name of the saved search", query);
+  if (name === null || name.trim() == "") {
+    return;
+  }
+
+  const res = await fetch("/saved-searches", {
+    method: "POST",
+    body: new URLSearchParams({
+      name: name.trim(),
+      query,
+      lang: lang_select.value,
+      mode: mode_select.value,
+      expand: expandCheckbox.checked,
+      book: book_select.value,
+    }),
+  });
+
+  if (!res.ok) {
+    alert(await res.text());
+    return;
+  }
+  location = res.url;
+};
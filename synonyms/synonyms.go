@@ -0,0 +1,443 @@
+// Package synonyms expands search queries with synonyms and abbreviations
+// from a user-editable dictionary so that a search for "MI" also finds
+// "myocardial infarction".
+//
+// The dictionary file has one group of equivalent terms per line,
+// separated by commas. Blank lines and lines starting with # are ignored
+// when searching and kept when the dictionary is saved.
+//
+//	# Cardiology
+//	MI, myocardial infarction, heart attack
+//	HTN, hypertension
+package synonyms
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// FTS5 query operators. They are never expanded.
+var operators = []string{"AND", "OR", "NOT", "NEAR"}
+
+// A Dictionary of synonym groups. Safe for concurrent use.
+type Dictionary struct {
+	mu     sync.RWMutex
+	groups [][]string
+
+	// Comment and blank lines of the file, before each group and after the
+	// last one, written back by Save.
+	comments [][]string
+	footer   []string
+
+	// Index of the groups by the first word of each term (lower case).
+	index map[string][]entry
+}
+
+// A term of a group, split into its lower case words.
+type entry struct {
+	words []string
+	group int
+}
+
+// New creates a dictionary from groups of equivalent terms.
+func New(groups [][]string) *Dictionary {
+	d := &Dictionary{}
+	d.set(groups, make([][]string, len(groups)), nil)
+	return d
+}
+
+// Load reads the dictionary at path.
+// A missing file is not an error, it gives an empty dictionary.
+func Load(path string) (*Dictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return New(nil), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	d := New(nil)
+	if err := d.Update(f); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Parse reads groups of synonyms in the dictionary file format.
+func Parse(r io.Reader) ([][]string, error) {
+	groups, _, _, err := parse(r)
+	return groups, err
+}
+
+// Parse the groups of the dictionary file format with the comment and
+// blank lines before each group and after the last one.
+func parse(r io.Reader) (groups, comments [][]string, footer []string, err error) {
+	groups, comments = [][]string{}, [][]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			footer = append(footer, line)
+			continue
+		}
+
+		group := parseGroup(line)
+		if len(group) > 1 {
+			groups = append(groups, group)
+			comments = append(comments, footer)
+			footer = nil
+		}
+	}
+	return groups, comments, footer, scanner.Err()
+}
+
+// Split a comma separated list of terms, dropping empty terms.
+func parseGroup(line string) []string {
+	group := []string{}
+	for _, term := range strings.Split(line, ",") {
+		term = strings.Join(strings.Fields(term), " ")
+		if term != "" {
+			group = append(group, term)
+		}
+	}
+	return group
+}
+
+// Save writes the dictionary to path in the dictionary file format,
+// creating its directory if needed.
+func (d *Dictionary) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f, d.String())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// String returns the dictionary in the file format, with its comments.
+func (d *Dictionary) String() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var sb strings.Builder
+	for i, group := range d.groups {
+		for _, line := range d.comments[i] {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString(strings.Join(group, ", "))
+		sb.WriteString("\n")
+	}
+
+	for _, line := range d.footer {
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// Groups returns a copy of the synonym groups.
+func (d *Dictionary) Groups() [][]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	groups := make([][]string, len(d.groups))
+	for i, group := range d.groups {
+		groups[i] = slices.Clone(group)
+	}
+	return groups
+}
+
+// Update replaces the groups and the comments of the dictionary with
+// those read from r in the dictionary file format.
+func (d *Dictionary) Update(r io.Reader) error {
+	groups, comments, footer, err := parse(r)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.set(groups, comments, footer)
+	return nil
+}
+
+// Add a group of synonyms given as a comma separated list of terms.
+// If some terms already belong to groups, these groups are merged into
+// the first one, which keeps its place and comments.
+func (d *Dictionary) Add(line string) error {
+	group := parseGroup(line)
+	if len(group) < 2 {
+		return fmt.Errorf("a synonym group needs at least two terms: %q", line)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	merged := -1
+	absorbed := make(map[int]bool)
+	for i, existing := range d.groups {
+		if !overlaps(existing, group) {
+			continue
+		}
+
+		if merged < 0 {
+			merged = i
+		}
+		absorbed[i] = true
+
+		for _, term := range existing {
+			if !containsFold(group, term) {
+				group = append(group, term)
+			}
+		}
+	}
+
+	if merged < 0 {
+		d.set(append(d.groups, group), append(d.comments, nil), d.footer)
+		return nil
+	}
+
+	// Put the terms of the first group first, as they were.
+	first := slices.Clone(d.groups[merged])
+	for _, term := range group {
+		if !containsFold(first, term) {
+			first = append(first, term)
+		}
+	}
+
+	d.keep(func(i int, existing []string) []string {
+		switch {
+		case i == merged:
+			return first
+		case absorbed[i]:
+			return nil
+		}
+		return existing
+	})
+	return nil
+}
+
+// Remove a term from every group it belongs to.
+// Groups left with a single term are dropped.
+// Returns false if the term was not found.
+func (d *Dictionary) Remove(term string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	found := false
+	d.keep(func(_ int, group []string) []string {
+		kept := []string{}
+		for _, t := range group {
+			if strings.EqualFold(t, term) {
+				found = true
+				continue
+			}
+			kept = append(kept, t)
+		}
+		return kept
+	})
+	return found
+}
+
+// Replace each group by the result of update, dropping the groups left
+// with less than two terms. The comments of a dropped group move to the
+// next one. Must be called with the lock held.
+func (d *Dictionary) keep(update func(i int, group []string) []string) {
+	groups, comments := [][]string{}, [][]string{}
+	var carried []string
+	for i, group := range d.groups {
+		carried = append(carried, d.comments[i]...)
+
+		if kept := update(i, group); len(kept) > 1 {
+			groups = append(groups, kept)
+			comments = append(comments, carried)
+			carried = nil
+		}
+	}
+	d.set(groups, comments, append(carried, d.footer...))
+}
+
+// Expand replaces every term of query that belongs to a synonym group with
+// an OR group of all the terms, e.g. "MI treatment" becomes
+// `("MI" OR "myocardial infarction") treatment`.
+// Quoted phrases, operators and prefix queries (MI*) are left untouched.
+// Queries with NEAR groups are not expanded since they only accept phrases.
+func (d *Dictionary) Expand(query string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.groups) == 0 || strings.Contains(query, "NEAR(") {
+		return query
+	}
+
+	var sb strings.Builder
+	quoted := false
+	start := 0
+	for i, r := range query {
+		if r != '"' {
+			continue
+		}
+
+		if quoted {
+			sb.WriteString(query[start : i+1])
+		} else {
+			sb.WriteString(d.expandSegment(query[start:i]))
+			sb.WriteRune(r)
+		}
+		quoted = !quoted
+		start = i + 1
+	}
+
+	if quoted {
+		sb.WriteString(query[start:])
+	} else {
+		sb.WriteString(d.expandSegment(query[start:]))
+	}
+	return sb.String()
+}
+
+// A word of a query segment and its byte offsets.
+type word struct {
+	text       string
+	start, end int
+}
+
+// Expand an unquoted part of the query.
+func (d *Dictionary) expandSegment(segment string) string {
+	words := splitWords(segment)
+
+	var sb strings.Builder
+	offset := 0
+	for i := 0; i < len(words); i++ {
+		if slices.Contains(operators, words[i].text) {
+			continue
+		}
+
+		e, ok := d.longestMatch(words[i:])
+		if !ok {
+			continue
+		}
+
+		last := words[i+len(e.words)-1]
+		if strings.HasPrefix(segment[last.end:], "*") {
+			continue
+		}
+
+		sb.WriteString(segment[offset:words[i].start])
+		sb.WriteString(orGroup(d.groups[e.group]))
+		offset = last.end
+		i += len(e.words) - 1
+	}
+	sb.WriteString(segment[offset:])
+	return sb.String()
+}
+
+// Find the longest term that matches the words at the start of words.
+func (d *Dictionary) longestMatch(words []word) (entry, bool) {
+	var best entry
+	found := false
+
+	for _, e := range d.index[strings.ToLower(words[0].text)] {
+		if len(e.words) > len(words) || (found && len(e.words) <= len(best.words)) {
+			continue
+		}
+
+		matches := true
+		for j, w := range e.words {
+			if strings.ToLower(words[j].text) != w {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			best = e
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Format the terms as an FTS5 OR group of phrases.
+func orGroup(terms []string) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return "(" + strings.Join(phrases, " OR ") + ")"
+}
+
+// Set the groups with their comments and rebuild the index.
+// Must be called with the lock held.
+func (d *Dictionary) set(groups, comments [][]string, footer []string) {
+	d.groups = groups
+	d.comments = comments
+	d.footer = footer
+	d.index = make(map[string][]entry)
+
+	for i, group := range groups {
+		for _, term := range group {
+			words := []string{}
+			for _, w := range splitWords(term) {
+				words = append(words, strings.ToLower(w.text))
+			}
+
+			if len(words) > 0 {
+				d.index[words[0]] = append(d.index[words[0]], entry{words: words, group: i})
+			}
+		}
+	}
+}
+
+// Split s into runs of letters and digits.
+func splitWords(s string) []word {
+	words := []word{}
+	start := -1
+	for i, r := range s {
+		isWordRune := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			words = append(words, word{text: s[start:i], start: start, end: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, word{text: s[start:], start: start, end: len(s)})
+	}
+	return words
+}
+
+// Reports whether two groups share a term, ignoring case.
+func overlaps(a, b []string) bool {
+	for _, term := range a {
+		if containsFold(b, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(terms []string, term string) bool {
+	return slices.ContainsFunc(terms, func(t string) bool {
+		return strings.EqualFold(t, term)
+	})
+}
@@ -0,0 +1,131 @@
+package synonyms_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/pdfsearch/synonyms"
+)
+
+func TestExpand(t *testing.T) {
+	dict := synonyms.New([][]string{
+		{"MI", "myocardial infarction"},
+		{"paracetamol", "acetaminophen"},
+	})
+
+	tc := []struct {
+		query    string
+		expected string
+	}{
+		{query: "MI treatment", expected: `("MI" OR "myocardial infarction") treatment`},
+		{query: "acute myocardial infarction", expected: `acute ("MI" OR "myocardial infarction")`},
+		{query: "Paracetamol AND dose", expected: `("paracetamol" OR "acetaminophen") AND dose`},
+		{query: `"paracetamol overdose" OR MI`, expected: `"paracetamol overdose" OR ("MI" OR "myocardial infarction")`},
+		{query: "paracet* dose", expected: "paracet* dose"},
+		{query: "MI*", expected: "MI*"},
+		{query: "NEAR(MI shock)", expected: "NEAR(MI shock)"},
+		{query: "asthma", expected: "asthma"},
+	}
+
+	for _, c := range tc {
+		t.Run(c.query, func(t *testing.T) {
+			got := dict.Expand(c.query)
+			if got != c.expected {
+				t.Fatalf("expected %s, got %s", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := "# comment\n\nMI, myocardial  infarction\nlonely\nHTN,hypertension,\n"
+	groups, err := synonyms.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+
+	if groups[0][1] != "myocardial infarction" {
+		t.Fatalf("expected normalized spaces, got %q", groups[0][1])
+	}
+
+	if len(groups[1]) != 2 {
+		t.Fatalf("expected empty terms to be dropped, got %v", groups[1])
+	}
+}
+
+func TestAddAndRemove(t *testing.T) {
+	dict := synonyms.New([][]string{{"MI", "myocardial infarction"}})
+
+	if err := dict.Add("heart attack, mi"); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := dict.Groups()
+	if len(groups) != 1 || len(groups[0]) != 3 {
+		t.Fatalf("expected the groups to be merged, got %v", groups)
+	}
+
+	if err := dict.Add("lonely"); err == nil {
+		t.Fatal("expected an error for a group with a single term")
+	}
+
+	if !dict.Remove("heart attack") {
+		t.Fatal("expected heart attack to be removed")
+	}
+
+	if !dict.Remove("MI") || len(dict.Groups()) != 0 {
+		t.Fatalf("expected the group with a single term to be dropped, got %v", dict.Groups())
+	}
+}
+
+func TestSaveKeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "pdfsearch", "synonyms.txt")
+	input := "# Cardiology\nMI, myocardial infarction\n\n# Drugs\nparacetamol, acetaminophen\nASA, aspirin\n# End\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := synonyms.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dict.Add("heart attack, MI"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !dict.Remove("paracetamol") {
+		t.Fatal("expected paracetamol to be removed")
+	}
+
+	if err := dict.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := os.ReadFile(path)
+	expected := "# Cardiology\nMI, myocardial infarction, heart attack\n\n# Drugs\nASA, aspirin\n# End\n"
+	if string(saved) != expected {
+		t.Fatalf("expected the comments to be kept:\n%s\ngot:\n%s", expected, saved)
+	}
+}
+
+func TestSaveCreatesDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "pdfsearch", "synonyms.txt")
+	if err := synonyms.New([][]string{{"MI", "myocardial infarction"}}).Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved, _ := os.ReadFile(path); string(saved) != "MI, myocardial infarction\n" {
+		t.Fatalf("unexpected dictionary %q", saved)
+	}
+}
@@ -0,0 +1,243 @@
+// Package tui is a terminal interface to search the index: a query box,
+// the list of matching pages and a preview of the selected page.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abiiranathan/pdfsearch/database"
+	"github.com/abiiranathan/pdfsearch/viewer"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Time to wait after the last key press before searching.
+const searchDelay = 200 * time.Millisecond
+
+// Markers of the matches in the preview, replaced by tview color tags
+// after the text is escaped.
+const (
+	highlightStart = "\uE000"
+	highlightEnd   = "\uE001"
+)
+
+const help = "[::b]Tab[::-] switch focus  [::b]Enter/o[::-] open PDF  [::b]Esc[::-] quit"
+
+// The state of the interface.
+type app struct {
+	store  *database.Store
+	viewer viewer.Viewer
+	app    *tview.Application
+
+	input   *tview.InputField
+	list    *tview.List
+	preview *tview.TextView
+	status  *tview.TextView
+
+	mu      sync.Mutex
+	query   string                  // Last query searched
+	results []database.SearchResult // Results of the last query
+	timer   *time.Timer             // Delays the search while typing
+	cancel  context.CancelFunc      // Cancels the running search
+}
+
+// Run starts the interface and blocks until the user quits. Results are
+// opened with docViewer at their page.
+func Run(store *database.Store, docViewer viewer.Viewer) error {
+	a := &app{
+		store:   store,
+		viewer:  docViewer,
+		app:     tview.NewApplication(),
+		input:   tview.NewInputField().SetLabel("Search: "),
+		list:    tview.NewList().ShowSecondaryText(true).SetHighlightFullLine(true),
+		preview: tview.NewTextView().SetDynamicColors(true).SetWordWrap(true),
+		status:  tview.NewTextView().SetDynamicColors(true).SetText(help),
+	}
+
+	a.list.SetBorder(true).SetTitle(" Results ")
+	a.preview.SetBorder(true).SetTitle(" Preview ")
+
+	a.input.SetChangedFunc(a.scheduleSearch)
+	a.input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter || key == tcell.KeyTab || key == tcell.KeyDown {
+			a.app.SetFocus(a.list)
+		}
+	})
+
+	a.list.SetChangedFunc(func(index int, _, _ string, _ rune) {
+		a.showPreview(index)
+	})
+	a.list.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+		a.openResult(index)
+	})
+
+	a.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyTab:
+			a.app.SetFocus(a.input)
+			return nil
+		case event.Rune() == 'o':
+			a.openResult(a.list.GetCurrentItem())
+			return nil
+		case event.Rune() == 'j':
+			return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+		case event.Rune() == 'k':
+			return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+		}
+		return event
+	})
+
+	a.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			a.app.Stop()
+			return nil
+		}
+		return event
+	})
+
+	panes := tview.NewFlex().
+		AddItem(a.list, 0, 2, false).
+		AddItem(a.preview, 0, 3, false)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(a.input, 1, 0, true).
+		AddItem(panes, 0, 1, false).
+		AddItem(a.status, 1, 0, false)
+
+	return a.app.SetRoot(layout, true).SetFocus(a.input).Run()
+}
+
+// Search for query once the user stops typing.
+func (a *app) scheduleSearch(query string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+
+	a.timer = time.AfterFunc(searchDelay, func() {
+		a.search(strings.TrimSpace(query))
+	})
+}
+
+// Search the index and show the results. Runs outside the event loop.
+func (a *app) search(query string) {
+	a.mu.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.mu.Unlock()
+
+	results := []database.SearchResult{}
+	var err error
+	if query != "" {
+		results, err = a.store.Search(ctx, query)
+	}
+
+	if ctx.Err() != nil {
+		return // A newer search is running.
+	}
+
+	a.app.QueueUpdateDraw(func() {
+		a.mu.Lock()
+		a.query, a.results = query, results
+		a.mu.Unlock()
+
+		a.list.Clear()
+		a.preview.Clear()
+
+		if err != nil {
+			a.status.SetText(fmt.Sprintf("[red]Invalid query: %s", tview.Escape(err.Error())))
+			return
+		}
+
+		for _, result := range results {
+			main := fmt.Sprintf("%s  p. %d", result.BaseName, result.PageNum+1)
+			a.list.AddItem(tview.Escape(main), tview.Escape(plainSnippet(result.Title)), 0, nil)
+		}
+
+		if query != "" {
+			a.status.SetText(fmt.Sprintf("%d results  %s", len(results), help))
+		} else {
+			a.status.SetText(help)
+		}
+	})
+}
+
+// The result at index, false if there is none.
+func (a *app) result(index int) (database.SearchResult, string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if index < 0 || index >= len(a.results) {
+		return database.SearchResult{}, "", false
+	}
+	return a.results[index], a.query, true
+}
+
+// Show the full text of the result at index with its matches highlighted.
+// Runs in the event loop.
+func (a *app) showPreview(index int) {
+	result, query, ok := a.result(index)
+	if !ok {
+		return
+	}
+
+	text, err := a.store.HighlightPage(context.Background(), result.FileID, result.PageNum,
+		query, highlightStart, highlightEnd)
+	if err != nil {
+		a.preview.SetText(fmt.Sprintf("[red]Unable to load the page: %s", tview.Escape(err.Error())))
+		return
+	}
+
+	a.preview.SetTitle(fmt.Sprintf(" %s, page %d ", tview.Escape(result.BaseName), result.PageNum+1))
+	a.preview.SetText(highlight(text))
+	a.scrollToFirstMatch(text)
+}
+
+// Scroll the preview so that the first match is visible.
+func (a *app) scrollToFirstMatch(text string) {
+	line := strings.Count(text[:max(strings.Index(text, highlightStart), 0)], "\n")
+	a.preview.ScrollTo(max(line-2, 0), 0)
+}
+
+// Open the PDF of the result at index at its page, searching for the query.
+func (a *app) openResult(index int) {
+	result, query, ok := a.result(index)
+	if !ok {
+		return
+	}
+
+	file, err := a.store.GetFile(context.Background(), result.FileID)
+	if err == nil {
+		err = a.viewer.Open(file.Path, result.PageNum+1, query)
+	}
+
+	if err != nil {
+		a.status.SetText(fmt.Sprintf("[red]Unable to open the document: %s", tview.Escape(err.Error())))
+		return
+	}
+	a.status.SetText(fmt.Sprintf("Opened %s  %s", tview.Escape(file.Name), help))
+}
+
+// Escape text for tview and turn the highlight markers into color tags.
+func highlight(text string) string {
+	return strings.NewReplacer(
+		highlightStart, "[black:yellow]",
+		highlightEnd, "[-:-]",
+	).Replace(tview.Escape(text))
+}
+
+// Remove the <b> tags of a snippet and put it on a single line.
+func plainSnippet(snippet string) string {
+	snippet = strings.NewReplacer("<b>", "", "</b>", "").Replace(snippet)
+	return strings.Join(strings.Fields(snippet), " ")
+}
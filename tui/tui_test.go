@@ -0,0 +1,21 @@
+package tui
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	text := "Acute " + highlightStart + "myocardial" + highlightEnd + " infarction [STEMI]"
+	want := "Acute [black:yellow]myocardial[-:-] infarction [STEMI[]"
+
+	if got := highlight(text); got != want {
+		t.Errorf("highlight() = %q, want %q", got, want)
+	}
+}
+
+func TestPlainSnippet(t *testing.T) {
+	snippet := "...the <b>heart</b>\n  rate is <b>elevated</b>..."
+	want := "...the heart rate is elevated..."
+
+	if got := plainSnippet(snippet); got != want {
+		t.Errorf("plainSnippet() = %q, want %q", got, want)
+	}
+}
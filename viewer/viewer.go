@@ -0,0 +1,181 @@
+// Package viewer opens documents with the PDF viewer of the system, at a
+// given page and searching for a term when the viewer supports it.
+package viewer
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Placeholders of a command template.
+const (
+	PlaceholderPath   = "{path}"   // Path of the document
+	PlaceholderPage   = "{page}"   // Page number, from 1
+	PlaceholderSearch = "{search}" // Term to search for
+	PlaceholderURL    = "{url}"    // file:// URL with #page and #search fragments, for browsers
+)
+
+// Command templates of the viewers known to open a document at a page,
+// by name of their executable. Arguments with {page} or {search} are left
+// out when there is no page or term.
+var Templates = map[string]string{
+	"evince":  "evince --page-index={page} --find={search} {path}",
+	"okular":  "okular --page={page} --find={search} {path}",
+	"zathura": "zathura --page={page} --find={search} {path}",
+	"mupdf":   "mupdf {path} {page}",
+	"firefox": "firefox {url}",
+}
+
+// Executables of the known viewers, in order of preference when none of
+// them is the default application for PDFs.
+var detectOrder = []string{"zathura", "okular", "evince", "mupdf", "firefox"}
+
+// Viewer opens documents with Command, a template such as
+// "zathura -P {page} {path}". If Command is empty, the default PDF
+// application is used when its command line is known, otherwise the first
+// known viewer found in PATH, falling back to xdg-open, open or start,
+// which open the document at its first page.
+type Viewer struct {
+	Command string
+}
+
+// Open opens the document at path at page, numbered from 1, searching for
+// search if it is not empty. page 0 opens the document at its first page.
+func (v Viewer) Open(path string, page int, search string) error {
+	template := v.Command
+	if template == "" {
+		template = detect()
+	}
+
+	if template == "" {
+		return openDefault(path)
+	}
+
+	args := Expand(template, path, page, search)
+	if len(args) == 0 {
+		return fmt.Errorf("empty viewer command %q", template)
+	}
+
+	// Viewers keep running until closed by the user.
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Expand splits template into arguments and replaces their placeholders.
+// Arguments are split before replacing, so paths and terms with spaces stay
+// a single argument. Arguments with {search} are dropped if search is empty
+// and arguments with {page} if page is 0.
+func Expand(template, path string, page int, search string) []string {
+	if page < 1 {
+		page = 0
+	}
+
+	replacer := strings.NewReplacer(
+		PlaceholderPath, path,
+		PlaceholderPage, strconv.Itoa(page),
+		PlaceholderSearch, search,
+		PlaceholderURL, fileURL(path, page, search),
+	)
+
+	args := []string{}
+	for _, field := range strings.Fields(template) {
+		if search == "" && strings.Contains(field, PlaceholderSearch) {
+			continue
+		}
+
+		if page == 0 && strings.Contains(field, PlaceholderPage) {
+			continue
+		}
+		args = append(args, replacer.Replace(field))
+	}
+	return args
+}
+
+// The file:// URL of path with the fragments of PDF.js and Chromium's viewer
+// that open it at page and search for search.
+func fileURL(path string, page int, search string) string {
+	abs, err := filepath.Abs(path)
+	if err == nil {
+		path = abs
+	}
+
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	fragment := []string{}
+	if page > 0 {
+		fragment = append(fragment, "page="+strconv.Itoa(page))
+	}
+
+	if search != "" {
+		fragment = append(fragment, "search="+url.QueryEscape(search))
+	}
+
+	if len(fragment) > 0 {
+		return u.String() + "#" + strings.Join(fragment, "&")
+	}
+	return u.String()
+}
+
+// The template of the default PDF application if it is a known viewer,
+// else of the first known viewer in PATH. Empty if there is none.
+func detect() string {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return ""
+	}
+
+	if name := defaultApplication(); name != "" {
+		if _, err := exec.LookPath(name); err == nil {
+			return Templates[name]
+		}
+	}
+
+	for _, name := range detectOrder {
+		if _, err := exec.LookPath(name); err == nil {
+			return Templates[name]
+		}
+	}
+	return ""
+}
+
+// The known viewer that is the default application for PDFs according to
+// xdg-mime, e.g. evince for org.gnome.Evince.desktop. Empty if unknown.
+func defaultApplication() string {
+	out, err := exec.Command("xdg-mime", "query", "default", "application/pdf").Output()
+	if err != nil {
+		return ""
+	}
+	return knownViewer(string(out))
+}
+
+// The known viewer a desktop entry name refers to.
+func knownViewer(desktopEntry string) string {
+	entry := strings.ToLower(desktopEntry)
+	for _, name := range detectOrder {
+		if strings.Contains(entry, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Open path with the default application of the system: start on Windows,
+// open on macOS and xdg-open elsewhere.
+func openDefault(path string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", "start", path)
+	} else if runtime.GOOS == "darwin" {
+		cmd = exec.Command("open", path)
+	} else {
+		cmd = exec.Command("xdg-open", path)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,46 @@
+package viewer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		template string
+		page     int
+		search   string
+		want     []string
+	}{
+		{"zathura -P {page} {path}", 743, "", []string{"zathura", "-P", "743", "/books/heart failure.pdf"}},
+		{Templates["evince"], 12, "ejection fraction",
+			[]string{"evince", "--page-index=12", "--find=ejection fraction", "/books/heart failure.pdf"}},
+		{Templates["okular"], 12, "", []string{"okular", "--page=12", "/books/heart failure.pdf"}},
+		{Templates["mupdf"], 0, "sepsis", []string{"mupdf", "/books/heart failure.pdf"}},
+		{Templates["firefox"], 3, "heart rate",
+			[]string{"firefox", "file:///books/heart%20failure.pdf#page=3&search=heart+rate"}},
+	}
+
+	for _, test := range tests {
+		got := Expand(test.template, "/books/heart failure.pdf", test.page, test.search)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expand(%q, %d, %q) = %q, want %q", test.template, test.page, test.search, got, test.want)
+		}
+	}
+}
+
+func TestKnownViewer(t *testing.T) {
+	entries := map[string]string{
+		"org.gnome.Evince.desktop\n":         "evince",
+		"okularApplication_pdf.desktop":      "okular",
+		"org.pwmt.zathura-pdf-mupdf.desktop": "zathura",
+		"firefox.desktop":                    "firefox",
+		"org.kde.kdenlive.desktop":           "",
+	}
+
+	for entry, want := range entries {
+		if got := knownViewer(entry); got != want {
+			t.Errorf("knownViewer(%q) = %q, want %q", entry, got, want)
+		}
+	}
+}